@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/pthm/gate/asm"
+	"github.com/pthm/gate/octo"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// asmCommand assembles a source file into a ROM and a symbol file, Octo sources are compiled with the octo package
+func asmCommand(args []string) error {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gate asm [flags] source.asm|game.8o")
+		flags.PrintDefaults()
+	}
+	outPath := flags.String("o", "", "path of the ROM to write, defaults to the source path with a .ch8 extension")
+	symPath := flags.String("sym", "", "path of the symbol file to write, defaults to the ROM path with a .sym extension")
+
+	flags.Parse(args)
+	srcPath := flags.Arg(0)
+	if srcPath == "" {
+		return errors.New("must supply a path to a source file")
+	}
+
+	compile := asm.AssembleFile
+	if strings.EqualFold(filepath.Ext(srcPath), ".8o") {
+		compile = octo.CompileFile
+	}
+	out, err := compile(srcPath)
+	if err != nil {
+		return err
+	}
+
+	if *outPath == "" {
+		*outPath = strings.TrimSuffix(srcPath, filepath.Ext(srcPath)) + ".ch8"
+	}
+	if *symPath == "" {
+		*symPath = strings.TrimSuffix(*outPath, filepath.Ext(*outPath)) + ".sym"
+	}
+
+	if err := os.WriteFile(*outPath, out.Binary, 0644); err != nil {
+		return fmt.Errorf("could not write ROM (%s): %w", *outPath, err)
+	}
+
+	sym, err := os.Create(*symPath)
+	if err != nil {
+		return fmt.Errorf("could not create symbol file (%s): %w", *symPath, err)
+	}
+	defer sym.Close()
+	if err := out.WriteSymbols(sym); err != nil {
+		return err
+	}
+
+	fmt.Printf("Assembled %s: %d bytes, %d symbols\n", *outPath, len(out.Binary), len(out.Labels)+len(out.Constants))
+	return nil
+}
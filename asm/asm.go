@@ -0,0 +1,391 @@
+package asm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultOrigin is the address the first statement is assembled at, where CPU.LoadROM places the ROM
+const DefaultOrigin = 0x200
+
+// Output is an assembled program
+type Output struct {
+	Origin    uint16
+	Binary    []byte            // ROM bytes starting at Origin
+	Labels    map[string]uint16 // Address of every label
+	Constants map[string]int    // Value of every EQU constant
+	Lines     []Line            // Source lines that generated code, in the order they were assembled
+}
+
+// Error is an assembly error at a line of source
+type Error struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// statement is one instruction or directive
+type statement struct {
+	file      string
+	line      int
+	addr      int
+	size      int
+	mnemonic  string
+	operands  []operand
+	data      []expr // DB and DW values, strings are expanded to one expression per character
+	dataWidth int
+}
+
+// constant is an EQU definition, evaluated on use since it may refer to labels defined after it
+type constant struct {
+	file      string
+	line      int
+	addr      int
+	value     expr
+	resolved  bool
+	resolving bool
+	result    int
+}
+
+type assembler struct {
+	addr       int
+	statements []statement
+	labels     map[string]int
+	constants  map[string]*constant
+	includes   []string // Files currently being assembled, to catch recursive includes
+}
+
+// AssembleFile reads and assembles the source file at path
+func AssembleFile(path string) (*Output, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Assemble(path, src)
+}
+
+// Assemble assembles src in two passes. The first lays out statements and assigns label addresses, the second
+// evaluates expressions and encodes instructions. filename is used in errors and to resolve INCLUDE paths
+func Assemble(filename string, src []byte) (*Output, error) {
+	a := &assembler{
+		addr:      DefaultOrigin,
+		labels:    map[string]int{},
+		constants: map[string]*constant{},
+	}
+	if err := a.parse(filename, src); err != nil {
+		return nil, err
+	}
+	return a.emit()
+}
+
+// parse is the first pass
+func (a *assembler) parse(filename string, src []byte) error {
+	for _, included := range a.includes {
+		if included == filename {
+			return fmt.Errorf("%s includes itself", filename)
+		}
+	}
+	a.includes = append(a.includes, filename)
+	defer func() { a.includes = a.includes[:len(a.includes)-1] }()
+
+	for n, line := range strings.Split(string(src), "\n") {
+		if err := a.parseLine(filename, n+1, line); err != nil {
+			// Errors from included files already carry their own location
+			if _, ok := err.(*Error); ok {
+				return err
+			}
+			return &Error{File: filename, Line: n + 1, Err: err}
+		}
+	}
+	return nil
+}
+
+func (a *assembler) parseLine(filename string, line int, text string) error {
+	tokens, err := lex(text)
+	if err != nil {
+		return err
+	}
+
+	// Any number of labels may start a line
+	for len(tokens) >= 2 && tokens[0].kind == tokIdent && tokens[1].text == ":" {
+		if err := a.define(tokens[0].text); err != nil {
+			return err
+		}
+		a.labels[tokens[0].text] = a.addr
+		tokens = tokens[2:]
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	if tokens[0].kind != tokIdent {
+		return fmt.Errorf("expected an instruction, found %q", tokens[0].text)
+	}
+
+	// NAME EQU expr and NAME = expr define constants
+	if len(tokens) >= 2 && (strings.EqualFold(tokens[1].text, "EQU") || tokens[1].text == "=") {
+		if err := a.define(tokens[0].text); err != nil {
+			return err
+		}
+		if len(tokens) == 2 {
+			return fmt.Errorf("%s has no value", tokens[0].text)
+		}
+		a.constants[tokens[0].text] = &constant{file: filename, line: line, addr: a.addr, value: expr(tokens[2:])}
+		return nil
+	}
+
+	mnemonic := strings.ToUpper(tokens[0].text)
+	args := splitOperands(tokens[1:])
+
+	switch mnemonic {
+	case "ORG":
+		if len(args) != 1 {
+			return fmt.Errorf("ORG takes one address")
+		}
+		addr, err := args[0].eval(a, a.addr)
+		if err != nil {
+			return err
+		}
+		if addr < DefaultOrigin || addr > 0xFFFF {
+			return fmt.Errorf("ORG 0x%X is outside 0x%X-0xFFFF", addr, DefaultOrigin)
+		}
+		a.addr = addr
+		return nil
+	case "INCLUDE":
+		if len(tokens) != 2 || tokens[1].kind != tokString {
+			return fmt.Errorf(`INCLUDE takes a quoted path, e.g. INCLUDE "sprites.asm"`)
+		}
+		path := tokens[1].text
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(filename), path)
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return a.parse(path, src)
+	case "DB", "DW":
+		st := statement{file: filename, line: line, addr: a.addr, mnemonic: mnemonic, dataWidth: 1}
+		if mnemonic == "DW" {
+			st.dataWidth = 2
+		}
+		for _, arg := range args {
+			if len(arg) == 1 && arg[0].kind == tokString {
+				for _, c := range []byte(arg[0].text) {
+					st.data = append(st.data, expr{{kind: tokNumber, value: int(c)}})
+				}
+				continue
+			}
+			if len(arg) == 0 {
+				return fmt.Errorf("empty %s value", mnemonic)
+			}
+			st.data = append(st.data, arg)
+		}
+		st.size = len(st.data) * st.dataWidth
+		return a.add(st)
+	}
+
+	st := statement{file: filename, line: line, addr: a.addr, mnemonic: mnemonic, size: 2}
+	for _, arg := range args {
+		o, err := parseOperand(arg)
+		if err != nil {
+			return err
+		}
+		st.operands = append(st.operands, o)
+	}
+	if signature(st.mnemonic, st.operands) == "LD I,LONG" {
+		st.size = 4
+	}
+	return a.add(st)
+}
+
+// add appends a statement and advances the address past it
+func (a *assembler) add(st statement) error {
+	if st.addr+st.size > 0x10000 {
+		return fmt.Errorf("program does not fit in memory")
+	}
+	a.statements = append(a.statements, st)
+	a.addr += st.size
+	return nil
+}
+
+// define checks a label or constant name is free
+func (a *assembler) define(name string) error {
+	if isReserved(name) {
+		return fmt.Errorf("%s is a reserved name", name)
+	}
+	if _, ok := a.labels[name]; ok {
+		return fmt.Errorf("%s is already defined", name)
+	}
+	if _, ok := a.constants[name]; ok {
+		return fmt.Errorf("%s is already defined", name)
+	}
+	return nil
+}
+
+// lookup resolves a label or constant, which lets the assembler evaluate expressions
+func (a *assembler) lookup(name string) (int, error) {
+	if addr, ok := a.labels[name]; ok {
+		return addr, nil
+	}
+	c, ok := a.constants[name]
+	if !ok {
+		return 0, fmt.Errorf("undefined symbol %s", name)
+	}
+	if c.resolved {
+		return c.result, nil
+	}
+	if c.resolving {
+		return 0, fmt.Errorf("%s is defined in terms of itself", name)
+	}
+
+	c.resolving = true
+	defer func() { c.resolving = false }()
+	value, err := c.value.eval(a, c.addr)
+	if err != nil {
+		return 0, err
+	}
+	c.resolved, c.result = true, value
+	return value, nil
+}
+
+// emit is the second pass
+func (a *assembler) emit() (*Output, error) {
+	var memory [0x10000]byte
+	var used [0x10000]bool
+	var lines []Line
+	end := DefaultOrigin
+
+	for _, st := range a.statements {
+		var bytes []byte
+		var err error
+		if st.dataWidth > 0 {
+			bytes, err = a.encodeData(st)
+		} else {
+			bytes, err = a.encode(st)
+		}
+		if err != nil {
+			return nil, &Error{File: st.file, Line: st.line, Err: err}
+		}
+
+		for n, b := range bytes {
+			if used[st.addr+n] {
+				return nil, &Error{File: st.file, Line: st.line, Err: fmt.Errorf("overwrites 0x%03X, check ORG directives", st.addr+n)}
+			}
+			used[st.addr+n] = true
+			memory[st.addr+n] = b
+		}
+		end = max(end, st.addr+len(bytes))
+		if len(bytes) > 0 {
+			lines = append(lines, Line{Addr: uint16(st.addr), Size: len(bytes), File: st.file, Line: st.line})
+		}
+	}
+
+	out := &Output{
+		Origin:    DefaultOrigin,
+		Binary:    append([]byte(nil), memory[DefaultOrigin:end]...),
+		Labels:    map[string]uint16{},
+		Constants: map[string]int{},
+		Lines:     lines,
+	}
+	for name, addr := range a.labels {
+		out.Labels[name] = uint16(addr)
+	}
+	for name, c := range a.constants {
+		value, err := a.lookup(name)
+		if err != nil {
+			return nil, &Error{File: c.file, Line: c.line, Err: err}
+		}
+		out.Constants[name] = value
+	}
+	return out, nil
+}
+
+func (a *assembler) encodeData(st statement) ([]byte, error) {
+	var bytes []byte
+	for n, e := range st.data {
+		value, err := e.eval(a, st.addr+n*st.dataWidth)
+		if err != nil {
+			return nil, err
+		}
+		if st.dataWidth == 1 {
+			if value < -0x80 || value > 0xFF {
+				return nil, fmt.Errorf("DB value %d does not fit in a byte", value)
+			}
+			bytes = append(bytes, byte(value))
+			continue
+		}
+		if value < -0x8000 || value > 0xFFFF {
+			return nil, fmt.Errorf("DW value %d does not fit in a word", value)
+		}
+		bytes = append(bytes, byte(value>>8), byte(value))
+	}
+	return bytes, nil
+}
+
+// splitOperands splits tokens on top level commas
+func splitOperands(tokens []token) []expr {
+	if len(tokens) == 0 {
+		return nil
+	}
+	var args []expr
+	depth, start := 0, 0
+	for n, tok := range tokens {
+		switch tok.text {
+		case "(", "[":
+			depth++
+		case ")", "]":
+			depth--
+		case ",":
+			if depth == 0 && tok.kind == tokPunct {
+				args = append(args, expr(tokens[start:n]))
+				start = n + 1
+			}
+		}
+	}
+	return append(args, expr(tokens[start:]))
+}
+
+// WriteSymbols writes the labels and constants as EQU definitions ordered by value, so a symbol file can be
+// included by other sources or loaded by a debugger
+func (o *Output) WriteSymbols(w io.Writer) error {
+	type symbol struct {
+		name  string
+		value int
+	}
+	symbols := make([]symbol, 0, len(o.Labels)+len(o.Constants))
+	for name, addr := range o.Labels {
+		symbols = append(symbols, symbol{name, int(addr)})
+	}
+	for name, value := range o.Constants {
+		symbols = append(symbols, symbol{name, value})
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].value != symbols[j].value {
+			return symbols[i].value < symbols[j].value
+		}
+		return symbols[i].name < symbols[j].name
+	})
+
+	for _, s := range symbols {
+		value := fmt.Sprintf("0x%03X", s.value)
+		if s.value < 0 {
+			value = fmt.Sprint(s.value)
+		}
+		if _, err := fmt.Fprintf(w, "%s EQU %s\n", s.name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package asm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pthm/gate/disasm"
+)
+
+func Test_assemble(t *testing.T) {
+	src := `
+; Draws a sprite then loops forever
+SPEED = 3
+main:
+	LD V0, SPEED * 2 + 1
+	LD I, sprite
+	DRW V0, V1, sprite_end - sprite
+	CALL sub
+loop:	JP loop
+sub:	ADD V0, -1
+	RET
+sprite:	DB 0b11110000, #90, 'A'
+sprite_end:
+	DW 0xBEEF, $
+`
+	out, err := Assemble("test.asm", []byte(src))
+	if err != nil {
+		t.Fatalf("assemble failed: %v\n", err)
+	}
+
+	want := []byte{
+		0x60, 0x07, // LD V0, 7
+		0xA2, 0x0E, // LD I, 0x20E
+		0xD0, 0x13, // DRW V0, V1, 3
+		0x22, 0x0A, // CALL 0x20A
+		0x12, 0x08, // JP 0x208
+		0x70, 0xFF, // ADD V0, 0xFF
+		0x00, 0xEE, // RET
+		0xF0, 0x90, 0x41,
+		0xBE, 0xEF, 0x02, 0x13,
+	}
+	if !bytes.Equal(out.Binary, want) {
+		t.Fatalf("binary should be % X, was % X\n", want, out.Binary)
+	}
+	if out.Labels["sprite"] != 0x20E || out.Constants["SPEED"] != 3 {
+		t.Fatalf("symbols were not recorded: %v %v\n", out.Labels, out.Constants)
+	}
+
+	// Lines without code map to the next line that has some
+	if line, ok := out.AddrOf("test.asm", 9); !ok || line.Addr != 0x208 || line.Line != 9 {
+		t.Fatalf("line 9 should map to 0x208, got %+v\n", line)
+	}
+	if line, ok := out.AddrOf("test.asm", 4); !ok || line.Addr != 0x200 || line.Line != 5 {
+		t.Fatalf("line 4 should map to line 5 at 0x200, got %+v\n", line)
+	}
+	if line, ok := out.LineAt(0x213); !ok || line.Line != 14 {
+		t.Fatalf("0x213 should be in the DW on line 14, got %+v\n", line)
+	}
+}
+
+// Test_assembleAllOpcodes checks every instruction the disassembler can write assembles back to the same opcode
+func Test_assembleAllOpcodes(t *testing.T) {
+	var src strings.Builder
+	var want []byte
+	for opcode := 0; opcode <= 0xFFFF; opcode++ {
+		in := disasm.Decode(uint16(opcode))
+		if !in.Valid() || in.Kind == disasm.LoadLong {
+			continue
+		}
+		fmt.Fprintln(&src, disasm.Format(in, disasm.Cowgod, nil))
+		want = append(want, byte(opcode>>8), byte(opcode))
+		// Keep within memory, checking a block of opcodes at a time
+		if len(want) == 0x8000 || opcode == 0xFFFF {
+			out, err := Assemble("opcodes.asm", []byte(src.String()))
+			if err != nil {
+				t.Fatalf("assemble failed: %v\n", err)
+			}
+			if !bytes.Equal(out.Binary, want) {
+				t.Fatalf("opcodes below 0x%04X did not round trip\n", opcode)
+			}
+			src.Reset()
+			want = want[:0]
+		}
+	}
+}
+
+// Test_assembleDisassembly assembles a disassembly listing, which must give back the original ROM
+func Test_assembleDisassembly(t *testing.T) {
+	rom := []byte{
+		0x00, 0xE0, 0xA2, 0x10, 0x60, 0x05, 0x22, 0x0C, 0xF0, 0x00, 0x12, 0x34, 0x12, 0x0C,
+		0xD0, 0x15, 0x00, 0xEE, 0xFF, 0x81, 0x81, 0xFF,
+	}
+	var listing bytes.Buffer
+	if err := disasm.Disassemble(rom, disasm.Options{}).Write(&listing, disasm.Cowgod); err != nil {
+		t.Fatalf("disassemble failed: %v\n", err)
+	}
+
+	out, err := Assemble("listing.asm", listing.Bytes())
+	if err != nil {
+		t.Fatalf("assemble failed: %v\n%s", err, listing.String())
+	}
+	if !bytes.Equal(out.Binary, rom) {
+		t.Fatalf("binary should be % X, was % X\n", rom, out.Binary)
+	}
+}
+
+func Test_assembleInclude(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "sprites.asm"), []byte("ORG 0x300\nsprite: DB 0xFF\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.asm"), []byte("LD I, sprite\nINCLUDE \"sprites.asm\"\n"), 0644)
+
+	out, err := AssembleFile(filepath.Join(dir, "main.asm"))
+	if err != nil {
+		t.Fatalf("assemble failed: %v\n", err)
+	}
+	if len(out.Binary) != 0x101 || out.Binary[0] != 0xA3 || out.Binary[0x100] != 0xFF {
+		t.Fatalf("include should place the sprite at 0x300 and gap fill with zeros\n")
+	}
+}
+
+func Test_assembleErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+		msg  string
+	}{
+		{"LD V0, 0x100", 1, "does not fit"},
+		{"CLS\nJP nowhere", 2, "undefined symbol"},
+		{"a: CLS\na: CLS", 2, "already defined"},
+		{"X = Y + 1\nY = X\nLD V0, X", 3, "in terms of itself"},
+		{"B: CLS", 1, "reserved"},
+		{"DRW V0, V1", 1, "invalid instruction"},
+		{"JP V1, 0x300", 1, "must use V0"},
+		{"CLS\nORG 0x200\nCLS", 3, "overwrites"},
+	}
+
+	for _, test := range tests {
+		_, err := Assemble("test.asm", []byte(test.src))
+		var asmErr *Error
+		if !errors.As(err, &asmErr) {
+			t.Fatalf("%q should fail with an assembly error, got %v\n", test.src, err)
+		}
+		if asmErr.Line != test.line || !strings.Contains(err.Error(), test.msg) {
+			t.Fatalf("%q should fail on line %d with %q, got %v\n", test.src, test.line, test.msg, err)
+		}
+	}
+}
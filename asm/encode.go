@@ -0,0 +1,272 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// operandKind is the syntactic class of an operand, fixed in the first pass so instruction sizes are known before
+// any expression is evaluated
+type operandKind int
+
+const (
+	opExpr     operandKind = iota // An expression, its range depends on the instruction
+	opRegister                    // V0-VF
+	opIndex                       // I
+	opIndexMem                    // [I]
+	opDelay                       // DT
+	opSound                       // ST
+	opKey                         // K
+	opFont                        // F
+	opBigFont                     // HF
+	opBCD                         // B
+	opFlags                       // R
+	opLong                        // LONG expr, a 16-bit address
+)
+
+// operandNames are the names of the special operands, and appear in instruction signatures
+var operandNames = map[string]operandKind{
+	"I":  opIndex,
+	"DT": opDelay,
+	"ST": opSound,
+	"K":  opKey,
+	"F":  opFont,
+	"HF": opBigFont,
+	"B":  opBCD,
+	"R":  opFlags,
+}
+
+type operand struct {
+	kind  operandKind
+	reg   int
+	value expr
+}
+
+func parseOperand(tokens expr) (operand, error) {
+	if len(tokens) == 0 {
+		return operand{}, fmt.Errorf("missing operand")
+	}
+	if len(tokens) == 3 && tokens[0].text == "[" && strings.EqualFold(tokens[1].text, "I") && tokens[2].text == "]" {
+		return operand{kind: opIndexMem}, nil
+	}
+	if tokens[0].kind == tokIdent && strings.EqualFold(tokens[0].text, "LONG") {
+		if len(tokens) == 1 {
+			return operand{}, fmt.Errorf("LONG needs an address")
+		}
+		return operand{kind: opLong, value: tokens[1:]}, nil
+	}
+	if len(tokens) == 1 && tokens[0].kind == tokIdent {
+		name := strings.ToUpper(tokens[0].text)
+		if reg, ok := register(name); ok {
+			return operand{kind: opRegister, reg: reg}, nil
+		}
+		if kind, ok := operandNames[name]; ok {
+			return operand{kind: kind}, nil
+		}
+	}
+	return operand{kind: opExpr, value: tokens}, nil
+}
+
+// register parses V0-VF
+func register(name string) (int, bool) {
+	if len(name) != 2 || name[0] != 'V' {
+		return 0, false
+	}
+	reg := strings.IndexByte("0123456789ABCDEF", name[1])
+	return reg, reg >= 0
+}
+
+// isReserved reports whether a name would be read as a register or special operand
+func isReserved(name string) bool {
+	upper := strings.ToUpper(name)
+	_, special := operandNames[upper]
+	_, reg := register(upper)
+	return special || reg || upper == "LONG"
+}
+
+// signature describes the shape of an instruction, e.g. "LD V,E" for LD V0, 0x05
+func signature(mnemonic string, operands []operand) string {
+	shapes := make([]string, len(operands))
+	for n, o := range operands {
+		switch o.kind {
+		case opExpr:
+			shapes[n] = "E"
+		case opRegister:
+			shapes[n] = "V"
+		case opIndexMem:
+			shapes[n] = "[I]"
+		case opLong:
+			shapes[n] = "LONG"
+		default:
+			for name, kind := range operandNames {
+				if kind == o.kind {
+					shapes[n] = name
+				}
+			}
+		}
+	}
+	return strings.TrimSpace(mnemonic + " " + strings.Join(shapes, ","))
+}
+
+// encode assembles an instruction, using the same mnemonics the disassembler writes in its Cowgod syntax
+func (a *assembler) encode(st statement) ([]byte, error) {
+	ops := st.operands
+	var x, y int
+	if len(ops) > 0 {
+		x = ops[0].reg
+	}
+	if len(ops) > 1 {
+		y = ops[1].reg
+	}
+
+	// value evaluates operand n and checks it fits in bits
+	value := func(n int, bits uint) (int, error) {
+		v, err := ops[n].value.eval(a, st.addr)
+		if err != nil {
+			return 0, err
+		}
+		// Negative bytes are accepted as two's complement so ADD V0, -1 reads naturally
+		if bits == 8 && v >= -0x80 && v < 0 {
+			v &= 0xFF
+		}
+		if v < 0 || v >= 1<<bits {
+			return 0, fmt.Errorf("%d does not fit in %d bits", v, bits)
+		}
+		return v, nil
+	}
+	word := func(opcode int) ([]byte, error) {
+		return []byte{byte(opcode >> 8), byte(opcode)}, nil
+	}
+	withValue := func(opcode, n int, bits uint) ([]byte, error) {
+		v, err := value(n, bits)
+		if err != nil {
+			return nil, err
+		}
+		return word(opcode | v)
+	}
+	vx := x << 8
+	vxy := x<<8 | y<<4
+
+	switch sig := signature(st.mnemonic, ops); sig {
+	case "CLS":
+		return word(0x00E0)
+	case "RET":
+		return word(0x00EE)
+	case "SCD E":
+		return withValue(0x00C0, 0, 4)
+	case "SCU E":
+		return withValue(0x00D0, 0, 4)
+	case "SCR":
+		return word(0x00FB)
+	case "SCL":
+		return word(0x00FC)
+	case "EXIT":
+		return word(0x00FD)
+	case "LOW":
+		return word(0x00FE)
+	case "HIGH":
+		return word(0x00FF)
+	case "SYS E":
+		return withValue(0x0000, 0, 12)
+	case "JP E":
+		return withValue(0x1000, 0, 12)
+	case "CALL E":
+		return withValue(0x2000, 0, 12)
+	case "SE V,E":
+		return withValue(0x3000|vx, 1, 8)
+	case "SNE V,E":
+		return withValue(0x4000|vx, 1, 8)
+	case "SE V,V":
+		return word(0x5000 | vxy)
+	case "SAVE V,V":
+		return word(0x5002 | vxy)
+	case "LOAD V,V":
+		return word(0x5003 | vxy)
+	case "LD V,E":
+		return withValue(0x6000|vx, 1, 8)
+	case "ADD V,E":
+		return withValue(0x7000|vx, 1, 8)
+	case "LD V,V":
+		return word(0x8000 | vxy)
+	case "OR V,V":
+		return word(0x8001 | vxy)
+	case "AND V,V":
+		return word(0x8002 | vxy)
+	case "XOR V,V":
+		return word(0x8003 | vxy)
+	case "ADD V,V":
+		return word(0x8004 | vxy)
+	case "SUB V,V":
+		return word(0x8005 | vxy)
+	case "SHR V,V":
+		return word(0x8006 | vxy)
+	case "SHR V":
+		// Shifting Vx into itself gives the same result whether or not the ShiftVY quirk is on
+		return word(0x8006 | x<<8 | x<<4)
+	case "SUBN V,V":
+		return word(0x8007 | vxy)
+	case "SHL V,V":
+		return word(0x800E | vxy)
+	case "SHL V":
+		return word(0x800E | x<<8 | x<<4)
+	case "SNE V,V":
+		return word(0x9000 | vxy)
+	case "LD I,E":
+		return withValue(0xA000, 1, 12)
+	case "JP V,E":
+		if x != 0 {
+			return nil, fmt.Errorf("JP with an offset must use V0")
+		}
+		return withValue(0xB000, 1, 12)
+	case "RND V,E":
+		return withValue(0xC000|vx, 1, 8)
+	case "DRW V,V,E":
+		return withValue(0xD000|vxy, 2, 4)
+	case "SKP V":
+		return word(0xE09E | vx)
+	case "SKNP V":
+		return word(0xE0A1 | vx)
+	case "LD I,LONG":
+		addr, err := value(1, 16)
+		if err != nil {
+			return nil, err
+		}
+		return []byte{0xF0, 0x00, byte(addr >> 8), byte(addr)}, nil
+	case "PLANE E":
+		mask, err := value(0, 4)
+		if err != nil {
+			return nil, err
+		}
+		return word(0xF001 | mask<<8)
+	case "AUDIO":
+		return word(0xF002)
+	case "LD V,DT":
+		return word(0xF007 | vx)
+	case "LD V,K":
+		return word(0xF00A | vx)
+	case "LD DT,V":
+		return word(0xF015 | y<<8)
+	case "LD ST,V":
+		return word(0xF018 | y<<8)
+	case "ADD I,V":
+		return word(0xF01E | y<<8)
+	case "LD F,V":
+		return word(0xF029 | y<<8)
+	case "LD HF,V":
+		return word(0xF030 | y<<8)
+	case "LD B,V":
+		return word(0xF033 | y<<8)
+	case "PITCH V":
+		return word(0xF03A | vx)
+	case "LD [I],V":
+		return word(0xF055 | y<<8)
+	case "LD V,[I]":
+		return word(0xF065 | vx)
+	case "LD R,V":
+		return word(0xF075 | y<<8)
+	case "LD V,R":
+		return word(0xF085 | vx)
+	default:
+		return nil, fmt.Errorf("invalid instruction %s", sig)
+	}
+}
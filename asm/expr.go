@@ -0,0 +1,141 @@
+package asm
+
+import (
+	"fmt"
+)
+
+// expr is an unevaluated expression, expressions are kept as tokens until the second pass so they can refer to
+// labels defined later in the source
+type expr []token
+
+// evaluator resolves the names in an expression
+type evaluator interface {
+	lookup(name string) (int, error)
+}
+
+// eval evaluates an expression, here is the value of $
+func (e expr) eval(ev evaluator, here int) (int, error) {
+	p := &exprParser{tokens: e, ev: ev, here: here}
+	value, err := p.parseBinary(0)
+	if err != nil {
+		return 0, err
+	}
+	if p.pos != len(p.tokens) {
+		return 0, fmt.Errorf("unexpected %q in expression", p.tokens[p.pos].text)
+	}
+	return value, nil
+}
+
+// binaryPrecedence of each operator, higher binds tighter
+var binaryPrecedence = map[string]int{
+	"|":  1,
+	"^":  2,
+	"&":  3,
+	"<<": 4,
+	">>": 4,
+	"+":  5,
+	"-":  5,
+	"*":  6,
+	"/":  6,
+	"%":  6,
+}
+
+type exprParser struct {
+	tokens expr
+	pos    int
+	ev     evaluator
+	here   int
+}
+
+func (p *exprParser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// parseBinary parses operators of at least minPrecedence using precedence climbing
+func (p *exprParser) parseBinary(minPrecedence int) (int, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		tok, ok := p.peek()
+		precedence, isOp := binaryPrecedence[tok.text]
+		if !ok || tok.kind != tokPunct || !isOp || precedence < minPrecedence {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseBinary(precedence + 1)
+		if err != nil {
+			return 0, err
+		}
+
+		switch tok.text {
+		case "|":
+			left |= right
+		case "^":
+			left ^= right
+		case "&":
+			left &= right
+		case "<<":
+			left <<= uint(right)
+		case ">>":
+			left >>= uint(right)
+		case "+":
+			left += right
+		case "-":
+			left -= right
+		case "*":
+			left *= right
+		case "/", "%":
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			if tok.text == "/" {
+				left /= right
+			} else {
+				left %= right
+			}
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (int, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return 0, fmt.Errorf("expected an expression")
+	}
+	p.pos++
+
+	switch {
+	case tok.kind == tokNumber:
+		return tok.value, nil
+	case tok.kind == tokIdent:
+		return p.ev.lookup(tok.text)
+	case tok.text == "$":
+		return p.here, nil
+	case tok.text == "-":
+		value, err := p.parseUnary()
+		return -value, err
+	case tok.text == "+":
+		return p.parseUnary()
+	case tok.text == "~":
+		value, err := p.parseUnary()
+		return ^value, err
+	case tok.text == "(":
+		value, err := p.parseBinary(0)
+		if err != nil {
+			return 0, err
+		}
+		if closing, ok := p.peek(); !ok || closing.text != ")" {
+			return 0, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return value, nil
+	}
+	return 0, fmt.Errorf("unexpected %q in expression", tok.text)
+}
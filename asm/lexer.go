@@ -0,0 +1,124 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenKind identifies the type of a token
+type tokenKind int
+
+const (
+	tokIdent  tokenKind = iota // Labels, mnemonics, registers and directives
+	tokNumber                  // Numbers in decimal, hex (0x or #), binary (0b) or character literals
+	tokString                  // Double quoted strings
+	tokPunct                   // Operators and punctuation
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value int // Numeric value of tokNumber
+}
+
+// lex splits a line into tokens, anything after a ; is a comment
+func lex(line string) ([]token, error) {
+	var tokens []token
+	r := []rune(line)
+
+	for n := 0; n < len(r); {
+		c := r[n]
+		switch {
+		case c == ';':
+			return tokens, nil
+		case unicode.IsSpace(c):
+			n++
+		case isIdentStart(c):
+			start := n
+			for n < len(r) && isIdentPart(r[n]) {
+				n++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(r[start:n])})
+		case unicode.IsDigit(c) || (c == '#' && n+1 < len(r) && isHexDigit(r[n+1])):
+			start := n
+			n++
+			for n < len(r) && (unicode.IsLetter(r[n]) || unicode.IsDigit(r[n]) || r[n] == '_') {
+				n++
+			}
+			text := string(r[start:n])
+			value, err := parseNumber(text)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text, value: value})
+		case c == '\'':
+			if n+2 >= len(r) || r[n+2] != '\'' {
+				return nil, fmt.Errorf("unterminated character literal")
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(r[n : n+3]), value: int(r[n+1])})
+			n += 3
+		case c == '"':
+			end := n + 1
+			for end < len(r) && r[end] != '"' {
+				end++
+			}
+			if end >= len(r) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, token{kind: tokString, text: string(r[n+1 : end])})
+			n = end + 1
+		case (c == '<' || c == '>') && n+1 < len(r) && r[n+1] == c:
+			tokens = append(tokens, token{kind: tokPunct, text: string(r[n : n+2])})
+			n += 2
+		case strings.ContainsRune(",:[]()+-*/%&|^~=$", c):
+			tokens = append(tokens, token{kind: tokPunct, text: string(c)})
+			n++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentStart(c rune) bool {
+	return unicode.IsLetter(c) || c == '_' || c == '.'
+}
+
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || unicode.IsDigit(c)
+}
+
+func isHexDigit(c rune) bool {
+	return strings.ContainsRune("0123456789abcdefABCDEF", c)
+}
+
+// parseNumber parses decimal, 0x or # prefixed hex, and 0b prefixed binary numbers
+func parseNumber(text string) (int, error) {
+	base := 10
+	digits := strings.ReplaceAll(text, "_", "")
+	switch {
+	case strings.HasPrefix(digits, "#"):
+		base, digits = 16, digits[1:]
+	case strings.HasPrefix(strings.ToLower(digits), "0x"):
+		base, digits = 16, digits[2:]
+	case strings.HasPrefix(strings.ToLower(digits), "0b"):
+		base, digits = 2, digits[2:]
+	}
+	if digits == "" {
+		return 0, fmt.Errorf("invalid number %q", text)
+	}
+
+	value := 0
+	for _, c := range strings.ToLower(digits) {
+		d := strings.IndexRune("0123456789abcdef", c)
+		if d < 0 || d >= base {
+			return 0, fmt.Errorf("invalid number %q", text)
+		}
+		value = value*base + d
+		if value > 0xFFFFFF {
+			return 0, fmt.Errorf("number %q is too large", text)
+		}
+	}
+	return value, nil
+}
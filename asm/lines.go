@@ -0,0 +1,48 @@
+package asm
+
+import (
+	"path/filepath"
+)
+
+// Line records the code generated from a line of source, so debuggers can map between addresses and source
+type Line struct {
+	Addr uint16
+	Size int
+	File string
+	Line int
+}
+
+// LineAt returns the line of source that generated the code at addr
+func (o *Output) LineAt(addr uint16) (Line, bool) {
+	for _, l := range o.Lines {
+		if addr >= l.Addr && int(addr) < int(l.Addr)+l.Size {
+			return l, true
+		}
+	}
+	return Line{}, false
+}
+
+// AddrOf returns the first line of code at or after line in file, for placing breakpoints on lines that generate
+// no code such as comments and labels. Files match if they are the same path, or failing that the same file name
+func (o *Output) AddrOf(file string, line int) (Line, bool) {
+	var best Line
+	found := false
+	for _, l := range o.Lines {
+		if !sameFile(l.File, file) || l.Line < line {
+			continue
+		}
+		if !found || l.Line < best.Line || (l.Line == best.Line && l.Addr < best.Addr) {
+			best, found = l, true
+		}
+	}
+	return best, found
+}
+
+func sameFile(a, b string) bool {
+	if absA, err := filepath.Abs(a); err == nil {
+		if absB, err := filepath.Abs(b); err == nil && absA == absB {
+			return true
+		}
+	}
+	return filepath.Base(a) == filepath.Base(b)
+}
@@ -0,0 +1,95 @@
+package audio
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func Test_bufferOverflow(t *testing.T) {
+	b := NewBuffer(4)
+	b.WriteSamples([]float32{1, 2, 3})
+	b.WriteSamples([]float32{4, 5, 6})
+	if b.Len() != 4 {
+		t.Fatalf("buffer should hold 4 samples, held %d\n", b.Len())
+	}
+
+	out := make([]float32, 6)
+	if n := b.Read(out); n != 4 {
+		t.Fatalf("should read the 4 queued samples, read %d\n", n)
+	}
+	for i, want := range []float32{3, 4, 5, 6} {
+		if out[i] != want {
+			t.Fatalf("the oldest samples should be dropped, read %v\n", out)
+		}
+	}
+	if out[4] >= 6 || out[5] >= out[4] || out[5] <= 0 {
+		t.Fatalf("running dry should fade out from the last sample, read %v\n", out)
+	}
+}
+
+func Test_bufferConcurrent(t *testing.T) {
+	b := NewBuffer(1000)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		frame := make([]float32, 735)
+		for i := 0; i < 100; i++ {
+			b.WriteSamples(frame)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		out := make([]float32, 512)
+		for i := 0; i < 100; i++ {
+			b.Read(out)
+		}
+	}()
+	wg.Wait()
+}
+
+func Test_wavWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("could not create WAV: %v\n", err)
+	}
+	wav, err := NewWAVWriter(f, 8000)
+	if err != nil {
+		t.Fatalf("could not start WAV: %v\n", err)
+	}
+	wav.WriteSamples([]float32{0, 1, -1})
+	wav.WriteSamples([]float32{2, 0.5})
+	if err := wav.Close(); err != nil {
+		t.Fatalf("could not finish WAV: %v\n", err)
+	}
+	f.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read WAV: %v\n", err)
+	}
+	if len(data) != wavHeaderSize+10 {
+		t.Fatalf("WAV should be the header and 5 samples, was %d bytes\n", len(data))
+	}
+	if string(data[0:4]) != "RIFF" || string(data[8:16]) != "WAVEfmt " || string(data[36:40]) != "data" {
+		t.Fatalf("WAV header is malformed: %q\n", data[:wavHeaderSize])
+	}
+	if size := binary.LittleEndian.Uint32(data[4:]); size != 36+10 {
+		t.Fatalf("RIFF size should be 46, was %d\n", size)
+	}
+	if rate := binary.LittleEndian.Uint32(data[24:]); rate != 8000 {
+		t.Fatalf("sample rate should be 8000, was %d\n", rate)
+	}
+	if size := binary.LittleEndian.Uint32(data[40:]); size != 10 {
+		t.Fatalf("data size should be 10, was %d\n", size)
+	}
+	for i, want := range []int16{0, 32767, -32767, 32767, 16384} {
+		if got := int16(binary.LittleEndian.Uint16(data[wavHeaderSize+2*i:])); got != want {
+			t.Fatalf("sample %d should be %d, was %d\n", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Package audio has sinks for the sound a CPU makes: a buffer for frontends whose audio runs on its own thread, and a
+// WAV file writer for headless runs
+package audio
+
+import "sync"
+
+// Buffer queues samples from the CPU for an audio thread to read. The CPU writes a frame at a time while the audio
+// thread reads whatever it needs, so the buffer holds at most a fixed number of samples and drops the oldest when it
+// overflows rather than letting the sound fall further and further behind the picture
+type Buffer struct {
+	mu      sync.Mutex
+	samples []float32 // Ring of queued samples
+	start   int       // Index of the oldest sample
+	n       int       // Number of samples queued
+	last    float32   // Last sample read, repeated if the buffer runs dry
+}
+
+// NewBuffer creates a buffer that holds up to size samples
+func NewBuffer(size int) *Buffer {
+	return &Buffer{samples: make([]float32, size)}
+}
+
+// WriteSamples queues samples, it is safe to call while another goroutine reads
+func (b *Buffer) WriteSamples(samples []float32) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(samples) > len(b.samples) {
+		samples = samples[len(samples)-len(b.samples):]
+	}
+	if overflow := b.n + len(samples) - len(b.samples); overflow > 0 {
+		b.start = (b.start + overflow) % len(b.samples)
+		b.n -= overflow
+	}
+	for _, s := range samples {
+		b.samples[(b.start+b.n)%len(b.samples)] = s
+		b.n++
+	}
+	return nil
+}
+
+// Read fills out with queued samples. When the buffer runs dry the rest of out fades from the last sample to silence,
+// which clicks less than stopping dead. It returns the number of samples that were queued
+func (b *Buffer) Read(out []float32) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	read := min(len(out), b.n)
+	for i := 0; i < read; i++ {
+		out[i] = b.samples[(b.start+i)%len(b.samples)]
+	}
+	b.start = (b.start + read) % len(b.samples)
+	b.n -= read
+	if read > 0 {
+		b.last = out[read-1]
+	}
+
+	for i := read; i < len(out); i++ {
+		b.last *= 0.9
+		out[i] = b.last
+	}
+	return read
+}
+
+// Len returns the number of samples queued
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.n
+}
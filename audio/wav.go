@@ -0,0 +1,85 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// wavHeaderSize is the size of the RIFF header written before the samples
+const wavHeaderSize = 44
+
+// WAVWriter writes samples to a 16-bit mono PCM WAV file. The sizes in the header are only known once every sample
+// has been written, so Close seeks back to fill them in
+type WAVWriter struct {
+	w          io.WriteSeeker
+	sampleRate int
+	samples    int
+	buf        []byte
+	err        error // The first error, later writes are dropped
+}
+
+// NewWAVWriter starts a WAV file at sampleRate on w
+func NewWAVWriter(w io.WriteSeeker, sampleRate int) (*WAVWriter, error) {
+	wav := &WAVWriter{w: w, sampleRate: sampleRate}
+	if err := wav.writeHeader(); err != nil {
+		return nil, err
+	}
+	return wav, nil
+}
+
+func (w *WAVWriter) writeHeader() error {
+	dataSize := uint32(w.samples * 2)
+	header := make([]byte, 0, wavHeaderSize)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, wavHeaderSize-8+dataSize)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)                     // Size of the format chunk
+	header = binary.LittleEndian.AppendUint16(header, 1)                      // PCM
+	header = binary.LittleEndian.AppendUint16(header, 1)                      // Channels
+	header = binary.LittleEndian.AppendUint32(header, uint32(w.sampleRate))   // Sample rate
+	header = binary.LittleEndian.AppendUint32(header, uint32(w.sampleRate*2)) // Bytes per second
+	header = binary.LittleEndian.AppendUint16(header, 2)                      // Bytes per sample
+	header = binary.LittleEndian.AppendUint16(header, 16)                     // Bits per sample
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, dataSize)
+	_, err := w.w.Write(header)
+	return err
+}
+
+// WriteSamples appends samples to the file, clipping them to -1 to 1
+func (w *WAVWriter) WriteSamples(samples []float32) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.buf = w.buf[:0]
+	for _, s := range samples {
+		s = max(-1, min(1, s))
+		w.buf = binary.LittleEndian.AppendUint16(w.buf, uint16(int16(math.Round(float64(s)*math.MaxInt16))))
+	}
+	if _, err := w.w.Write(w.buf); err != nil {
+		w.err = err
+		return err
+	}
+	w.samples += len(samples)
+	return nil
+}
+
+// Close fills in the header, it does not close the underlying writer
+func (w *WAVWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if _, err := w.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	if _, err := w.w.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	w.err = errors.New("WAV writer is closed")
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pthm/gate/conformance"
+	"github.com/pthm/gate/cpu"
+	"os"
+	"strings"
+)
+
+// conformanceCommand runs the bundled test ROMs headless against each quirks profile and prints a pass/fail matrix
+func conformanceCommand(args []string) error {
+	flags := flag.NewFlagSet("conformance", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gate conformance [flags]")
+		flags.PrintDefaults()
+	}
+	profileNames := flags.String("quirks", strings.Join(cpu.QuirkPresetNames(), ","), "comma separated quirks profiles to test")
+
+	flags.Parse(args)
+	profiles := strings.Split(*profileNames, ",")
+
+	results, err := conformance.RunAll(profiles)
+	if err != nil {
+		return err
+	}
+	conformance.WriteMatrix(os.Stdout, results, profiles)
+
+	failed := map[string]bool{}
+	for _, result := range results {
+		if !result.Pass() {
+			failed[result.Test] = true
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d test ROMs failed", len(failed), len(conformance.Tests))
+	}
+	return nil
+}
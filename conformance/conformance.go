@@ -0,0 +1,208 @@
+// Package conformance runs a suite of self-checking test ROMs headless against each quirks profile. The ROMs are
+// assembled from the sources in roms, each ends by showing a result code on screen, which is read back by hashing
+// the display and looking the hash up among the screens every code draws
+package conformance
+
+import (
+	"crypto/sha1"
+	"embed"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pthm/gate/asm"
+	"github.com/pthm/gate/cpu"
+	"github.com/pthm/gate/headless"
+)
+
+//go:embed roms/*.asm
+var roms embed.FS
+
+// frames is how long each test runs for, long enough for the slowest to show its result
+const frames = 120
+
+// Test is a test ROM
+type Test struct {
+	Name        string
+	Description string
+	Script      headless.Script               // Keys pressed while the test runs
+	Expect      func(quirks cpu.Quirks) uint8 // The result a correct interpreter shows, nil when it is 00
+}
+
+// Tests is the suite, in the order they run
+var Tests = []Test{
+	{Name: "flags", Description: "VF after arithmetic, including when VF is the destination"},
+	{Name: "opcodes", Description: "Instructions the quirks don't affect"},
+	{
+		Name:        "keypad",
+		Description: "EX9E, EXA1 and FX0A",
+		Script: headless.Script{
+			{Frame: 10, Key: 0x5, Down: true},
+			{Frame: 15, Key: 0x5, Down: false},
+			{Frame: 30, Key: 0x7, Down: true},
+		},
+	},
+	{Name: "quirks", Description: "Each quirk matches the profile", Expect: quirkBits},
+}
+
+// quirkBits is the bitmask quirks.asm shows for a profile
+func quirkBits(quirks cpu.Quirks) uint8 {
+	bits := uint8(0)
+	for n, on := range []bool{
+		quirks.ShiftVY,
+		quirks.LoadStoreIncI,
+		quirks.JumpVX,
+		quirks.LogicResetsVF,
+		quirks.ClipSprites,
+		quirks.DisplayWait,
+	} {
+		if on {
+			bits |= 1 << n
+		}
+	}
+	return bits
+}
+
+// assemble assembles a test's source with the result routine appended
+func assemble(name string, src []byte) ([]byte, error) {
+	result, err := roms.ReadFile("roms/result.asm")
+	if err != nil {
+		return nil, err
+	}
+	out, err := asm.Assemble(name, append(append(src, '\n'), result...))
+	if err != nil {
+		return nil, err
+	}
+	return out.Binary, nil
+}
+
+// ROM assembles the test's ROM
+func (t Test) ROM() ([]byte, error) {
+	src, err := roms.ReadFile("roms/" + t.Name + ".asm")
+	if err != nil {
+		return nil, err
+	}
+	return assemble(t.Name+".asm", src)
+}
+
+// Run runs the test on a machine with quirks, returning the result it shows or -1 if the screen doesn't show one
+func (t Test) Run(quirks cpu.Quirks) (int, error) {
+	rom, err := t.ROM()
+	if err != nil {
+		return 0, err
+	}
+	chip8 := cpu.NewCPU(quirks)
+	if err := chip8.LoadROM(rom); err != nil {
+		return 0, err
+	}
+	return readResult(headless.Run(chip8, frames, t.Script))
+}
+
+var (
+	screensOnce sync.Once
+	screens     map[[sha1.Size]byte]uint8 // The hash of the screen showing each result
+	screensErr  error
+)
+
+// readResult looks up the result a screen shows
+func readResult(frame cpu.Frame) (int, error) {
+	screensOnce.Do(func() {
+		screens = map[[sha1.Size]byte]uint8{}
+		for code := 0; code <= 0xFF; code++ {
+			rom, err := assemble("show.asm", []byte(fmt.Sprintf("LD V0, %d\nJP show\n", code)))
+			if err != nil {
+				screensErr = err
+				return
+			}
+			chip8 := cpu.NewCPU(cpu.QuirksVIP)
+			chip8.LoadROM(rom)
+			screens[sha1.Sum([]byte(headless.Run(chip8, 10, nil).Text()))] = uint8(code)
+		}
+	})
+	if screensErr != nil {
+		return 0, screensErr
+	}
+
+	code, ok := screens[sha1.Sum([]byte(frame.Text()))]
+	if !ok {
+		return -1, nil
+	}
+	return int(code), nil
+}
+
+// Result is the outcome of a test on a quirks profile
+type Result struct {
+	Test     string
+	Profile  string
+	Expected uint8
+	Shown    int // -1 when the screen doesn't show a result
+}
+
+// Pass reports whether the test showed the expected result
+func (r Result) Pass() bool {
+	return r.Shown == int(r.Expected)
+}
+
+func (r Result) String() string {
+	switch {
+	case r.Pass():
+		return "pass"
+	case r.Shown < 0:
+		return "FAIL no result"
+	case r.Expected == 0:
+		return fmt.Sprintf("FAIL check %d", r.Shown)
+	}
+	return fmt.Sprintf("FAIL %02X, want %02X", r.Shown, r.Expected)
+}
+
+// Check runs the test on the named quirks profile and compares the result with what it expects
+func (t Test) Check(profile string) (Result, error) {
+	quirks, err := cpu.ParseQuirks(profile)
+	if err != nil {
+		return Result{}, err
+	}
+	shown, err := t.Run(quirks)
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: %w", t.Name, err)
+	}
+
+	result := Result{Test: t.Name, Profile: profile, Shown: shown}
+	if t.Expect != nil {
+		result.Expected = t.Expect(quirks)
+	}
+	return result, nil
+}
+
+// RunAll runs every test against each of the named quirks profiles, returning the results by test then profile
+func RunAll(profiles []string) ([]Result, error) {
+	var results []Result
+	for _, test := range Tests {
+		for _, profile := range profiles {
+			result, err := test.Check(profile)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// WriteMatrix writes results from RunAll as a table with a row per test and a column per profile
+func WriteMatrix(w io.Writer, results []Result, profiles []string) {
+	const width = 18
+	row := fmt.Sprintf("%-10s", "")
+	for _, profile := range profiles {
+		row += fmt.Sprintf("%-*s", width, profile)
+	}
+	fmt.Fprintln(w, strings.TrimRight(row, " "))
+
+	for n := 0; n < len(results); n += len(profiles) {
+		row = fmt.Sprintf("%-10s", results[n].Test)
+		for _, result := range results[n:min(n+len(profiles), len(results))] {
+			row += fmt.Sprintf("%-*s", width, result)
+		}
+		fmt.Fprintln(w, strings.TrimRight(row, " "))
+	}
+}
@@ -0,0 +1,53 @@
+package conformance
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pthm/gate/cpu"
+)
+
+func Test_conformance(t *testing.T) {
+	for _, test := range Tests {
+		for _, profile := range cpu.QuirkPresetNames() {
+			t.Run(test.Name+"/"+profile, func(t *testing.T) {
+				result, err := test.Check(profile)
+				if err != nil {
+					t.Fatalf("unexpected error: %v\n", err)
+				}
+				if !result.Pass() {
+					t.Fatalf("%s\n", result)
+				}
+			})
+		}
+	}
+}
+
+func Test_quirksDetected(t *testing.T) {
+	// Running the quirks test on the wrong profile should show the bits that differ
+	shown, err := Tests[3].Run(cpu.QuirksSCHIP)
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	result := Result{Test: "quirks", Shown: shown, Expected: quirkBits(cpu.QuirksVIP)}
+	if result.Pass() || result.String() != "FAIL 14, want 3B" {
+		t.Fatalf("SCHIP quirks should not pass as VIP, got %s\n", result)
+	}
+}
+
+func Test_writeMatrix(t *testing.T) {
+	results := []Result{
+		{Test: "flags", Profile: "vip"},
+		{Test: "flags", Profile: "schip", Shown: 4},
+		{Test: "keypad", Profile: "vip", Shown: -1},
+		{Test: "keypad", Profile: "schip"},
+	}
+	var buf bytes.Buffer
+	WriteMatrix(&buf, results, []string{"vip", "schip"})
+
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.Contains(lines[1], "pass") || !strings.Contains(lines[1], "FAIL check 4") || !strings.Contains(lines[2], "FAIL no result") {
+		t.Fatalf("unexpected matrix\n%s", buf.String())
+	}
+}
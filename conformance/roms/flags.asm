@@ -0,0 +1,116 @@
+; Checks the flags the arithmetic instructions set in VF, including when VF is also the destination. Shows the
+; number of the first check that fails, or 00 when they all pass. VE holds the number of the check running
+
+	LD VE, 1            ; 8XY4 without a carry
+	LD V1, 200
+	LD V2, 50
+	ADD V1, V2
+	SE V1, 250
+	JP fail
+	SE VF, 0
+	JP fail
+
+	LD VE, 2            ; 8XY4 with a carry
+	LD V1, 200
+	LD V2, 100
+	ADD V1, V2
+	SE V1, 44
+	JP fail
+	SE VF, 1
+	JP fail
+
+	LD VE, 3            ; 8XY5 without a borrow
+	LD V1, 100
+	LD V2, 40
+	SUB V1, V2
+	SE V1, 60
+	JP fail
+	SE VF, 1
+	JP fail
+
+	LD VE, 4            ; 8XY5 with a borrow
+	LD V1, 40
+	LD V2, 100
+	SUB V1, V2
+	SE V1, 196
+	JP fail
+	SE VF, 0
+	JP fail
+
+	LD VE, 5            ; 8XY7 without a borrow
+	LD V1, 40
+	LD V2, 100
+	SUBN V1, V2
+	SE V1, 60
+	JP fail
+	SE VF, 1
+	JP fail
+
+	LD VE, 6            ; 8XY7 with a borrow
+	LD V1, 100
+	LD V2, 40
+	SUBN V1, V2
+	SE V1, 196
+	JP fail
+	SE VF, 0
+	JP fail
+
+	LD VE, 7            ; 8XY6 shifts the low bit into VF. VX and VY are equal so both shift quirks agree
+	LD V1, 0x81
+	LD V2, 0x81
+	SHR V1, V2
+	SE V1, 0x40
+	JP fail
+	SE VF, 1
+	JP fail
+
+	LD VE, 8            ; 8XYE shifts the high bit into VF
+	LD V1, 0x41
+	LD V2, 0x41
+	SHL V1, V2
+	SE V1, 0x82
+	JP fail
+	SE VF, 0
+	JP fail
+
+	LD VE, 9            ; The flag wins over the result when VF is the destination of 8XY4
+	LD VF, 255
+	LD V1, 2
+	ADD VF, V1
+	SE VF, 1
+	JP fail
+
+	LD VE, 10           ; and of 8XY5
+	LD VF, 1
+	LD V1, 2
+	SUB VF, V1
+	SE VF, 0
+	JP fail
+
+	LD VE, 11           ; and of 8XY6
+	LD VF, 2
+	SHR VF
+	SE VF, 0
+	JP fail
+
+	LD VE, 12           ; and of 8XYE
+	LD VF, 0x40
+	SHL VF
+	SE VF, 0
+	JP fail
+
+	LD VE, 13           ; 7XNN leaves VF alone when it overflows
+	LD VF, 7
+	LD V1, 255
+	ADD V1, 2
+	SE V1, 1
+	JP fail
+	SE VF, 7
+	JP fail
+
+	LD V0, 0
+	JP show
+
+fail:
+	LD V0, VE
+	JP show
@@ -0,0 +1,38 @@
+; Checks the keypad instructions, driven by the script in conformance.go: 5 is pressed on frame 10 and released on
+; frame 15, then 7 is held down from frame 30. Shows the number of the first check that fails, or 00 when they all
+; pass. VE holds the number of the check running
+
+	LD VE, 1            ; EXA1 skips when the key is up
+	LD V1, 5
+	SKNP V1
+	JP fail
+
+	LD VE, 2            ; EX9E doesn't skip when the key is up
+	SKP V1
+	JP up
+	JP fail
+up:
+
+	LD VE, 3            ; FX0A waits for 5 to be pressed and released
+	LD V2, K
+	SE V2, 5
+	JP fail
+
+	LD VE, 4            ; EX9E skips once 7 is held down, the screen stays blank if it never does
+	LD V1, 7
+held:
+	SKP V1
+	JP held
+
+	LD VE, 5            ; EXA1 doesn't skip while the key is held down
+	SKNP V1
+	JP pass
+	JP fail
+
+pass:
+	LD V0, 0
+	JP show
+
+fail:
+	LD V0, VE
+	JP show
@@ -0,0 +1,151 @@
+; Checks the behaviour of the CHIP-8 instructions the quirks don't affect. Shows the number of the first check that
+; fails, or 00 when they all pass. VE holds the number of the check running
+
+	JP start
+
+; BNNN jumps here, the jump has to be in the first page for BXNN to jump with V2
+jumps:
+	JP fail
+	JP fail
+	JP jumped
+
+start:
+	LD VE, 1            ; 3XNN skips when equal
+	LD V1, 5
+	SE V1, 5
+	JP fail
+
+	LD VE, 2            ; 3XNN doesn't skip when different
+	SE V1, 6
+	JP different
+	JP fail
+different:
+
+	LD VE, 3            ; 4XNN skips when different
+	SNE V1, 6
+	JP fail
+
+	LD VE, 4            ; 5XY0 skips when equal
+	LD V2, 5
+	SE V1, V2
+	JP fail
+
+	LD VE, 5            ; 9XY0 skips when different
+	LD V2, 6
+	SNE V1, V2
+	JP fail
+
+	LD VE, 6            ; 8XY0 to 8XY3, VF is left to the quirks test
+	LD V1, 0x3C
+	LD V2, 0x0F
+	LD V3, V1
+	OR V3, V2
+	SE V3, 0x3F
+	JP fail
+	LD V3, V1
+	AND V3, V2
+	SE V3, 0x0C
+	JP fail
+	LD V3, V1
+	XOR V3, V2
+	SE V3, 0x33
+	JP fail
+
+	LD VE, 7            ; 2NNN and 00EE
+	LD V1, 0
+	CALL increment
+	CALL increment
+	SE V1, 2
+	JP fail
+
+	LD VE, 8            ; FX1E adds to I
+	LD I, data
+	LD V1, 2
+	ADD I, V1
+	LD V0, [I]
+	SE V0, 0x33
+	JP fail
+
+	LD VE, 9            ; FX33 stores BCD, I is set before every load and store as the quirks decide whether they move it
+	LD I, scratch
+	LD V1, 247
+	LD B, V1
+	LD I, scratch
+	LD V2, [I]
+	SE V0, 2
+	JP fail
+	SE V1, 4
+	JP fail
+	SE V2, 7
+	JP fail
+
+	LD VE, 10           ; FX55 and FX65 store and load up to VX
+	LD V0, 11
+	LD V1, 22
+	LD V2, 33
+	LD I, scratch
+	LD [I], V2
+	LD V0, 0
+	LD V1, 0
+	LD V2, 0
+	LD I, scratch
+	LD V1, [I]
+	SE V0, 11
+	JP fail
+	SE V1, 22
+	JP fail
+	SE V2, 0
+	JP fail
+
+	LD VE, 11           ; FX29 points I at the font sprite for a digit
+	LD V1, 1
+	LD F, V1
+	LD V0, [I]
+	SE V0, 0x20
+	JP fail
+
+	LD VE, 12           ; BNNN, V0 and V2 are equal so both jump quirks agree
+	LD V0, 4
+	LD V2, 4
+	JP V0, jumps
+jumped:
+
+	LD VE, 13           ; FX15 and FX07, the delay timer counts down to zero
+	LD V1, 3
+	LD DT, V1
+wait:
+	LD V1, DT
+	SE V1, 0
+	JP wait
+
+	LD VE, 14           ; CXNN masks the random number
+	RND V1, 0
+	SE V1, 0
+	JP fail
+
+	LD VE, 15           ; DXYN sets VF when it erases a pixel
+	CLS
+	LD I, data
+	LD V1, 0
+	DRW V1, V1, 1
+	SE VF, 0
+	JP fail
+	DRW V1, V1, 1
+	SE VF, 1
+	JP fail
+
+	LD V0, 0
+	JP show
+
+fail:
+	LD V0, VE
+	JP show
+
+increment:
+	ADD V1, 1
+	RET
+
+data:
+	DB 0x11, 0x22, 0x33
+scratch:
+	DB 0, 0, 0
@@ -0,0 +1,92 @@
+; Detects the quirks of the interpreter and shows them as a bitmask, there's no right answer so the runner compares
+; it against the quirks profile. VD holds the bitmask:
+;   01 8XY6 shifts VY
+;   02 FX55 and FX65 move I
+;   04 BNNN jumps with VX
+;   08 8XY1 to 8XY3 reset VF
+;   10 DXYN clips sprites
+;   20 DXYN waits for the vertical blank
+
+	JP start
+
+; BNNN jumps here, the jump has to be in the first page for BXNN to jump with V2
+jumps:
+	JP logic
+	JP jumpVX
+
+start:
+	LD VD, 0
+
+	LD V1, 0
+	LD V2, 4
+	SHR V1, V2
+	SE V1, 2
+	JP loadStore
+	ADD VD, 0x01
+
+loadStore:
+	LD I, scratch
+	LD V0, 0
+	LD [I], V0
+	LD V0, 0x5A
+	LD [I], V0
+	LD I, scratch
+	LD V1, [I]
+	SE V1, 0x5A
+	JP jump
+	ADD VD, 0x02
+
+jump:
+	LD V0, 0
+	LD V2, 2
+	JP V0, jumps
+jumpVX:
+	ADD VD, 0x04
+
+logic:
+	LD VF, 1
+	LD V1, 0
+	OR V1, V1
+	SE VF, 0
+	JP clip
+	ADD VD, 0x08
+
+clip:
+	CLS                 ; Draw across the right edge, then see whether it wrapped round onto the left
+	LD I, row
+	LD V1, 60
+	LD V2, 0
+	DRW V1, V2, 1
+	LD I, dot
+	DRW V2, V2, 1
+	SE VF, 0
+	JP displayWait
+	ADD VD, 0x10
+
+displayWait:
+	LD V1, 60           ; 30 draws take 30 frames when each waits, and only a few when they don't
+	LD DT, V1
+	LD V3, 30
+	LD I, dot
+draw:
+	DRW V2, V2, 1
+	ADD V3, 255
+	SE V3, 0
+	JP draw
+	LD V1, DT
+	LD V4, 40
+	SUB V1, V4
+	SE VF, 0
+	JP done
+	ADD VD, 0x20
+
+done:
+	LD V0, VD
+	JP show
+
+row:
+	DB 0xFF
+dot:
+	DB 0x80
+scratch:
+	DB 0, 0
@@ -0,0 +1,20 @@
+; show clears the screen and displays V0 as two hex digits in the middle of it, then stops. Every test ends here
+; and the runner reads the result back off the screen. It is appended to each test when it is assembled
+show:
+	LD V1, V0
+	SHR V1
+	SHR V1
+	SHR V1
+	SHR V1
+	LD V2, 0x0F
+	AND V2, V0
+	CLS
+	LD V3, 26
+	LD V4, 13
+	LD F, V1
+	DRW V3, V4, 5
+	ADD V3, 6
+	LD F, V2
+	DRW V3, V4, 5
+stop:
+	JP stop
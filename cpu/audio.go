@@ -0,0 +1,199 @@
+package cpu
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// AudioSink receives the sound the machine makes as mono samples between -1 and 1, a frame's worth at a time. It is
+// called with cpu.mu held, so it should hand the samples off rather than block
+type AudioSink interface {
+	WriteSamples(samples []float32) error
+}
+
+// Waveform is the shape of the buzzer's tone
+type Waveform int
+
+const (
+	Square Waveform = iota
+	Sine
+	Triangle
+	Sawtooth
+)
+
+var waveformNames = [...]string{
+	Square:   "square",
+	Sine:     "sine",
+	Triangle: "triangle",
+	Sawtooth: "sawtooth",
+}
+
+func (w Waveform) String() string {
+	if w < 0 || int(w) >= len(waveformNames) {
+		return fmt.Sprintf("Waveform(%d)", int(w))
+	}
+	return waveformNames[w]
+}
+
+// ParseWaveform looks up a waveform by name
+func ParseWaveform(name string) (Waveform, error) {
+	for w, n := range waveformNames {
+		if strings.EqualFold(name, n) {
+			return Waveform(w), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown waveform %q, must be one of: %s", name, strings.Join(waveformNames[:], ", "))
+}
+
+// sample returns the waveform at phase, which runs from 0 to 1 over a cycle
+func (w Waveform) sample(phase float64) float64 {
+	switch w {
+	case Sine:
+		return math.Sin(2 * math.Pi * phase)
+	case Triangle:
+		return 1 - 4*math.Abs(phase-0.5)
+	case Sawtooth:
+		return 2*phase - 1
+	default:
+		if phase < 0.5 {
+			return 1
+		}
+		return -1
+	}
+}
+
+// Tone is the sound the buzzer makes while the sound timer is non-zero
+type Tone struct {
+	Waveform  Waveform
+	Frequency float64 // Hz
+	Volume    float64 // 0 is silent, 1 is full scale, XO-CHIP patterns play at the same volume
+}
+
+// DefaultTone is a quiet square wave, close to the VIP's buzzer
+var DefaultTone = Tone{Waveform: Square, Frequency: 440, Volume: 0.25}
+
+// WithTone sets the sound the buzzer makes
+func WithTone(tone Tone) Option {
+	return func(cpu *CPU) {
+		cpu.audio.tone = tone
+	}
+}
+
+// defaultPitch is the XO-CHIP pitch register's initial value, which plays the pattern at 4000 samples per second
+const defaultPitch = 64
+
+// patternRate returns the rate the XO-CHIP audio pattern plays at, in pattern samples per second
+func patternRate(pitch uint8) float64 {
+	return 4000 * math.Exp2((float64(pitch)-64)/48)
+}
+
+// patternBits is the length of the XO-CHIP audio pattern
+const patternBits = 128
+
+// audio generates the samples for each frame and sends them to the sink
+type audio struct {
+	sink       AudioSink
+	sampleRate int
+	tone       Tone
+	phase      float64   // Position in the tone's cycle, so it carries on smoothly from one frame to the next
+	position   float64   // Position in the XO-CHIP pattern in bits, carried between frames the same way
+	remainder  int       // Samples carried over between frames when the sample rate is not a multiple of 60
+	samples    []float32 // Reused for each frame
+}
+
+// SetAudioSink sets where the sound is sent and the sample rate it is generated at, nil stops generating sound. It is
+// for sending the sound somewhere other than the host, e.g. a WAV file, and must be called after SetHost as it is used
+// in place of the host's
+func (cpu *CPU) SetAudioSink(sink AudioSink, sampleRate int) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	cpu.setAudioSink(sink, sampleRate)
+}
+
+// setAudioSink is SetAudioSink for callers that already hold cpu.mu
+func (cpu *CPU) setAudioSink(sink AudioSink, sampleRate int) {
+	cpu.audio.sink = sink
+	cpu.audio.sampleRate = sampleRate
+	cpu.audio.phase = 0
+	cpu.audio.position = 0
+	cpu.audio.remainder = 0
+}
+
+// frame returns the buffer for a frame of samples, silent when on is false, or nil if there is nowhere to send them
+func (a *audio) frame(on bool) []float32 {
+	if a.sink == nil || a.sampleRate <= 0 {
+		return nil
+	}
+
+	budget := a.sampleRate + a.remainder
+	n := budget / frameRate
+	a.remainder = budget % frameRate
+	if cap(a.samples) < n {
+		a.samples = make([]float32, n)
+	}
+	a.samples = a.samples[:n]
+	if !on {
+		clear(a.samples)
+		// Start each beep the same way
+		a.phase = 0
+		a.position = 0
+	}
+	return a.samples
+}
+
+// write sends a frame of samples to the sink
+func (a *audio) write(samples []float32) {
+	if err := a.sink.WriteSamples(samples); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not write audio, sound is off: %v\n", err)
+		a.sink = nil
+	}
+}
+
+// playTone generates a frame of the buzzer's tone, or silence when on is false
+func (a *audio) playTone(on bool) {
+	samples := a.frame(on)
+	if samples == nil {
+		return
+	}
+	if on {
+		step := a.tone.Frequency / float64(a.sampleRate)
+		for i := range samples {
+			samples[i] = float32(a.tone.Waveform.sample(a.phase) * a.tone.Volume)
+			a.phase += step
+			a.phase -= math.Floor(a.phase)
+		}
+	}
+	a.write(samples)
+}
+
+// playPattern generates a frame of the XO-CHIP pattern played at pitch, or silence when on is false. Each output
+// sample is the average of the pattern over the time it covers, so the pattern is resampled to the sink's rate
+// without aliasing whether it plays faster or slower than the sink
+func (a *audio) playPattern(on bool, pattern *[16]uint8, pitch uint8) {
+	samples := a.frame(on)
+	if samples == nil {
+		return
+	}
+	if on {
+		step := patternRate(pitch) / float64(a.sampleRate) // Pattern bits per output sample
+		for i := range samples {
+			level := 0.0
+			for remaining := step; remaining > 0; {
+				bit := int(a.position)
+				span := min(float64(bit+1)-a.position, remaining)
+				if pattern[bit/8]&(0x80>>(bit%8)) != 0 {
+					level += span
+				}
+				a.position += span
+				remaining -= span
+				if a.position >= patternBits {
+					a.position -= patternBits
+				}
+			}
+			samples[i] = float32((2*level/step - 1) * a.tone.Volume)
+		}
+	}
+	a.write(samples)
+}
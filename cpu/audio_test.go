@@ -0,0 +1,145 @@
+package cpu
+
+import (
+	"testing"
+)
+
+// samples collects everything written to it a frame at a time
+type samples [][]float32
+
+func (s *samples) WriteSamples(frame []float32) error {
+	*s = append(*s, append([]float32(nil), frame...))
+	return nil
+}
+
+func Test_soundTimerTone(t *testing.T) {
+	cpu := NewCPU(QuirksVIP, WithTone(Tone{Waveform: Square, Frequency: 441, Volume: 0.5}))
+	cpu.LoadROM([]uint8{
+		0x60, 0x03, // LD V0, 3
+		0xF0, 0x18, // LD ST, V0
+		0x12, 0x04, // JP 0x204
+	})
+	cpu.SetHost(NopHost{})
+	var out samples
+	cpu.SetAudioSink(&out, 44100)
+
+	for frame := 0; frame < 5; frame++ {
+		cpu.RunFrame()
+	}
+	if len(out) != 5 {
+		t.Fatalf("should write a frame of samples each frame, wrote %d\n", len(out))
+	}
+	for frame, samples := range out {
+		if len(samples) != 735 {
+			t.Fatalf("frame %d should have 735 samples, had %d\n", frame, len(samples))
+		}
+		on := frame < 3
+		for _, s := range samples {
+			if on && s != 0.5 && s != -0.5 {
+				t.Fatalf("frame %d should be a square wave at half volume, had sample %v\n", frame, s)
+			}
+			if !on && s != 0 {
+				t.Fatalf("frame %d should be silent once the sound timer expires, had sample %v\n", frame, s)
+			}
+		}
+	}
+	// 441Hz at 44100Hz is 100 samples a cycle, high for the first half. The second frame starts 35 samples into a cycle
+	if out[0][25] != 0.5 || out[0][75] != -0.5 || out[1][0] != 0.5 || out[1][30] != -0.5 {
+		t.Fatalf("the square wave should flip every 50 samples and carry on across frames\n")
+	}
+}
+
+func Test_audioSampleRemainder(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM(loop)
+	cpu.SetHost(NopHost{})
+	var out samples
+	cpu.SetAudioSink(&out, 1000)
+
+	for frame := 0; frame < 60; frame++ {
+		cpu.RunFrame()
+	}
+	total := 0
+	for _, samples := range out {
+		total += len(samples)
+	}
+	if total != 1000 {
+		t.Fatalf("a second of frames should have 1000 samples, had %d\n", total)
+	}
+}
+
+func Test_parseWaveform(t *testing.T) {
+	for _, w := range []Waveform{Square, Sine, Triangle, Sawtooth} {
+		parsed, err := ParseWaveform(w.String())
+		if err != nil || parsed != w {
+			t.Fatalf("%s should parse, got %v %v\n", w, parsed, err)
+		}
+	}
+	if _, err := ParseWaveform("noise"); err == nil {
+		t.Fatalf("unknown waveforms should not parse\n")
+	}
+}
+
+// playPattern sets the sound timer and plays pattern for a frame at sampleRate
+func playPattern(t *testing.T, pattern [16]uint8, pitch uint8, sampleRate int) []float32 {
+	cpu := NewCPU(QuirksXOCHIP, WithTone(Tone{Volume: 1}))
+	cpu.LoadROM(loop)
+	cpu.SetHost(NopHost{})
+	var out samples
+	cpu.SetAudioSink(&out, sampleRate)
+
+	cpu.pattern = pattern
+	cpu.hasPattern = true
+	cpu.pitch = pitch
+	cpu.soundTimer = 1
+	cpu.RunFrame()
+	if len(out) != 1 {
+		t.Fatalf("should write a frame of samples, wrote %d\n", len(out))
+	}
+	return out[0]
+}
+
+func Test_patternPlayback(t *testing.T) {
+	var pattern [16]uint8
+	for n := range pattern {
+		pattern[n] = 0xF0
+	}
+
+	// At pitch 64 the pattern plays at 4000Hz, so at 8000Hz each bit is two samples
+	samples := playPattern(t, pattern, 64, 8000)
+	for i, s := range samples {
+		want := float32(1)
+		if i%16 >= 8 {
+			want = -1
+		}
+		if s != want {
+			t.Fatalf("sample %d should be %v, was %v\n", i, want, s)
+		}
+	}
+}
+
+func Test_patternResample(t *testing.T) {
+	var pattern [16]uint8
+	for n := range pattern {
+		pattern[n] = 0xAA
+	}
+
+	// At 2000Hz each sample covers two bits, one set and one clear, which average out to silence
+	for i, s := range playPattern(t, pattern, 64, 2000) {
+		if s != 0 {
+			t.Fatalf("sample %d should average to 0, was %v\n", i, s)
+		}
+	}
+
+	// At 3000Hz a sample covers a bit and a third, so the average moves between the levels
+	levels := map[float32]bool{}
+	for _, s := range playPattern(t, pattern, 64, 3000) {
+		if s < -1 || s > 1 {
+			t.Fatalf("samples should stay between -1 and 1, was %v\n", s)
+		}
+		levels[s] = true
+	}
+	if len(levels) < 3 {
+		t.Fatalf("resampled pattern should have intermediate levels, had %v\n", levels)
+	}
+}
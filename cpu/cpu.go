@@ -1,31 +1,78 @@
 package cpu
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha1"
 	"fmt"
+	"os"
+	"sync"
 	"time"
 )
 
-type Renderer interface {
-	Render(gfx [64][32]uint8) error
+// FrameHook sees the keypad before every frame executes and the display once it has finished, which is enough to
+// record a session or play one back. It is called with cpu.mu held so must not call back into the CPU
+type FrameHook interface {
+	// BeginFrame may change the keys held during the frame. It is called again if the debugger stops part way
+	// through a frame and the frame is restarted
+	BeginFrame(keys *[16]bool)
+	// EndFrame is called after the timers have been updated
+	EndFrame(frame *Frame)
 }
 
 type CPU struct {
-	opcode uint16      // Current opcode - Two bytes
-	memory [4096]uint8 // Memory - 4KB
-	v      [16]uint8   // Registers - 16 8-bit registers, V0-VE, VF (16th) is carry flag
-	i      uint16      // Index register - 16-bit register
-	pc     uint16      // Program counter - 16-bit register
+	opcode uint16       // Current opcode - Two bytes
+	memory [65536]uint8 // Memory - 64KB, CHIP-8 programs only address the first 4KB but XO-CHIP can use all of it
+	v      [16]uint8    // Registers - 16 8-bit registers, V0-VE, VF (16th) is carry flag
+	i      uint16       // Index register - 16-bit register
+	pc     uint16       // Program counter - 16-bit register
+	quirks Quirks       // Quirks - selects the behaviour of ambiguous instructions
 
-	gfx      [64][32]uint8 // Graphics - 64x32 monochrome display
-	drawFlag bool
-	renderer Renderer
+	rom     []uint8         // The loaded ROM, kept so Reset can restore it
+	romHash [sha1.Size]byte // SHA-1 of the loaded ROM, identifies which ROM a save state belongs to
 
-	delayTimer uint8 // Delay timer, decrements at 60Hz
-	soundTimer uint8 // Sound timer, decrements at 60Hz and buzzes when zero
+	gfx        [HiResWidth][HiResHeight]uint8 // Graphics - 64x32 monochrome display, or 128x64 in high resolution mode
+	hires      bool                           // Set by 00FF, cleared by 00FE
+	plane      uint8                          // Bitmask of the XO-CHIP planes drawing, clearing and scrolling affect, set by FN01
+	drawFlag   bool
+	vblankWait bool // Set by DXYN when the DisplayWait quirk is on, no more instructions run until the next frame
+	host       Host // The frontend, see host.go
+
+	delayTimer uint8     // Delay timer, decrements at 60Hz
+	soundTimer uint8     // Sound timer, decrements at 60Hz and buzzes while non-zero
+	pattern    [16]uint8 // XO-CHIP audio pattern, 128 1-bit samples loaded by F002
+	pitch      uint8     // XO-CHIP pitch register, set by FX3A, decides how fast the pattern plays
+	hasPattern bool      // Set once F002 has loaded a pattern, until then the buzzer plays its tone
+	audio      audio     // Generates the buzzer's sound, see audio.go
 
 	stack [16]uint16 // Stack - 16 levels
 	sp    uint16     // Stack pointer
+
+	rpl    [16]uint8 // RPL user flags - saved and restored by FX75/FX85, persisted across programs on the HP48
+	halted bool      // Set by 00FD, no more instructions are executed
+
+	keys       [16]bool // Keypad - 16 keys, 0x0-0xF, true when held down
+	keyWaiting bool     // Set while FX0A has seen a key go down and is waiting for it to be released
+	keyHeld    uint8    // The key FX0A is waiting to be released
+
+	rng RNG // Random number source for CXNN
+
+	clockSpeed     int // Instructions executed per second
+	clockRemainder int // Instructions carried over between frames when clockSpeed is not a multiple of 60
+
+	rewind        *RewindBuffer // Snapshots of recent frames, nil unless WithRewind is used
+	rewinding     bool          // While set each frame steps back through the rewind buffer instead of executing
+	rewindScratch bytes.Buffer  // Reused to encode the snapshot pushed each frame
+
+	debug debugger // Breakpoints, watchpoints and stepping, see debug.go
+
+	cycles uint64     // Instructions executed since the machine was reset
+	tracer Tracer     // Receives every executed instruction, nil unless tracing
+	trace  TraceEntry // Reused for each instruction traced, see trace.go
+
+	hook FrameHook // Sees every frame executed, nil unless recording or playing back a movie
+
+	mu sync.Mutex // Guards the machine state against the frontend, which runs on a different goroutine
 }
 
 var fontset = [80]uint8{
@@ -47,33 +94,89 @@ var fontset = [80]uint8{
 	0xF0, 0x80, 0xF0, 0x80, 0x80, // F
 }
 
-func NewCPU() *CPU {
+const (
+	frameRate         = 60 // Timers and the display run at 60Hz
+	frameDuration     = time.Second / frameRate
+	maxFrameLag       = 10 * frameDuration // How far behind schedule Run can fall before it stops trying to catch up
+	DefaultClockSpeed = 700                // Instructions per second, fast enough for most ROMs without being unplayable
+)
+
+// Option configures optional behaviour of the CPU
+type Option func(cpu *CPU)
+
+// WithClockSpeed sets the number of instructions executed per second, independent of the 60Hz timers
+func WithClockSpeed(hz int) Option {
+	return func(cpu *CPU) {
+		if hz > 0 {
+			cpu.clockSpeed = hz
+		}
+	}
+}
+
+// WithInstructionsPerFrame sets the number of instructions executed per 60Hz frame
+func WithInstructionsPerFrame(n int) Option {
+	return WithClockSpeed(n * frameRate)
+}
+
+// WithRewind keeps a rewind buffer of up to budget bytes, see SetRewinding
+func WithRewind(budget int) Option {
+	return func(cpu *CPU) {
+		if budget > 0 {
+			cpu.rewind = NewRewindBuffer(budget)
+		}
+	}
+}
+
+// NewCPU creates a CPU that interprets the ambiguous instructions according to quirks
+func NewCPU(quirks Quirks, opts ...Option) *CPU {
 	cpu := &CPU{
-		memory: [4096]uint8{},
+		memory: [65536]uint8{},
 		v:      [16]uint8{},
 		i:      0,
 		pc:     0x200, // Program counter starts at 0x200
+		quirks: quirks,
 
-		gfx: [64][32]uint8{},
+		gfx:   [HiResWidth][HiResHeight]uint8{},
+		plane: 0x1, // Only the first plane is used unless a program asks for more
 
 		delayTimer: 0,
 		soundTimer: 0,
 
 		stack: [16]uint16{},
 		sp:    0,
+
+		pitch:      defaultPitch,
+		clockSpeed: DefaultClockSpeed,
+		audio:      audio{tone: DefaultTone},
+	}
+
+	for _, opt := range opts {
+		opt(cpu)
+	}
+	if cpu.rng == nil {
+		cpu.rng = defaultRNG()
 	}
 
 	// Initialize memory map
 	// 0x000-0x1FF - Chip 8 interpreter (contains font set in emu)
-	// 0x050-0x0A0 - Used for the built-in 4x5 pixel font set (0-F)
+	// 0x000-0x04F - Used for the built-in 4x5 pixel font set (0-F)
+	// 0x050-0x0EF - Used for the SUPER-CHIP 8x10 pixel font set (0-F)
 	// 0x200-0xFFF - Program ROM and work RAM
+	// 0x1000-0xFFFF - XO-CHIP extended memory
 
-	// Load fontset
+	cpu.loadFonts()
+
+	return cpu
+}
+
+// loadFonts copies both font sets into the interpreter area of memory
+func (cpu *CPU) loadFonts() {
 	for i, b := range fontset {
 		cpu.memory[i] = b
 	}
-
-	return cpu
+	for i, b := range bigFontset {
+		cpu.memory[bigFontAddr+i] = b
+	}
 }
 
 // LoadROM loads a ROM into memory, starting at 0x200
@@ -84,45 +187,203 @@ func (cpu *CPU) LoadROM(rom []uint8) error {
 	for i, b := range rom {
 		cpu.memory[0x200+i] = b
 	}
-	fmt.Printf("Successfully loaded ROM (%d bytes) into memory\n", len(rom))
+	cpu.rom = append([]uint8(nil), rom...) // Keep a copy so Reset can restore it
+	cpu.romHash = sha1.Sum(rom)
+	fmt.Fprintf(os.Stderr, "Successfully loaded ROM (%d bytes) into memory\n", len(rom))
 	return nil
 }
 
+// ReloadROM replaces the loaded ROM and resets the machine so the new program starts from the beginning, it is safe
+// to call while the CPU is running
+func (cpu *CPU) ReloadROM(rom []uint8) error {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+
+	if err := cpu.LoadROM(rom); err != nil {
+		return err
+	}
+	cpu.reset()
+	return nil
+}
+
+// Reset restores the machine to its power-on state. The loaded ROM is kept, so the program starts again from the
+// beginning. The RPL user flags survive a reset, as they would on the HP48. It is safe to call while the CPU is running
 func (cpu *CPU) Reset() {
-	// Reset the CPU state
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	cpu.reset()
 }
 
+// reset is Reset for callers that already hold cpu.mu
+func (cpu *CPU) reset() {
+	cpu.opcode = 0
+	cpu.memory = [65536]uint8{}
+	cpu.loadFonts()
+	copy(cpu.memory[0x200:], cpu.rom)
+	cpu.v = [16]uint8{}
+	cpu.i = 0
+	cpu.pc = 0x200
+
+	cpu.gfx = [HiResWidth][HiResHeight]uint8{}
+	cpu.hires = false
+	cpu.plane = 0x1
+	cpu.drawFlag = true // Make sure the renderer sees the cleared display
+	cpu.vblankWait = false
+
+	cpu.delayTimer = 0
+	cpu.soundTimer = 0
+	cpu.pattern = [16]uint8{}
+	cpu.pitch = defaultPitch
+	cpu.hasPattern = false
+
+	cpu.stack = [16]uint16{}
+	cpu.sp = 0
+	cpu.halted = false
+
+	cpu.keys = [16]bool{}
+	cpu.keyWaiting = false
+	cpu.keyHeld = 0
+
+	cpu.clockRemainder = 0
+	cpu.cycles = 0
+	if cpu.rewind != nil {
+		cpu.rewind.Reset() // Rewinding past a reset would load states from before it
+	}
+}
+
+// Run executes frames as the host paces them until ctx is cancelled or the host closes, without a host frames run at
+// 60Hz. The host must be set before Run is called
 func (cpu *CPU) Run(ctx context.Context) {
-	clockTick := time.NewTicker(time.Second / 60) // 60Hz
-
-	for {
-		startTime := time.Now()
-		select {
-		case <-ctx.Done():
-			clockTick.Stop()
-			return
-		case <-clockTick.C:
-			cpu.cycle()
-			cpu.updateTimers()
-			if cpu.drawFlag {
-				if cpu.renderer != nil {
-					cpu.renderer.Render(cpu.gfx)
-				} else {
-					for y := 0; y < 32; y++ {
-						for x := 0; x < 64; x++ {
-							fmt.Printf("%d", cpu.gfx[x][y])
-						}
-						fmt.Println()
-					}
-					fmt.Println()
-				}
-				cpu.drawFlag = false
+	cpu.mu.Lock()
+	var pacer interface{ WaitFrame(context.Context) bool } = &RealTime{}
+	if cpu.host != nil {
+		pacer = cpu.host
+	}
+	cpu.mu.Unlock()
+
+	for pacer.WaitFrame(ctx) {
+		cpu.RunFrame()
+	}
+}
+
+// RunFrame executes a single frame, it is safe to call from another goroutine
+func (cpu *CPU) RunFrame() {
+	cpu.mu.Lock()
+	cpu.runFrame()
+	cpu.mu.Unlock()
+	cpu.reportStop()
+}
+
+// runFrame executes a frame's worth of instructions, updates the timers and renders the display if it has changed.
+// While rewinding it steps back a frame instead. It returns the number of instructions executed, the caller must
+// hold cpu.mu
+func (cpu *CPU) runFrame() int {
+	if cpu.host != nil {
+		cpu.host.PollInput(&cpu.keys)
+	}
+	if cpu.debug.paused {
+		cpu.render()
+		return 0
+	}
+	if cpu.rewind != nil && cpu.rewinding {
+		cpu.rewindFrame()
+		return 0
+	}
+
+	cpu.vblankWait = false // A new frame has started
+	if cpu.hook != nil {
+		cpu.hook.BeginFrame(&cpu.keys)
+	}
+
+	// Carry the remainder over so clock speeds that are not a multiple of 60Hz average out correctly
+	budget := cpu.clockSpeed + cpu.clockRemainder
+	instructions := budget / frameRate
+	cpu.clockRemainder = budget % frameRate
+
+	executed := 0
+	if cpu.debug.active() {
+		executed = cpu.debugInstructions(instructions)
+		if cpu.debug.paused {
+			// Stopped part way through the frame, the timers wait until the frame is finished
+			cpu.render()
+			return executed
+		}
+	} else {
+		for executed < instructions && !cpu.vblankWait && !cpu.halted {
+			cpu.execute()
+			executed++
+		}
+	}
+
+	cpu.updateTimers()
+	cpu.render()
+	if cpu.hook != nil {
+		frame := cpu.frame()
+		cpu.hook.EndFrame(&frame)
+	}
+
+	if cpu.rewind != nil {
+		cpu.rewindScratch.Reset()
+		if err := cpu.saveState(&cpu.rewindScratch); err == nil {
+			cpu.rewind.Push(cpu.rewindScratch.Bytes())
+		}
+	}
+	return executed
+}
+
+// debugInstructions is the instruction loop of runFrame when the debugger is active, it stops early when a
+// breakpoint, watchpoint, condition or step stops execution
+func (cpu *CPU) debugInstructions(instructions int) int {
+	executed := 0
+	for executed < instructions && !cpu.vblankWait && !cpu.halted {
+		if cpu.beforeInstruction() {
+			break
+		}
+		cpu.execute()
+		executed++
+		if cpu.afterInstruction() {
+			break
+		}
+	}
+	return executed
+}
+
+// rewindFrame restores the snapshot from the previous frame. The keypad is left as it is, so keys released while
+// rewinding are not stuck down afterwards
+func (cpu *CPU) rewindFrame() {
+	snapshot, ok := cpu.rewind.Rewind()
+	if !ok {
+		return
+	}
+
+	keys := cpu.keys
+	if err := cpu.loadState(bytes.NewReader(snapshot)); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not rewind: %v\n", err)
+		return
+	}
+	cpu.keys = keys
+	cpu.render()
+}
+
+// render presents the display to the host if it has changed since the last frame
+func (cpu *CPU) render() {
+	if !cpu.drawFlag {
+		return
+	}
+	if cpu.host != nil {
+		if err := cpu.host.Present(cpu.frame()); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not present the display: %v\n", err)
+		}
+	} else {
+		for y := 0; y < cpu.height(); y++ {
+			for x := 0; x < cpu.width(); x++ {
+				fmt.Printf("%d", cpu.gfx[x][y])
 			}
+			fmt.Println()
 		}
-		duration := time.Since(startTime)
-		frequency := (time.Second / duration).Nanoseconds()
-		fmt.Printf("Cycle Freq: %dHz\n", frequency)
+		fmt.Println()
 	}
+	cpu.drawFlag = false
 }
 
 func (cpu *CPU) cycle() {
@@ -137,13 +398,27 @@ func (cpu *CPU) cycle() {
 	// In the hexadecimal representation each digit is 4 bits long, so we can use a 4-bit mask to extract the different parts
 	switch cpu.opcode & 0xF000 { // Get the first 4 bits
 	case 0x0000: // The opcode starts with 0x0
-		switch cpu.opcode & 0x000F { // Get the last 4 bits
-		case 0x0000: // 0x00E0 - Clears the screen
+		switch {
+		case cpu.opcode&0xFFF0 == 0x00C0: // 0x00CN - Scrolls the display down N pixels
+			Op00CN(cpu)
+		case cpu.opcode&0xFFF0 == 0x00D0: // 0x00DN - Scrolls the display up N pixels
+			Op00DN(cpu)
+		case cpu.opcode == 0x00E0: // 0x00E0 - Clears the screen
 			Op00E0(cpu)
-		case 0x000E: // 0x00EE - Returns from a subroutine
+		case cpu.opcode == 0x00EE: // 0x00EE - Returns from a subroutine
 			Op00EE(cpu)
+		case cpu.opcode == 0x00FB: // 0x00FB - Scrolls the display right 4 pixels
+			Op00FB(cpu)
+		case cpu.opcode == 0x00FC: // 0x00FC - Scrolls the display left 4 pixels
+			Op00FC(cpu)
+		case cpu.opcode == 0x00FD: // 0x00FD - Exits the interpreter
+			Op00FD(cpu)
+		case cpu.opcode == 0x00FE: // 0x00FE - Switches to low resolution mode
+			Op00FE(cpu)
+		case cpu.opcode == 0x00FF: // 0x00FF - Switches to high resolution mode
+			Op00FF(cpu)
 		default:
-			fmt.Printf("Unknown opcode [0x0000]: 0x%X\n", cpu.opcode)
+			fmt.Fprintf(os.Stderr, "Unknown opcode [0x0000]: 0x%X\n", cpu.opcode)
 		}
 	case 0x1000: // 1NNN - Jumps to address NNN
 		Op1NNN(cpu)
@@ -153,8 +428,17 @@ func (cpu *CPU) cycle() {
 		Op3XNN(cpu)
 	case 0x4000: // 4XNN - Skips the next instruction if VX does not equal NN (usually the next instruction is a jump to skip a code block)
 		Op4XNN(cpu)
-	case 0x5000: // 5XY0 - Skips the next instruction if VX equals VY (usually the next instruction is a jump to skip a code block)
-		Op5XY0(cpu)
+	case 0x5000: // Opcodes beginning with 5
+		switch cpu.opcode & 0x000F { // Get the last 4 bits
+		case 0x0000: // 5XY0 - Skips the next instruction if VX equals VY (usually the next instruction is a jump to skip a code block)
+			Op5XY0(cpu)
+		case 0x0002: // 5XY2 - Stores VX to VY in memory starting at I
+			Op5XY2(cpu)
+		case 0x0003: // 5XY3 - Fills VX to VY with values from memory starting at I
+			Op5XY3(cpu)
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown opcode [0x5000]: 0x%X\n", cpu.opcode)
+		}
 	case 0x6000: // 6XNN - Sets VX to NN
 		Op6XNN(cpu)
 	case 0x7000: // 7XNN - Adds NN to VX (carry flag is not changed)
@@ -180,7 +464,7 @@ func (cpu *CPU) cycle() {
 		case 0x000E: // 0x8XYE - Shifts VX left by one. VF is set to the most significant bit of VX before the shift.
 			Op8XYE(cpu)
 		default:
-			fmt.Printf("Unknown opcode [0x8000]: 0x%X\n", cpu.opcode)
+			fmt.Fprintf(os.Stderr, "Unknown opcode [0x8000]: 0x%X\n", cpu.opcode)
 		}
 	case 0x9000:
 		Op9XY0(cpu)
@@ -190,34 +474,126 @@ func (cpu *CPU) cycle() {
 		OpBNNN(cpu) // BNNN - Jumps to the address NNN plus V0
 	case 0xC000:
 		OpCXNN(cpu) // CXNN - Sets VX to the result of a bitwise and operation on a random number (Typically: 0 to 255) and NN
-	case 0xD000: // DXYN - Draw a sprite at coordinate XY
-		OpDXYN(cpu)
+	case 0xD000:
+		if cpu.opcode&0x000F == 0 { // DXY0 - Draw a 16x16 sprite at coordinate XY
+			OpDXY0(cpu)
+		} else { // DXYN - Draw a sprite at coordinate XY
+			OpDXYN(cpu)
+		}
+	case 0xE000: // Opcodes starting with 0xE
+		switch cpu.opcode & 0x00FF {
+		case 0x009E: // EX9E - Skips the next instruction if the key stored in VX is pressed
+			OpEX9E(cpu)
+		case 0x00A1: // EXA1 - Skips the next instruction if the key stored in VX is not pressed
+			OpEXA1(cpu)
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown opcode [0xE000]: 0x%X\n", cpu.opcode)
+		}
 	case 0xF000: // Opcodes starting with 0xF
 		switch cpu.opcode & 0x00FF {
-		case 0x001E:
+		case 0x0000: // F000 NNNN - Sets I to the 16-bit address NNNN
+			if cpu.opcode != 0xF000 {
+				fmt.Fprintf(os.Stderr, "Unknown opcode [0xF000]: 0x%X\n", cpu.opcode)
+				break
+			}
+			OpF000(cpu)
+		case 0x0001: // FN01 - Selects the drawing planes
+			OpFN01(cpu)
+		case 0x0002: // F002 - Loads the audio pattern from memory starting at I
+			if cpu.opcode != 0xF002 {
+				fmt.Fprintf(os.Stderr, "Unknown opcode [0xF000]: 0x%X\n", cpu.opcode)
+				break
+			}
+			OpF002(cpu)
+		case 0x000A: // FX0A - Waits for a key press and release, then stores the key in VX
+			OpFX0A(cpu)
+		case 0x0007: // FX07 - Sets VX to the value of the delay timer
+			OpFX07(cpu)
+		case 0x0015: // FX15 - Sets the delay timer to VX
+			OpFX15(cpu)
+		case 0x0018: // FX18 - Sets the sound timer to VX
+			OpFX18(cpu)
+		case 0x001E: // FX1E - Adds VX to I
 			OpFX1E(cpu)
-		case 0x0033:
+		case 0x0029: // FX29 - Sets I to the location of the font sprite for the character in VX
+			OpFX29(cpu)
+		case 0x0030: // FX30 - Sets I to the location of the big font sprite for the character in VX
+			OpFX30(cpu)
+		case 0x0033: // FX33 - Stores the BCD representation of VX at I, I+1 and I+2
 			OpFX33(cpu)
+		case 0x003A: // FX3A - Sets the audio pitch to VX
+			OpFX3A(cpu)
+		case 0x0055: // FX55 - Stores V0 to VX (including VX) in memory starting at I
+			OpFX55(cpu)
+		case 0x0065: // FX65 - Fills V0 to VX (including VX) with values from memory starting at I
+			OpFX65(cpu)
+		case 0x0075: // FX75 - Stores V0 to VX (including VX) in the RPL user flags
+			OpFX75(cpu)
+		case 0x0085: // FX85 - Fills V0 to VX (including VX) from the RPL user flags
+			OpFX85(cpu)
 		default:
-			fmt.Printf("Unknown opcode [0xF000]: 0x%X\n", cpu.opcode)
+			fmt.Fprintf(os.Stderr, "Unknown opcode [0xF000]: 0x%X\n", cpu.opcode)
 		}
 	default:
-		fmt.Printf("Unknown opcode: 0x%X\n", cpu.opcode)
+		fmt.Fprintf(os.Stderr, "Unknown opcode: 0x%X\n", cpu.opcode)
+	}
+}
+
+// skip steps the program counter over the next instruction, which is four bytes long if it is F000 NNNN
+func (cpu *CPU) skip() {
+	next := cpu.pc + 2
+	if cpu.memory[next] == 0xF0 && cpu.memory[next+1] == 0x00 {
+		cpu.pc += 4
+		return
 	}
+	cpu.pc += 2
 }
 
 func (cpu *CPU) updateTimers() {
 	if cpu.delayTimer > 0 {
 		cpu.delayTimer--
 	}
+	if cpu.hasPattern {
+		cpu.audio.playPattern(cpu.soundTimer > 0, &cpu.pattern, cpu.pitch)
+	} else {
+		cpu.audio.playTone(cpu.soundTimer > 0)
+	}
 	if cpu.soundTimer > 0 {
-		if cpu.soundTimer == 1 {
-			fmt.Println("Beep!")
-		}
 		cpu.soundTimer--
 	}
 }
 
-func (cpu *CPU) SetRenderer(renderer Renderer) {
-	cpu.renderer = renderer
+// SetFrameHook sets the hook that sees every frame executed, nil removes it
+func (cpu *CPU) SetFrameHook(hook FrameHook) {
+	cpu.mu.Lock()
+	cpu.hook = hook
+	cpu.mu.Unlock()
+}
+
+// Quirks returns the quirks the CPU was created with
+func (cpu *CPU) Quirks() Quirks {
+	return cpu.quirks
+}
+
+// ClockSpeed returns the number of instructions executed per second
+func (cpu *CPU) ClockSpeed() int {
+	return cpu.clockSpeed
+}
+
+// SetRewinding starts or stops rewinding, while rewinding Run steps back a frame at a time instead of executing.
+// It does nothing unless the CPU was created WithRewind
+func (cpu *CPU) SetRewinding(rewinding bool) {
+	cpu.mu.Lock()
+	cpu.rewinding = rewinding
+	cpu.mu.Unlock()
+}
+
+// SetKey updates the state of key k (0x0-0xF) on the hex keypad, it is safe to call from the frontend while the CPU is running
+func (cpu *CPU) SetKey(k uint8, down bool) {
+	if k > 0xF {
+		return
+	}
+	cpu.mu.Lock()
+	cpu.keys[k] = down
+	cpu.mu.Unlock()
 }
@@ -0,0 +1,121 @@
+package cpu
+
+import (
+	"testing"
+)
+
+// loop is a ROM that jumps to itself forever
+var loop = []uint8{0x12, 0x00}
+
+func Test_runFrameClockSpeed(t *testing.T) {
+	cpu := NewCPU(QuirksVIP, WithInstructionsPerFrame(10))
+	cpu.LoadROM(loop)
+
+	if executed := cpu.runFrame(); executed != 10 {
+		t.Fatalf("should execute 10 instructions per frame, executed %d\n", executed)
+	}
+
+	// 90Hz is one and a half instructions per frame, so frames should alternate between 1 and 2
+	cpu = NewCPU(QuirksVIP, WithClockSpeed(90))
+	cpu.LoadROM(loop)
+
+	total := 0
+	for frame := 0; frame < 60; frame++ {
+		total += cpu.runFrame()
+	}
+	if total != 90 {
+		t.Fatalf("should execute 90 instructions in 60 frames, executed %d\n", total)
+	}
+}
+
+func Test_runFrameTimers(t *testing.T) {
+	cpu := NewCPU(QuirksVIP, WithInstructionsPerFrame(100))
+	cpu.LoadROM(loop)
+
+	cpu.delayTimer = 10
+	cpu.runFrame()
+
+	if cpu.delayTimer != 9 {
+		t.Fatalf("delay timer should decrement once per frame regardless of clock speed, was %d\n", cpu.delayTimer)
+	}
+}
+
+func Test_runFrameDisplayWait(t *testing.T) {
+	cpu := NewCPU(QuirksVIP, WithInstructionsPerFrame(10))
+	cpu.SetHost(NopHost{})
+	cpu.LoadROM([]uint8{
+		0xD0, 0x01,
+		0x12, 0x02,
+	})
+
+	if executed := cpu.runFrame(); executed != 1 {
+		t.Fatalf("frame should end after a draw, executed %d\n", executed)
+	}
+	if executed := cpu.runFrame(); executed != 10 {
+		t.Fatalf("next frame should run in full, executed %d\n", executed)
+	}
+}
+
+func Test_reset(t *testing.T) {
+	cpu := NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{
+		0x00, 0xFF, // hires
+		0x60, 0x05, // V0 := 5
+		0xA3, 0x00, // I := 0x300
+		0xF0, 0x55, // save V0
+		0xF0, 0x75, // save V0 to flags
+		0x22, 0x00, // call 0x200
+	})
+
+	for n := 0; n < 6; n++ {
+		cpu.cycle()
+	}
+	cpu.delayTimer = 10
+	cpu.gfx[1][1] = 1
+	cpu.SetKey(0x2, true)
+
+	// Overwrite part of the ROM, as self modifying programs do
+	cpu.memory[0x201] = 0x00
+
+	cpu.Reset()
+
+	if cpu.pc != 0x200 || cpu.sp != 0 || cpu.i != 0 || cpu.v != [16]uint8{} {
+		t.Fatalf("registers should be reset\n")
+	}
+	if cpu.hires || cpu.gfx[1][1] != 0 || cpu.delayTimer != 0 || cpu.keys[0x2] {
+		t.Fatalf("display, timers and keypad should be reset\n")
+	}
+	if cpu.memory[0x300] != 0 {
+		t.Fatalf("work RAM should be cleared\n")
+	}
+	if cpu.memory[0x200] != 0x00 || cpu.memory[0x201] != 0xFF {
+		t.Fatalf("ROM should be restored\n")
+	}
+	if cpu.memory[0] != fontset[0] || cpu.memory[bigFontAddr] != bigFontset[0] {
+		t.Fatalf("fonts should be loaded\n")
+	}
+	if cpu.rpl[0] != 5 {
+		t.Fatalf("RPL flags should survive a reset\n")
+	}
+}
+
+func Test_reloadROM(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{0x60, 0x01, 0x60, 0x02})
+	cpu.cycle()
+
+	if err := cpu.ReloadROM([]uint8{0x61, 0x07}); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if cpu.pc != 0x200 || cpu.v[0x0] != 0 {
+		t.Fatalf("machine should be reset\n")
+	}
+	if cpu.memory[0x202] != 0 {
+		t.Fatalf("old ROM should be cleared from memory\n")
+	}
+
+	cpu.cycle()
+	if cpu.v[0x1] != 0x07 {
+		t.Fatalf("new ROM should run\n")
+	}
+}
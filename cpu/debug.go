@@ -0,0 +1,551 @@
+package cpu
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Register names a register for the debugger, in the order debuggers number them
+type Register int
+
+const (
+	RegV0 Register = iota
+	RegV1
+	RegV2
+	RegV3
+	RegV4
+	RegV5
+	RegV6
+	RegV7
+	RegV8
+	RegV9
+	RegVA
+	RegVB
+	RegVC
+	RegVD
+	RegVE
+	RegVF
+	RegI
+	RegPC
+	RegSP
+	RegDT
+	RegST
+	NumRegisters = iota
+)
+
+func (r Register) String() string {
+	switch {
+	case r >= RegV0 && r <= RegVF:
+		return fmt.Sprintf("V%X", int(r))
+	case r == RegI:
+		return "I"
+	case r == RegPC:
+		return "PC"
+	case r == RegSP:
+		return "SP"
+	case r == RegDT:
+		return "DT"
+	case r == RegST:
+		return "ST"
+	}
+	return fmt.Sprintf("Register(%d)", int(r))
+}
+
+// ParseRegister looks up a register by name, e.g. v3, VA, pc or dt
+func ParseRegister(name string) (Register, error) {
+	for r := RegV0; r < NumRegisters; r++ {
+		if strings.EqualFold(r.String(), name) {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown register %q", name)
+}
+
+// StopReason is why execution stopped
+type StopReason int
+
+const (
+	StopPause      StopReason = iota // Pause was called
+	StopStep                         // A Step, StepOver or StepOut finished
+	StopBreakpoint                   // PC reached a breakpoint
+	StopWatchpoint                   // An instruction accessed watched memory
+	StopCondition                    // A register condition became true
+)
+
+func (r StopReason) String() string {
+	return [...]string{"pause", "step", "breakpoint", "watchpoint", "condition"}[r]
+}
+
+// Stop describes where and why execution stopped
+type Stop struct {
+	Reason    StopReason
+	PC        uint16    // The next instruction to execute
+	Addr      uint16    // Address accessed, for watchpoints
+	Write     bool      // Whether the access was a write, for watchpoints
+	Condition Condition // The condition that became true, for conditions and conditional breakpoints
+}
+
+// WatchKind selects the accesses a watchpoint stops on
+type WatchKind int
+
+const (
+	WatchWrite  WatchKind = 1 << iota // Stop when an instruction writes the memory
+	WatchRead                         // Stop when an instruction reads the memory
+	WatchAccess = WatchRead | WatchWrite
+)
+
+// Watchpoint stops execution after an instruction accesses Len bytes of memory from Addr
+type Watchpoint struct {
+	Addr uint16
+	Len  uint16 // Treated as 1 when zero
+	Kind WatchKind
+}
+
+func (w Watchpoint) contains(addr uint16) bool {
+	length := max(w.Len, 1)
+	return addr >= w.Addr && uint32(addr) < uint32(w.Addr)+uint32(length)
+}
+
+// Condition compares a register against a value, e.g. V3 == 5
+type Condition struct {
+	Register Register
+	Op       string // One of == != < <= > >=
+	Value    uint16
+}
+
+// ParseCondition parses a condition written as register, operator and value, e.g. "v3 == 5" or "i >= 0x300"
+func ParseCondition(s string) (Condition, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return Condition{}, fmt.Errorf("condition %q should be register, operator and value, e.g. v3 == 5", s)
+	}
+	reg, err := ParseRegister(fields[0])
+	if err != nil {
+		return Condition{}, err
+	}
+	switch fields[1] {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return Condition{}, fmt.Errorf("unknown operator %q", fields[1])
+	}
+	value, err := strconv.ParseUint(fields[2], 0, 16)
+	if err != nil {
+		return Condition{}, fmt.Errorf("invalid value %q", fields[2])
+	}
+	return Condition{Register: reg, Op: fields[1], Value: uint16(value)}, nil
+}
+
+func (c Condition) String() string {
+	return fmt.Sprintf("%s %s 0x%X", c.Register, c.Op, c.Value)
+}
+
+func (c Condition) holds(cpu *CPU) bool {
+	value := cpu.register(c.Register)
+	switch c.Op {
+	case "==":
+		return value == c.Value
+	case "!=":
+		return value != c.Value
+	case "<":
+		return value < c.Value
+	case "<=":
+		return value <= c.Value
+	case ">":
+		return value > c.Value
+	case ">=":
+		return value >= c.Value
+	}
+	return false
+}
+
+// stepMode is the kind of step in progress
+type stepMode int
+
+const (
+	stepNone        stepMode = iota
+	stepInstruction          // Stop after the next instruction
+	stepOver                 // Stop when PC reaches stepPC with the stack no deeper than stepSP
+	stepOut                  // Stop when the stack is shallower than stepSP
+)
+
+// condition is a Condition along with whether it held after the last instruction, conditions stop execution when
+// they become true rather than for as long as they are true
+type condition struct {
+	Condition
+	held bool
+}
+
+// debugger is the debugging state of a CPU
+type debugger struct {
+	paused      bool
+	breakpoints map[uint16]*Condition // Breakpoint addresses, with a condition for conditional breakpoints
+	watchpoints []Watchpoint
+	conditions  []*condition
+	step        stepMode
+	stepPC      uint16
+	stepSP      uint16
+	resumed     bool  // Set on resuming, so a breakpoint at PC doesn't stop execution before it moves
+	watchHit    *Stop // Set by read and write when a watchpoint is hit, execution stops once the instruction finishes
+	pending     *Stop // A stop that hasn't been reported yet
+	onStop      func(stop Stop)
+}
+
+// active reports whether instructions need checking against the debugger, so the CPU runs at full speed when not
+func (d *debugger) active() bool {
+	return len(d.breakpoints) > 0 || len(d.watchpoints) > 0 || len(d.conditions) > 0 || d.step != stepNone
+}
+
+// SetStopHandler sets a function called whenever execution stops. It is called from the goroutine running frames
+// once cpu.mu is released, so it may call back into the CPU
+func (cpu *CPU) SetStopHandler(onStop func(stop Stop)) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	cpu.debug.onStop = onStop
+}
+
+// Pause stops execution at the next instruction, the display keeps being rendered but the timers stop. Pausing
+// when already paused reports the stop again
+func (cpu *CPU) Pause() {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	cpu.stop(Stop{Reason: StopPause})
+}
+
+// Resume continues execution until the next breakpoint, watchpoint or condition
+func (cpu *CPU) Resume() {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	cpu.resume(stepNone)
+}
+
+// Paused reports whether execution is stopped
+func (cpu *CPU) Paused() bool {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	return cpu.debug.paused
+}
+
+// Step executes a single instruction then stops
+func (cpu *CPU) Step() {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	cpu.resume(stepInstruction)
+}
+
+// StepOver steps a single instruction, but runs a 2NNN call until the subroutine returns
+func (cpu *CPU) StepOver() {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+
+	if cpu.memory[cpu.pc]&0xF0 != 0x20 {
+		cpu.resume(stepInstruction)
+		return
+	}
+	cpu.debug.stepPC = cpu.pc + 2
+	cpu.debug.stepSP = cpu.sp
+	cpu.resume(stepOver)
+}
+
+// StepOut runs until the current subroutine returns
+func (cpu *CPU) StepOut() error {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+
+	if cpu.sp == 0 {
+		return fmt.Errorf("not in a subroutine")
+	}
+	cpu.debug.stepSP = cpu.sp
+	cpu.resume(stepOut)
+	return nil
+}
+
+func (cpu *CPU) resume(mode stepMode) {
+	cpu.debug.pending = nil // A stop not reported yet is out of date
+	cpu.debug.paused = false
+	cpu.debug.resumed = true
+	cpu.debug.step = mode
+}
+
+// stop pauses execution and queues the stop to be reported, the caller must hold cpu.mu
+func (cpu *CPU) stop(stop Stop) {
+	stop.PC = cpu.pc
+	cpu.debug.paused = true
+	cpu.debug.step = stepNone
+	cpu.debug.pending = &stop
+}
+
+// SetBreakpoint stops execution whenever PC reaches addr
+func (cpu *CPU) SetBreakpoint(addr uint16) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	if cpu.debug.breakpoints == nil {
+		cpu.debug.breakpoints = map[uint16]*Condition{}
+	}
+	cpu.debug.breakpoints[addr] = nil
+}
+
+// SetConditionalBreakpoint stops execution when PC reaches addr while cond holds
+func (cpu *CPU) SetConditionalBreakpoint(addr uint16, cond Condition) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	if cpu.debug.breakpoints == nil {
+		cpu.debug.breakpoints = map[uint16]*Condition{}
+	}
+	cpu.debug.breakpoints[addr] = &cond
+}
+
+// ClearBreakpoint removes the breakpoint at addr
+func (cpu *CPU) ClearBreakpoint(addr uint16) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	delete(cpu.debug.breakpoints, addr)
+}
+
+// ClearBreakpoints removes every breakpoint
+func (cpu *CPU) ClearBreakpoints() {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	cpu.debug.breakpoints = nil
+}
+
+// Breakpoints returns the breakpoint addresses in order
+func (cpu *CPU) Breakpoints() []uint16 {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+
+	addrs := make([]uint16, 0, len(cpu.debug.breakpoints))
+	for addr := range cpu.debug.breakpoints {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// AddWatchpoint stops execution after an instruction reads or writes watched memory. Only accesses made by
+// instructions are watched, fetching instructions and the debugger's own ReadMemory and WriteMemory are not
+func (cpu *CPU) AddWatchpoint(w Watchpoint) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	cpu.debug.watchpoints = append(cpu.debug.watchpoints, w)
+}
+
+// RemoveWatchpoint removes a watchpoint added with AddWatchpoint
+func (cpu *CPU) RemoveWatchpoint(w Watchpoint) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	for n, existing := range cpu.debug.watchpoints {
+		if existing == w {
+			cpu.debug.watchpoints = append(cpu.debug.watchpoints[:n], cpu.debug.watchpoints[n+1:]...)
+			return
+		}
+	}
+}
+
+// Watchpoints returns the watchpoints
+func (cpu *CPU) Watchpoints() []Watchpoint {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	return append([]Watchpoint(nil), cpu.debug.watchpoints...)
+}
+
+// AddCondition stops execution whenever the condition becomes true, it is checked after every instruction
+func (cpu *CPU) AddCondition(c Condition) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	cpu.debug.conditions = append(cpu.debug.conditions, &condition{Condition: c, held: c.holds(cpu)})
+}
+
+// RemoveCondition removes a condition added with AddCondition
+func (cpu *CPU) RemoveCondition(c Condition) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	for n, existing := range cpu.debug.conditions {
+		if existing.Condition == c {
+			cpu.debug.conditions = append(cpu.debug.conditions[:n], cpu.debug.conditions[n+1:]...)
+			return
+		}
+	}
+}
+
+// Conditions returns the conditions
+func (cpu *CPU) Conditions() []Condition {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+
+	conditions := make([]Condition, len(cpu.debug.conditions))
+	for n, c := range cpu.debug.conditions {
+		conditions[n] = c.Condition
+	}
+	return conditions
+}
+
+// Register reads a register
+func (cpu *CPU) Register(r Register) uint16 {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	return cpu.register(r)
+}
+
+func (cpu *CPU) register(r Register) uint16 {
+	switch {
+	case r >= RegV0 && r <= RegVF:
+		return uint16(cpu.v[r])
+	case r == RegI:
+		return cpu.i
+	case r == RegPC:
+		return cpu.pc
+	case r == RegSP:
+		return cpu.sp
+	case r == RegDT:
+		return uint16(cpu.delayTimer)
+	case r == RegST:
+		return uint16(cpu.soundTimer)
+	}
+	return 0
+}
+
+// SetRegister writes a register, values are truncated to the width of the register
+func (cpu *CPU) SetRegister(r Register, value uint16) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+
+	switch {
+	case r >= RegV0 && r <= RegVF:
+		cpu.v[r] = uint8(value)
+	case r == RegI:
+		cpu.i = value
+	case r == RegPC:
+		cpu.pc = value
+		cpu.keyWaiting = false // An FX0A in progress no longer applies
+	case r == RegSP:
+		cpu.sp = min(value, uint16(len(cpu.stack)))
+	case r == RegDT:
+		cpu.delayTimer = uint8(value)
+	case r == RegST:
+		cpu.soundTimer = uint8(value)
+	}
+}
+
+// Stack returns the return addresses on the stack, innermost call last
+func (cpu *CPU) Stack() []uint16 {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	return append([]uint16(nil), cpu.stack[:min(cpu.sp, uint16(len(cpu.stack)))]...)
+}
+
+// ReadMemory copies n bytes of memory from addr, stopping at the end of memory. A negative n reads nothing
+func (cpu *CPU) ReadMemory(addr uint16, n int) []byte {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	n = min(max(n, 0), len(cpu.memory)-int(addr))
+	return append([]byte(nil), cpu.memory[addr:int(addr)+n]...)
+}
+
+// WriteMemory copies data into memory from addr, stopping at the end of memory
+func (cpu *CPU) WriteMemory(addr uint16, data []byte) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	copy(cpu.memory[addr:], data)
+}
+
+// read reads memory on behalf of an instruction
+func (cpu *CPU) read(addr uint16) uint8 {
+	if len(cpu.debug.watchpoints) > 0 {
+		cpu.watch(addr, WatchRead)
+	}
+	return cpu.memory[addr]
+}
+
+// write writes memory on behalf of an instruction
+func (cpu *CPU) write(addr uint16, value uint8) {
+	if len(cpu.debug.watchpoints) > 0 {
+		cpu.watch(addr, WatchWrite)
+	}
+	if cpu.tracer != nil {
+		cpu.trace.Memory = append(cpu.trace.Memory, MemoryChange{Addr: addr, Old: cpu.memory[addr], New: value})
+	}
+	cpu.memory[addr] = value
+}
+
+func (cpu *CPU) watch(addr uint16, kind WatchKind) {
+	if cpu.debug.watchHit != nil {
+		return // Report the first access an instruction makes
+	}
+	for _, w := range cpu.debug.watchpoints {
+		if w.Kind&kind != 0 && w.contains(addr) {
+			cpu.debug.watchHit = &Stop{Reason: StopWatchpoint, Addr: addr, Write: kind == WatchWrite}
+			return
+		}
+	}
+}
+
+// beforeInstruction checks for a breakpoint at PC, returning true if execution stopped
+func (cpu *CPU) beforeInstruction() bool {
+	if cpu.debug.resumed {
+		cpu.debug.resumed = false
+		return false
+	}
+	cond, ok := cpu.debug.breakpoints[cpu.pc]
+	if !ok {
+		return false
+	}
+	if cond == nil {
+		cpu.stop(Stop{Reason: StopBreakpoint})
+		return true
+	}
+	if cond.holds(cpu) {
+		cpu.stop(Stop{Reason: StopBreakpoint, Condition: *cond})
+		return true
+	}
+	return false
+}
+
+// afterInstruction checks for watchpoints, conditions and finished steps, returning true if execution stopped
+func (cpu *CPU) afterInstruction() bool {
+	stopped := false
+	if hit := cpu.debug.watchHit; hit != nil {
+		cpu.debug.watchHit = nil
+		cpu.stop(*hit)
+		stopped = true
+	}
+
+	// Every condition is updated, even after a stop, so one that became true doesn't fire again later
+	for _, c := range cpu.debug.conditions {
+		held := c.holds(cpu)
+		if held && !c.held && !stopped {
+			cpu.stop(Stop{Reason: StopCondition, Condition: c.Condition})
+			stopped = true
+		}
+		c.held = held
+	}
+	if stopped {
+		return true
+	}
+
+	switch cpu.debug.step {
+	case stepInstruction:
+		stopped = true
+	case stepOver:
+		stopped = cpu.pc == cpu.debug.stepPC && cpu.sp <= cpu.debug.stepSP
+	case stepOut:
+		stopped = cpu.sp < cpu.debug.stepSP
+	}
+	if stopped {
+		cpu.stop(Stop{Reason: StopStep})
+	}
+	return stopped
+}
+
+// reportStop calls the stop handler with any pending stop, the caller must not hold cpu.mu
+func (cpu *CPU) reportStop() {
+	cpu.mu.Lock()
+	pending, onStop := cpu.debug.pending, cpu.debug.onStop
+	cpu.debug.pending = nil
+	cpu.mu.Unlock()
+
+	if pending != nil && onStop != nil {
+		onStop(*pending)
+	}
+}
@@ -0,0 +1,148 @@
+package cpu
+
+import (
+	"math"
+	"testing"
+)
+
+// subroutine calls a subroutine at 0x206 forever, the subroutine sets V0 to 5 and stores it at I
+var subroutine = []uint8{
+	0xA3, 0x00, // 0x200 LD I, 0x300
+	0x22, 0x06, // 0x202 CALL 0x206
+	0x12, 0x02, // 0x204 JP 0x202
+	0x60, 0x05, // 0x206 LD V0, 5
+	0xF0, 0x55, // 0x208 LD [I], V0
+	0x00, 0xEE, // 0x20A RET
+}
+
+func newDebugCPU(t *testing.T) (*CPU, *[]Stop) {
+	cpu := NewCPU(QuirksVIP, WithInstructionsPerFrame(100))
+	cpu.LoadROM(subroutine)
+	cpu.SetHost(NopHost{})
+
+	stops := &[]Stop{}
+	cpu.SetStopHandler(func(stop Stop) { *stops = append(*stops, stop) })
+	return cpu, stops
+}
+
+func Test_debugBreakpoint(t *testing.T) {
+	cpu, stops := newDebugCPU(t)
+	cpu.SetBreakpoint(0x208)
+
+	cpu.RunFrame()
+	if !cpu.Paused() || len(*stops) != 1 || (*stops)[0].Reason != StopBreakpoint || (*stops)[0].PC != 0x208 {
+		t.Fatalf("should stop at the breakpoint before executing it, got %+v\n", *stops)
+	}
+	if cpu.v[0] != 5 || cpu.memory[0x300] != 0 {
+		t.Fatalf("instructions before the breakpoint should run and the one at it should not\n")
+	}
+
+	// Paused frames run nothing
+	cpu.RunFrame()
+	if cpu.pc != 0x208 {
+		t.Fatalf("a paused CPU should not execute, PC moved to 0x%X\n", cpu.pc)
+	}
+
+	// Resuming runs the instruction at the breakpoint, then stops on the next time around the loop
+	cpu.Resume()
+	cpu.RunFrame()
+	if cpu.memory[0x300] != 5 || len(*stops) != 2 || (*stops)[1].PC != 0x208 {
+		t.Fatalf("resuming should run through the breakpoint and stop at it again, got %+v\n", *stops)
+	}
+
+	cpu.ClearBreakpoint(0x208)
+	cpu.SetConditionalBreakpoint(0x206, Condition{Register: RegV0, Op: "!=", Value: 5})
+	cpu.Resume()
+	cpu.RunFrame()
+	if cpu.Paused() {
+		t.Fatalf("a conditional breakpoint should not stop while its condition is false\n")
+	}
+}
+
+func Test_debugStep(t *testing.T) {
+	cpu, stops := newDebugCPU(t)
+	cpu.SetBreakpoint(0x202)
+	cpu.RunFrame()
+
+	// Step over the call at 0x202, which runs the whole subroutine
+	cpu.StepOver()
+	cpu.RunFrame()
+	if cpu.pc != 0x204 || cpu.memory[0x300] != 5 {
+		t.Fatalf("step over should stop after the call returns, PC is 0x%X\n", cpu.pc)
+	}
+
+	// Step into the call, then step out of it
+	cpu.Step()
+	cpu.RunFrame()
+	cpu.Step()
+	cpu.RunFrame()
+	if cpu.pc != 0x206 || cpu.sp != 1 {
+		t.Fatalf("stepping should enter the subroutine, PC is 0x%X\n", cpu.pc)
+	}
+	if err := cpu.StepOut(); err != nil {
+		t.Fatalf("step out failed: %v\n", err)
+	}
+	cpu.RunFrame()
+	if cpu.pc != 0x204 || cpu.sp != 0 {
+		t.Fatalf("step out should stop after the subroutine returns, PC is 0x%X\n", cpu.pc)
+	}
+	if err := cpu.StepOut(); err == nil {
+		t.Fatalf("step out should fail outside a subroutine\n")
+	}
+
+	for _, stop := range (*stops)[1:] {
+		if stop.Reason != StopStep {
+			t.Fatalf("steps should stop with StopStep, got %v\n", stop.Reason)
+		}
+	}
+}
+
+func Test_debugWatchpointAndCondition(t *testing.T) {
+	cpu, stops := newDebugCPU(t)
+	cpu.AddWatchpoint(Watchpoint{Addr: 0x300, Kind: WatchWrite})
+
+	cpu.RunFrame()
+	stop := (*stops)[0]
+	if stop.Reason != StopWatchpoint || stop.Addr != 0x300 || !stop.Write || stop.PC != 0x20A {
+		t.Fatalf("should stop after the instruction that writes 0x300, got %+v\n", stop)
+	}
+
+	cpu.RemoveWatchpoint(Watchpoint{Addr: 0x300, Kind: WatchWrite})
+	cpu.SetRegister(RegV0, 0)
+	cpu.AddCondition(Condition{Register: RegV0, Op: "==", Value: 5})
+	cpu.Resume()
+	cpu.RunFrame()
+	stop = (*stops)[1]
+	if stop.Reason != StopCondition || stop.PC != 0x208 {
+		t.Fatalf("should stop once V0 becomes 5, got %+v\n", stop)
+	}
+
+	// The condition stays true, so it does not stop again
+	cpu.Resume()
+	cpu.RunFrame()
+	if cpu.Paused() {
+		t.Fatalf("a condition should only stop when it becomes true\n")
+	}
+}
+
+func Test_debugReadMemory(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM(subroutine)
+
+	tests := []struct {
+		addr uint16
+		n    int
+		want int
+	}{
+		{0x200, 4, 4},
+		{0xFFFE, 4, 2},
+		{0x200, -1, 0},
+		{1, math.MaxInt, 0xFFFF},
+		{0xFFFF, math.MaxInt, 1},
+	}
+	for _, test := range tests {
+		if got := len(cpu.ReadMemory(test.addr, test.n)); got != test.want {
+			t.Fatalf("reading %d bytes from 0x%X should return %d bytes, got %d\n", test.n, test.addr, test.want, got)
+		}
+	}
+}
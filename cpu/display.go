@@ -0,0 +1,206 @@
+package cpu
+
+import (
+	"hash/fnv"
+	"image"
+	"image/color"
+	"strings"
+)
+
+const (
+	LoResWidth  = 64  // Width of the display in low resolution mode
+	LoResHeight = 32  // Height of the display in low resolution mode
+	HiResWidth  = 128 // Width of the display in SUPER-CHIP high resolution mode
+	HiResHeight = 64  // Height of the display in SUPER-CHIP high resolution mode
+)
+
+// Frame is a snapshot of the display. Pixels is indexed [x][y] and is large enough for high resolution mode, only
+// the top left Width x Height pixels are in use. Each pixel is a bitmask of the XO-CHIP planes it is set in, so a
+// pixel is 0-3 and programs that never select a plane only use 0 and 1.
+type Frame struct {
+	Width  int
+	Height int
+	Pixels [HiResWidth][HiResHeight]uint8
+}
+
+// textPixels are the characters Text writes for each combination of planes
+const textPixels = ".123"
+
+// Text draws the frame as text, a line per row with a character per pixel: . when unset, otherwise the digit of the
+// planes it is set in
+func (f Frame) Text() string {
+	var b strings.Builder
+	b.Grow((f.Width + 1) * f.Height)
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			b.WriteByte(textPixels[f.Pixels[x][y]&0x3])
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Image draws the frame at one image pixel per display pixel, palette gives the colours for each combination of
+// planes and must have four entries
+func (f Frame) Image(palette color.Palette) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, f.Width, f.Height), palette)
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			img.SetColorIndex(x, y, f.Pixels[x][y]&0x3)
+		}
+	}
+	return img
+}
+
+// Hash returns a hash of the pixels in use, two frames that look the same have the same hash
+func (f Frame) Hash() uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{byte(f.Width), byte(f.Height)})
+	for x := 0; x < f.Width; x++ {
+		h.Write(f.Pixels[x][:f.Height])
+	}
+	return h.Sum64()
+}
+
+// bigFontAddr is where the SUPER-CHIP 8x10 font is loaded, straight after the 4x5 font
+const bigFontAddr = 0x50
+
+var bigFontset = [160]uint8{
+	0xFF, 0xFF, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, // 0
+	0x18, 0x78, 0x78, 0x18, 0x18, 0x18, 0x18, 0x18, 0xFF, 0xFF, // 1
+	0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // 2
+	0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 3
+	0xC3, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0x03, 0x03, 0x03, 0x03, // 4
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 5
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, // 6
+	0xFF, 0xFF, 0x03, 0x03, 0x06, 0x0C, 0x18, 0x18, 0x18, 0x18, // 7
+	0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, // 8
+	0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 9
+	0x7E, 0xFF, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, // A
+	0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, // B
+	0x3C, 0xFF, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0xFF, 0x3C, // C
+	0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC, // D
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // E
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0, // F
+}
+
+// width returns the width of the display in the current resolution mode
+func (cpu *CPU) width() int {
+	if cpu.hires {
+		return HiResWidth
+	}
+	return LoResWidth
+}
+
+// height returns the height of the display in the current resolution mode
+func (cpu *CPU) height() int {
+	if cpu.hires {
+		return HiResHeight
+	}
+	return LoResHeight
+}
+
+// Frame returns a copy of the display, it is safe to call while the CPU is running
+func (cpu *CPU) Frame() Frame {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	return cpu.frame()
+}
+
+// frame returns a copy of the display
+func (cpu *CPU) frame() Frame {
+	return Frame{
+		Width:  cpu.width(),
+		Height: cpu.height(),
+		Pixels: cpu.gfx,
+	}
+}
+
+// drawSprite XORs a sprite that is width pixels wide (8 or 16) and rows tall onto the selected planes at (vx, vy),
+// reading it from memory at I. When both planes are selected the data for plane 2 follows straight on from the data
+// for plane 1. VF is set to 1 if any pixel is flipped from set to unset. The starting coordinate always wraps around
+// the screen, the ClipSprites quirk decides whether the rest of the sprite wraps or is clipped
+func (cpu *CPU) drawSprite(vx, vy uint8, width, rows int) {
+	w, h := cpu.width(), cpu.height()
+	x0 := int(vx) % w
+	y0 := int(vy) % h
+	rowBytes := width / 8
+	addr := cpu.i
+
+	// Reset collision flag
+	cpu.v[0xF] = 0
+
+	for _, plane := range []uint8{0x1, 0x2} {
+		if cpu.plane&plane == 0 {
+			continue
+		}
+
+		for row := 0; row < rows; row++ {
+			// Fetch sprite row, 16 pixel wide sprites are stored as two bytes per row. Addresses wrap around memory
+			spriteRow := uint16(cpu.read(addr))
+			if rowBytes == 2 {
+				spriteRow = spriteRow<<8 | uint16(cpu.read(addr+1))
+			}
+			addr += uint16(rowBytes)
+
+			for col := 0; col < width; col++ {
+				// Check if the bit at (col) is set
+				if spriteRow&(1<<(width-1-col)) == 0 {
+					continue
+				}
+
+				px := x0 + col
+				py := y0 + row
+				if cpu.quirks.ClipSprites && (px >= w || py >= h) {
+					continue
+				}
+
+				// Wrap coordinates
+				px %= w
+				py %= h
+
+				// Check for collision
+				if cpu.gfx[px][py]&plane != 0 {
+					cpu.v[0xF] = 1 // Set collision flag
+				}
+
+				// XOR the pixel
+				cpu.gfx[px][py] ^= plane
+			}
+		}
+	}
+
+	// Set draw flag to refresh screen
+	cpu.drawFlag = true
+}
+
+// clear unsets every pixel in the selected planes
+func (cpu *CPU) clear() {
+	for x := range cpu.gfx {
+		for y := range cpu.gfx[x] {
+			cpu.gfx[x][y] &^= cpu.plane
+		}
+	}
+	cpu.drawFlag = true
+}
+
+// scroll moves the contents of the selected planes by (dx, dy) pixels, pixels moved off screen are lost and the
+// space left behind is cleared
+func (cpu *CPU) scroll(dx, dy int) {
+	w, h := cpu.width(), cpu.height()
+	scrolled := cpu.gfx
+
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			var moved uint8
+			sx, sy := x-dx, y-dy
+			if sx >= 0 && sx < w && sy >= 0 && sy < h {
+				moved = cpu.gfx[sx][sy] & cpu.plane
+			}
+			scrolled[x][y] = scrolled[x][y]&^cpu.plane | moved
+		}
+	}
+
+	cpu.gfx = scrolled
+	cpu.drawFlag = true
+}
@@ -0,0 +1,98 @@
+package cpu
+
+import (
+	"bytes"
+	"flag"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden frames in testdata from the current output")
+
+// goldenPalette colours golden PNGs, it is greyscale so the files stay small
+var goldenPalette = color.Palette{
+	color.Gray{Y: 0x00},
+	color.Gray{Y: 0xFF},
+	color.Gray{Y: 0xAA},
+	color.Gray{Y: 0x55},
+}
+
+// runROM loads a ROM from the roms directory and runs it for frames frames
+func runROM(t *testing.T, name string, quirks Quirks, frames int) *CPU {
+	rom, err := os.ReadFile(filepath.Join("..", "roms", name))
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	cpu := NewCPU(quirks)
+	cpu.SetHost(NopHost{})
+	if err := cpu.LoadROM(rom); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	for n := 0; n < frames; n++ {
+		cpu.runFrame()
+	}
+	return cpu
+}
+
+// checkGolden compares the display against testdata/name, a .txt file written by Frame.Text or a .png written by
+// Frame.Image with goldenPalette. Run the tests with -update to write the files
+func checkGolden(t *testing.T, cpu *CPU, name string) {
+	t.Helper()
+	frame := cpu.frame()
+	path := filepath.Join("testdata", name)
+
+	var got []byte
+	if filepath.Ext(name) == ".png" {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, frame.Image(goldenPalette)); err != nil {
+			t.Fatalf("unexpected error: %v\n", err)
+		}
+		got = buf.Bytes()
+	} else {
+		got = []byte(frame.Text())
+	}
+
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("unexpected error: %v\n", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read golden frame, run with -update to create it: %v\n", err)
+	}
+	if filepath.Ext(name) != ".png" {
+		if string(want) != string(got) {
+			t.Fatalf("display does not match %s, got\n%s", path, got)
+		}
+		return
+	}
+
+	// PNGs are compared by pixel, so files written by other encoders still match
+	img, err := png.Decode(bytes.NewReader(want))
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if img.Bounds().Dx() != frame.Width || img.Bounds().Dy() != frame.Height {
+		t.Fatalf("display is %dx%d but %s is %dx%d\n", frame.Width, frame.Height, path, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	for y := 0; y < frame.Height; y++ {
+		for x := 0; x < frame.Width; x++ {
+			wantIndex := uint8(goldenPalette.Index(img.At(x, y)))
+			if frame.Pixels[x][y]&0x3 != wantIndex {
+				t.Fatalf("pixel (%d, %d) is %d but %s has %d, got\n%s", x, y, frame.Pixels[x][y], path, wantIndex, frame.Text())
+			}
+		}
+	}
+}
+
+func Test_romIBM(t *testing.T) {
+	cpu := runROM(t, "ibm.ch8", QuirksVIP, 60)
+	checkGolden(t, cpu, "ibm.txt")
+	checkGolden(t, cpu, "ibm.png")
+}
@@ -0,0 +1,94 @@
+package cpu
+
+import (
+	"context"
+	"time"
+)
+
+// Host is the frontend a machine runs on: a window, a terminal, a web page, a test. It shows the display, plays the
+// sound, supplies the keypad and paces the frames, so frontends can be swapped without the machine knowing
+type Host interface {
+	// Present shows the display, it is called at the end of each frame the display changed in. The resolution can
+	// change from one frame to the next, and each pixel is the bitmask of the planes it is set in. It is called with
+	// cpu.mu held
+	Present(frame Frame) error
+	// PollInput updates keys with the keypad before each frame, hosts without a keypad leave keys alone so keys set
+	// with SetKey stay down. It is called with cpu.mu held
+	PollInput(keys *[16]bool)
+	// Audio returns where to send the sound and the sample rate to generate it at, a nil sink keeps the machine
+	// quiet. It is called once, by SetHost
+	Audio() (sink AudioSink, sampleRate int)
+	// WaitFrame blocks until the next frame is due and reports whether the machine should carry on, Run returns once
+	// it reports false. Hosts with vsync can wait for it, others embed RealTime or Unpaced
+	WaitFrame(ctx context.Context) bool
+}
+
+// SetHost connects the machine to a frontend, it must be called before Run. A nil host prints the display to stdout
+func (cpu *CPU) SetHost(host Host) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	cpu.host = host
+	var sink AudioSink
+	var sampleRate int
+	if host != nil {
+		sink, sampleRate = host.Audio()
+	}
+	cpu.setAudioSink(sink, sampleRate)
+}
+
+// RealTime paces frames at 60Hz. Each frame is scheduled against the time the first frame started rather than the
+// end of the previous frame, so the timers stay at a true 60Hz and time lost to a slow frame is made up over the
+// following frames
+type RealTime struct {
+	start  time.Time
+	frames int64 // Frames since start
+	timer  *time.Timer
+}
+
+// WaitFrame waits until the next frame is due, or ctx is cancelled
+func (c *RealTime) WaitFrame(ctx context.Context) bool {
+	now := time.Now()
+	if c.timer == nil {
+		c.start = now
+		c.timer = time.NewTimer(0)
+	} else {
+		c.frames++
+		next := c.start.Add(time.Duration(c.frames) * frameDuration)
+		if now.Sub(next) > maxFrameLag {
+			// We have fallen too far behind (e.g. the process was suspended), rather than racing to catch up start
+			// scheduling from now
+			c.start = now
+			c.frames = 0
+			next = now
+		}
+		c.timer.Reset(next.Sub(now))
+	}
+
+	select {
+	case <-ctx.Done():
+		c.timer.Stop()
+		return false
+	case <-c.timer.C:
+		return true
+	}
+}
+
+// Unpaced runs frames as fast as the machine can execute them, for headless runs and tests
+type Unpaced struct{}
+
+// WaitFrame returns straight away, unless ctx is cancelled
+func (Unpaced) WaitFrame(ctx context.Context) bool {
+	return ctx.Err() == nil
+}
+
+// NopHost shows nothing, plays nothing, leaves the keypad alone and runs unpaced. Hosts embed it for the parts they
+// don't support
+type NopHost struct {
+	Unpaced
+}
+
+func (NopHost) Present(frame Frame) error { return nil }
+
+func (NopHost) PollInput(keys *[16]bool) {}
+
+func (NopHost) Audio() (AudioSink, int) { return nil, 0 }
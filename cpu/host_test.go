@@ -0,0 +1,69 @@
+package cpu
+
+import (
+	"context"
+	"testing"
+)
+
+// testHost holds key 5 down, counts what it is shown and closes after a number of frames
+type testHost struct {
+	frames   int
+	presents []Frame
+	sink     samples
+}
+
+func (h *testHost) Present(frame Frame) error {
+	h.presents = append(h.presents, frame)
+	return nil
+}
+
+func (h *testHost) PollInput(keys *[16]bool) {
+	keys[0x5] = true
+}
+
+func (h *testHost) Audio() (AudioSink, int) {
+	return &h.sink, 600
+}
+
+func (h *testHost) WaitFrame(ctx context.Context) bool {
+	h.frames--
+	return h.frames >= 0
+}
+
+func Test_runHost(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{
+		0x60, 0x05, // LD V0, 5
+		0xE0, 0xA1, // SKNP V0
+		0x00, 0xE0, // CLS
+		0x12, 0x06, // JP 0x206
+	})
+	host := &testHost{frames: 3}
+	cpu.SetHost(host)
+	cpu.Run(context.Background())
+
+	if len(host.sink) != 3 {
+		t.Fatalf("should run 3 frames before the host closes, ran %d\n", len(host.sink))
+	}
+	if len(host.sink[0]) != 10 {
+		t.Fatalf("should generate sound at the host's sample rate, generated %d samples a frame\n", len(host.sink[0]))
+	}
+	if len(host.presents) != 1 {
+		t.Fatalf("should present the display once, after CLS, presented %d times\n", len(host.presents))
+	}
+	if frame := host.presents[0]; frame.Width != LoResWidth || frame.Height != LoResHeight {
+		t.Fatalf("should present a low resolution display, was %dx%d\n", frame.Width, frame.Height)
+	}
+}
+
+func Test_realTimeCancel(t *testing.T) {
+	var clock RealTime
+	ctx, cancel := context.WithCancel(context.Background())
+	if !clock.WaitFrame(ctx) {
+		t.Fatalf("the first frame should start straight away\n")
+	}
+	cancel()
+	if clock.WaitFrame(ctx) {
+		t.Fatalf("should stop once the context is cancelled\n")
+	}
+}
@@ -2,23 +2,73 @@ package cpu
 
 import (
 	"fmt"
-	rand2 "math/rand"
+	"os"
 )
 
-// Op00E0 - Clear screen
+// Op00CN - Scrolls the display down N pixels
+func Op00CN(cpu *CPU) {
+	n := int(cpu.opcode & 0x000F) // Fetch N from the opcode
+
+	cpu.scroll(0, n)
+	cpu.pc += 2
+}
+
+// Op00DN - Scrolls the display up N pixels
+func Op00DN(cpu *CPU) {
+	n := int(cpu.opcode & 0x000F) // Fetch N from the opcode
+
+	cpu.scroll(0, -n)
+	cpu.pc += 2
+}
+
+// Op00E0 - Clear screen, only the selected planes are cleared
 func Op00E0(cpu *CPU) {
-	cpu.gfx = [64][32]uint8{}
+	cpu.clear()
 	cpu.pc += 2
 }
 
 // Op00EE - Returns from a subroutine
 func Op00EE(cpu *CPU) {
 	if cpu.sp == 0 {
-		fmt.Println("Stack underflow!")
+		fmt.Fprintln(os.Stderr, "Stack underflow!")
 		return // Prevent underflow
 	}
 	cpu.sp--                   // Decrement the stack pointer so we are at the "top" of the stack
 	cpu.pc = cpu.stack[cpu.sp] // Set the PC to the value in at the "top" of the stack
+	cpu.pc += 2                // The stack holds the address of the call itself, so step over it
+}
+
+// Op00FB - Scrolls the display right 4 pixels
+func Op00FB(cpu *CPU) {
+	cpu.scroll(4, 0)
+	cpu.pc += 2
+}
+
+// Op00FC - Scrolls the display left 4 pixels
+func Op00FC(cpu *CPU) {
+	cpu.scroll(-4, 0)
+	cpu.pc += 2
+}
+
+// Op00FD - Exits the interpreter, the program counter is left on this instruction
+func Op00FD(cpu *CPU) {
+	cpu.halted = true
+}
+
+// Op00FE - Switches to 64x32 low resolution mode, clearing the screen
+func Op00FE(cpu *CPU) {
+	cpu.hires = false
+	cpu.gfx = [HiResWidth][HiResHeight]uint8{}
+	cpu.drawFlag = true
+	cpu.pc += 2
+}
+
+// Op00FF - Switches to 128x64 high resolution mode, clearing the screen
+func Op00FF(cpu *CPU) {
+	cpu.hires = true
+	cpu.gfx = [HiResWidth][HiResHeight]uint8{}
+	cpu.drawFlag = true
+	cpu.pc += 2
 }
 
 // Op1NNN - Jumps to address NNN
@@ -29,7 +79,7 @@ func Op1NNN(cpu *CPU) {
 // Op2NNN - Calls subroutine at NNN
 func Op2NNN(cpu *CPU) {
 	if cpu.sp >= uint16(len(cpu.stack)) {
-		fmt.Println("Stack overflow")
+		fmt.Fprintln(os.Stderr, "Stack overflow")
 		return // Prevent overflow
 	}
 	cpu.stack[cpu.sp] = cpu.pc   // Store the program counter value in the stack at the current stack pointer
@@ -43,7 +93,7 @@ func Op3XNN(cpu *CPU) {
 	nn := uint8(cpu.opcode & 0x00FF) // Fetch NN from the opcode
 	vx := cpu.v[x]
 	if vx == nn {
-		cpu.pc += 2
+		cpu.skip()
 	}
 	cpu.pc += 2
 }
@@ -54,7 +104,7 @@ func Op4XNN(cpu *CPU) {
 	nn := uint8(cpu.opcode & 0x00FF) // Fetch NN from the opcode
 	vx := cpu.v[x]
 	if vx != nn {
-		cpu.pc += 2
+		cpu.skip()
 	}
 	cpu.pc += 2
 }
@@ -68,12 +118,50 @@ func Op5XY0(cpu *CPU) {
 	vy := cpu.v[y]
 
 	if vx == vy {
-		cpu.pc += 2
+		cpu.skip()
 	}
 
 	cpu.pc += 2
 }
 
+// Op5XY2 - Stores VX to VY in memory starting at address I, in descending order if X is greater than Y. I is not modified
+func Op5XY2(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+	y := (cpu.opcode & 0x00F0) >> 4 // Fetch Y from the opcode, shift it 4 bits so its in the most significant bit
+
+	for n, r := range registerRange(x, y) {
+		cpu.write(cpu.i+uint16(n), cpu.v[r])
+	}
+	cpu.pc += 2
+}
+
+// Op5XY3 - Fills VX to VY with values from memory starting at address I, in descending order if X is greater than Y. I is not modified
+func Op5XY3(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+	y := (cpu.opcode & 0x00F0) >> 4 // Fetch Y from the opcode, shift it 4 bits so its in the most significant bit
+
+	for n, r := range registerRange(x, y) {
+		cpu.v[r] = cpu.read(cpu.i + uint16(n))
+	}
+	cpu.pc += 2
+}
+
+// registerRange returns the registers from x to y inclusive, counting down if x is greater than y
+func registerRange(x, y uint16) []uint16 {
+	var r []uint16
+	for {
+		r = append(r, x)
+		if x == y {
+			return r
+		}
+		if x < y {
+			x++
+		} else {
+			x--
+		}
+	}
+}
+
 // Op6XNN - Sets VX to NN.
 func Op6XNN(cpu *CPU) {
 	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
@@ -107,6 +195,9 @@ func Op8XY1(cpu *CPU) {
 	y := (cpu.opcode & 0x00F0) >> 4 // Fetch Y from the opcode, shift it 4 bits so its in the most significant bit
 
 	cpu.v[x] = cpu.v[x] | cpu.v[y]
+	if cpu.quirks.LogicResetsVF {
+		cpu.v[0xF] = 0
+	}
 	cpu.pc += 2
 }
 
@@ -116,6 +207,9 @@ func Op8XY2(cpu *CPU) {
 	y := (cpu.opcode & 0x00F0) >> 4 // Fetch Y from the opcode, shift it 4 bits so its in the most significant bit
 
 	cpu.v[x] = cpu.v[x] & cpu.v[y]
+	if cpu.quirks.LogicResetsVF {
+		cpu.v[0xF] = 0
+	}
 	cpu.pc += 2
 }
 
@@ -125,6 +219,9 @@ func Op8XY3(cpu *CPU) {
 	y := (cpu.opcode & 0x00F0) >> 4 // Fetch Y from the opcode, shift it 4 bits so its in the most significant bit
 
 	cpu.v[x] = cpu.v[x] ^ cpu.v[y]
+	if cpu.quirks.LogicResetsVF {
+		cpu.v[0xF] = 0
+	}
 	cpu.pc += 2
 }
 
@@ -136,12 +233,13 @@ func Op8XY4(cpu *CPU) {
 	// If VY is greater than the result of 255 - VY then there is an overflow, and we should set the carry to 1
 	// The registers are 8 bits, by doing 255 minus VY we are calculating how much "remaining space" there is
 	// in the register so we can determine if there will be an overflow
+	var carry uint8
 	if cpu.v[y] > (0xFF - cpu.v[x]) {
-		cpu.v[0xF] = 1 // Set carry to 1
-	} else {
-		cpu.v[0xF] = 0
+		carry = 1 // Set carry to 1
 	}
+	// VF is written last so the flag wins when X is F
 	cpu.v[x] += cpu.v[y]
+	cpu.v[0xF] = carry
 	cpu.pc += 2
 }
 
@@ -150,23 +248,29 @@ func Op8XY5(cpu *CPU) {
 	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
 	y := (cpu.opcode & 0x00F0) >> 4 // Fetch Y from the opcode, shift it 4 bits so its in the most significant bit
 
+	var carry uint8
 	if cpu.v[x] >= cpu.v[y] {
-		cpu.v[0xF] = 1 // Set carry to 1
-	} else {
-		cpu.v[0xF] = 0
+		carry = 1 // Set carry to 1
 	}
 	cpu.v[x] -= cpu.v[y]
+	cpu.v[0xF] = carry
 	cpu.pc += 2
 }
 
-// Op8XY6 - Shifts VX to the right by 1, then stores the least significant bit of VX prior to the shift into VF
+// Op8XY6 - Shifts VX to the right by 1, then stores the least significant bit of VX prior to the shift into VF.
+// With the ShiftVY quirk VY is shifted instead and the result stored in VX
 func Op8XY6(cpu *CPU) {
 	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+	y := (cpu.opcode & 0x00F0) >> 4 // Fetch Y from the opcode, shift it 4 bits so its in the most significant bit
+
+	src := cpu.v[x]
+	if cpu.quirks.ShiftVY {
+		src = cpu.v[y]
+	}
 
-	// Store the least significant bit in VF
-	cpu.v[0xF] = cpu.v[x] & 0x01
-	// Shift VX to the right
-	cpu.v[x] = cpu.v[x] >> 0x0001
+	// Shift to the right, then store the least significant bit in VF. VF is written last so the flag wins when X is F
+	cpu.v[x] = src >> 1
+	cpu.v[0xF] = src & 0x01
 
 	cpu.pc += 2
 }
@@ -176,22 +280,28 @@ func Op8XY7(cpu *CPU) {
 	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
 	y := (cpu.opcode & 0x00F0) >> 4 // Fetch Y from the opcode, shift it 4 bits so its in the most significant bit
 
+	var carry uint8
 	if cpu.v[y] >= cpu.v[x] {
-		cpu.v[0xF] = 1
-	} else {
-		cpu.v[0xF] = 0
+		carry = 1
 	}
-
 	cpu.v[x] = cpu.v[y] - cpu.v[x]
+	cpu.v[0xF] = carry
 	cpu.pc += 2
 }
 
-// Op8XYE - Shifts VX to the left by 1, then sets VF to 1 if the most significant bit of VX prior to that shift was set, or to 0 if it was unset
+// Op8XYE - Shifts VX to the left by 1, then sets VF to 1 if the most significant bit of VX prior to that shift was set, or to 0 if it was unset.
+// With the ShiftVY quirk VY is shifted instead and the result stored in VX
 func Op8XYE(cpu *CPU) {
 	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+	y := (cpu.opcode & 0x00F0) >> 4 // Fetch Y from the opcode, shift it 4 bits so its in the most significant bit
+
+	src := cpu.v[x]
+	if cpu.quirks.ShiftVY {
+		src = cpu.v[y]
+	}
 
-	cpu.v[0xF] = (cpu.v[x] & 0x80) >> 7 // Set VF to the most significant bit of VX (prior to the shift)
-	cpu.v[x] <<= 1                      // Shift VX left by 1
+	cpu.v[x] = src << 1            // Shift left by 1
+	cpu.v[0xF] = (src & 0x80) >> 7 // Set VF to the most significant bit (prior to the shift)
 
 	cpu.pc += 2
 }
@@ -202,7 +312,7 @@ func Op9XY0(cpu *CPU) {
 	y := (cpu.opcode & 0x00F0) >> 4 // Fetch Y from the opcode, shift it 4 bits so its in the most significant bit
 
 	if cpu.v[x] != cpu.v[y] {
-		cpu.pc += 2
+		cpu.skip()
 	}
 
 	cpu.pc += 2
@@ -214,64 +324,100 @@ func OpANNN(cpu *CPU) {
 	cpu.pc += 2                 // Increment the program counter by two
 }
 
-// OpBNNN - Jumps to the address NNN plus V0
+// OpBNNN - Jumps to the address NNN plus V0. With the JumpVX quirk this is BXNN, which jumps to XNN plus VX
 func OpBNNN(cpu *CPU) {
 	nnn := cpu.opcode & 0x0FFF // Use the mask 0x0FFF to extract NNN
-	v0 := cpu.v[0x0]           // Fetch V0
-	cpu.pc = nnn + uint16(v0)  // Set the program counter to the address NNN plus V0
-	cpu.pc += 2                // Increment the program counter by two
+	offset := cpu.v[0x0]       // Fetch V0
+	if cpu.quirks.JumpVX {
+		offset = cpu.v[(cpu.opcode&0x0F00)>>8] // Fetch VX, X being the highest nibble of NNN
+	}
+	cpu.pc = nnn + uint16(offset) // Set the program counter to the address NNN plus the offset
 }
 
-// OpCXNN - Sets VX to the result of a bitwise and operation on a random number (Typically: 0 to 255) and NN.
+// OpCXNN - Sets VX to the result of a bitwise and operation on a random number (0 to 255) and NN.
 func OpCXNN(cpu *CPU) {
 	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
 	nn := cpu.opcode & 0x00FF       // Use the make 0x0FF to extract NN
-	rand := rand2.Intn(255)
+	rand := uint8(cpu.rng.Next())
 
-	cpu.v[x] = uint8(nn & uint16(rand))
+	cpu.v[x] = uint8(nn) & rand
 	cpu.pc += 2
 }
 
 // OpDXYN - Draws a sprite at coordinate (VX, VY) that has a width of 8 pixels and a height of N pixels.
 // Each row of 8 pixels is read as bit-coded starting from memory location I; I value does not change after the execution of this instruction.
-// As described above, VF is set to 1 if any screen pixels are flipped from set to unset when the sprite is drawn, and to 0 if that does not happen
+// As described above, VF is set to 1 if any screen pixels are flipped from set to unset when the sprite is drawn, and to 0 if that does not happen.
+// The starting coordinate always wraps around the screen, the ClipSprites quirk decides whether the rest of the sprite wraps or is clipped
 func OpDXYN(cpu *CPU) {
-	vx := cpu.v[(cpu.opcode&0x0F00)>>8]   // VX (x-coordinate from register)
-	vy := cpu.v[(cpu.opcode&0x00F0)>>4]   // VY (y-coordinate from register)
-	numRows := uint8(cpu.opcode & 0x000F) // Height (N)
-
-	// Reset collision flag
-	cpu.v[0xF] = 0
-
-	for row := uint8(0); row < numRows; row++ {
-		// Ensure memory access is within bounds
-		if int(cpu.i)+int(row) >= len(cpu.memory) {
-			fmt.Printf("Memory access out of bounds at I=0x%X, row %d\n", cpu.i, row)
-			break
-		}
+	vx := cpu.v[(cpu.opcode&0x0F00)>>8] // VX (x-coordinate from register)
+	vy := cpu.v[(cpu.opcode&0x00F0)>>4] // VY (y-coordinate from register)
+	numRows := int(cpu.opcode & 0x000F) // Height (N)
+
+	cpu.drawSprite(vx, vy, 8, numRows)
 
-		spriteRow := cpu.memory[cpu.i+uint16(row)] // Fetch sprite row
-		for col := uint8(0); col < 8; col++ {
-			// Check if the bit at (col) is set
-			if (spriteRow & (0x80 >> col)) != 0 {
+	if cpu.quirks.DisplayWait {
+		cpu.vblankWait = true
+	}
+	cpu.pc += 2
+}
 
-				// Wrap coordinates
-				px := (vx + col) % 64
-				py := (vy + row) % 32
+// OpDXY0 - Draws a 16x16 sprite at coordinate (VX, VY). Each row is two bytes starting from memory location I, otherwise it behaves as DXYN
+func OpDXY0(cpu *CPU) {
+	vx := cpu.v[(cpu.opcode&0x0F00)>>8] // VX (x-coordinate from register)
+	vy := cpu.v[(cpu.opcode&0x00F0)>>4] // VY (y-coordinate from register)
 
-				// Check for collision
-				if cpu.gfx[px][py] == 1 {
-					cpu.v[0xF] = 1 // Set collision flag
-				}
+	cpu.drawSprite(vx, vy, 16, 16)
 
-				// XOR the pixel
-				cpu.gfx[px][py] ^= 1
-			}
-		}
+	if cpu.quirks.DisplayWait {
+		cpu.vblankWait = true
 	}
+	cpu.pc += 2
+}
 
-	// Set draw flag to refresh screen
-	cpu.drawFlag = true
+// OpF000 - Sets I to the 16-bit address NNNN stored in the two bytes following the instruction, this is the only four byte instruction
+func OpF000(cpu *CPU) {
+	cpu.i = uint16(cpu.memory[cpu.pc+2])<<8 | uint16(cpu.memory[cpu.pc+3])
+	cpu.pc += 4
+}
+
+// OpFN01 - Selects the drawing planes by bitmask N, plane 1 is bit 0 and plane 2 is bit 1
+func OpFN01(cpu *CPU) {
+	n := uint8((cpu.opcode & 0x0F00) >> 8) // Fetch N from the opcode, shift it 8 bits so its in the most significant bit
+
+	cpu.plane = n & 0x3 // Only two planes exist
+	cpu.pc += 2
+}
+
+// OpF002 - Loads the 16 byte XO-CHIP audio pattern from memory starting at I, the buzzer plays it from then on
+func OpF002(cpu *CPU) {
+	for n := range cpu.pattern {
+		cpu.pattern[n] = cpu.read(cpu.i + uint16(n))
+	}
+	cpu.hasPattern = true
+	cpu.pc += 2
+}
+
+// OpFX07 - Sets VX to the value of the delay timer
+func OpFX07(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+
+	cpu.v[x] = cpu.delayTimer
+	cpu.pc += 2
+}
+
+// OpFX15 - Sets the delay timer to VX
+func OpFX15(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+
+	cpu.delayTimer = cpu.v[x]
+	cpu.pc += 2
+}
+
+// OpFX18 - Sets the sound timer to VX
+func OpFX18(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+
+	cpu.soundTimer = cpu.v[x]
 	cpu.pc += 2
 }
 
@@ -285,12 +431,133 @@ func OpFX1E(cpu *CPU) {
 	cpu.pc += 2
 }
 
+// OpFX30 - Sets I to the location of the sprite for the character in VX using the SUPER-CHIP 8x10 font
+func OpFX30(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+	digit := cpu.v[x] & 0x0F        // Only the lowest nibble selects a character
+
+	cpu.i = bigFontAddr + uint16(digit)*10 // Each character in the big font is 10 bytes tall
+	cpu.pc += 2
+}
+
 // OpFX33 - Stores the binary-coded decimal representation of VX, with the hundreds digit in memory at location in I, the tens digit at location I+1, and the ones digit at location I+2.
 func OpFX33(cpu *CPU) {
 	x := uint8((cpu.opcode & 0x0F00) >> 8)
 	vx := cpu.v[x]
-	cpu.memory[cpu.i] = vx / 100
-	cpu.memory[cpu.i+1] = (vx / 10) % 10
-	cpu.memory[cpu.i+2] = vx % 10
+	cpu.write(cpu.i, vx/100)
+	cpu.write(cpu.i+1, (vx/10)%10)
+	cpu.write(cpu.i+2, vx%10)
+	cpu.pc += 2
+}
+
+// OpFX3A - Sets the XO-CHIP audio pitch to VX, the pattern plays at 4000*2^((VX-64)/48) samples per second
+func OpFX3A(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+
+	cpu.pitch = cpu.v[x]
+	cpu.pc += 2
+}
+
+// OpEX9E - Skips the next instruction if the key stored in VX is pressed
+func OpEX9E(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+	key := cpu.v[x] & 0x0F          // Only the lowest nibble addresses a key
+
+	if cpu.keys[key] {
+		cpu.skip()
+	}
+	cpu.pc += 2
+}
+
+// OpEXA1 - Skips the next instruction if the key stored in VX is not pressed
+func OpEXA1(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+	key := cpu.v[x] & 0x0F          // Only the lowest nibble addresses a key
+
+	if !cpu.keys[key] {
+		cpu.skip()
+	}
+	cpu.pc += 2
+}
+
+// OpFX0A - Waits for a key to be pressed and released, then stores it in VX.
+// This is a blocking operation, the program counter is not advanced until the key is released so the
+// instruction is executed again on the next cycle. Timers keep counting down while we wait.
+func OpFX0A(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+
+	if !cpu.keyWaiting {
+		// Look for a key going down
+		for k, down := range cpu.keys {
+			if down {
+				cpu.keyWaiting = true
+				cpu.keyHeld = uint8(k)
+				break
+			}
+		}
+		return
+	}
+
+	if cpu.keys[cpu.keyHeld] {
+		return // Still held, keep waiting for the release
+	}
+
+	cpu.v[x] = cpu.keyHeld
+	cpu.keyWaiting = false
+	cpu.pc += 2
+}
+
+// OpFX29 - Sets I to the location of the sprite for the character in VX. Characters 0-F (in hexadecimal) are represented by a 4x5 font
+func OpFX29(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+	digit := cpu.v[x] & 0x0F        // Only the lowest nibble selects a character
+
+	cpu.i = uint16(digit) * 5 // The fontset is loaded at 0x000 and each character is 5 bytes tall
+	cpu.pc += 2
+}
+
+// OpFX55 - Stores from V0 to VX (including VX) in memory, starting at address I. I is only modified with the LoadStoreIncI quirk
+func OpFX55(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+
+	for r := uint16(0); r <= x; r++ {
+		cpu.write(cpu.i+r, cpu.v[r])
+	}
+	if cpu.quirks.LoadStoreIncI {
+		cpu.i += x + 1
+	}
+	cpu.pc += 2
+}
+
+// OpFX65 - Fills from V0 to VX (including VX) with values from memory, starting at address I. I is only modified with the LoadStoreIncI quirk
+func OpFX65(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+
+	for r := uint16(0); r <= x; r++ {
+		cpu.v[r] = cpu.read(cpu.i + r)
+	}
+	if cpu.quirks.LoadStoreIncI {
+		cpu.i += x + 1
+	}
+	cpu.pc += 2
+}
+
+// OpFX75 - Stores from V0 to VX (including VX) in the RPL user flags
+func OpFX75(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+
+	for r := uint16(0); r <= x; r++ {
+		cpu.rpl[r] = cpu.v[r]
+	}
+	cpu.pc += 2
+}
+
+// OpFX85 - Fills from V0 to VX (including VX) with values from the RPL user flags
+func OpFX85(cpu *CPU) {
+	x := (cpu.opcode & 0x0F00) >> 8 // Fetch X from the opcode, shift it 8 bits so its in the most significant bit
+
+	for r := uint16(0); r <= x; r++ {
+		cpu.v[r] = cpu.rpl[r]
+	}
 	cpu.pc += 2
 }
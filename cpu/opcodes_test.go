@@ -5,7 +5,7 @@ import (
 )
 
 func Test_op2NNN(t *testing.T) {
-	cpu := NewCPU()
+	cpu := NewCPU(QuirksVIP)
 	cpu.LoadROM([]uint8{0x24, 0x00})
 
 	currentPC := cpu.pc
@@ -25,7 +25,7 @@ func Test_op2NNN(t *testing.T) {
 }
 
 func Test_op8XY4(t *testing.T) {
-	cpu := NewCPU()
+	cpu := NewCPU(QuirksVIP)
 	cpu.LoadROM([]uint8{
 		0x80, 0x14,
 		0x82, 0x34,
@@ -68,8 +68,30 @@ func Test_op8XY4(t *testing.T) {
 	}
 }
 
+func Test_op8XY5FlagWins(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{
+		0x8F, 0x05,
+		0x8F, 0x07,
+	})
+
+	// 0 - 1 borrows, so VF holds the flag 0 rather than the result 0xFF
+	cpu.v[0xF] = 0
+	cpu.v[0x0] = 1
+	cpu.cycle()
+	if cpu.v[0xF] != 0 {
+		t.Fatalf("VF should hold the flag when X is F, was 0x%X\n", cpu.v[0xF])
+	}
+
+	// 1 - 0 does not borrow
+	cpu.cycle()
+	if cpu.v[0xF] != 1 {
+		t.Fatalf("VF should hold the flag when X is F, was 0x%X\n", cpu.v[0xF])
+	}
+}
+
 func Test_opANNN(t *testing.T) {
-	cpu := NewCPU()
+	cpu := NewCPU(QuirksVIP)
 	cpu.LoadROM([]uint8{0xA4, 0x00})
 
 	currentPC := cpu.pc
@@ -85,7 +107,7 @@ func Test_opANNN(t *testing.T) {
 }
 
 func Test_opFX33(t *testing.T) {
-	cpu := NewCPU()
+	cpu := NewCPU(QuirksVIP)
 	cpu.LoadROM([]uint8{0xF0, 0x33})
 
 	cpu.v[0x0] = 0xFF
@@ -107,3 +129,235 @@ func Test_opFX33(t *testing.T) {
 		t.Fatalf("memory at 2 should be 5")
 	}
 }
+
+func Test_opEX9E(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{
+		0xE0, 0x9E,
+		0xE0, 0x9E,
+	})
+
+	cpu.v[0x0] = 0xA
+
+	currentPC := cpu.pc
+	cpu.cycle()
+	if cpu.pc != currentPC+2 {
+		t.Fatalf("should not skip when key is up, pc was 0x%X\n", cpu.pc)
+	}
+
+	cpu.SetKey(0xA, true)
+	currentPC = cpu.pc
+	cpu.cycle()
+	if cpu.pc != currentPC+4 {
+		t.Fatalf("should skip when key is down, pc was 0x%X\n", cpu.pc)
+	}
+}
+
+func Test_opEXA1(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{
+		0xE0, 0xA1,
+		0xE0, 0xA1,
+	})
+
+	cpu.v[0x0] = 0x3
+
+	currentPC := cpu.pc
+	cpu.cycle()
+	if cpu.pc != currentPC+4 {
+		t.Fatalf("should skip when key is up, pc was 0x%X\n", cpu.pc)
+	}
+
+	cpu.pc = 0x200
+	cpu.SetKey(0x3, true)
+	cpu.cycle()
+	if cpu.pc != 0x202 {
+		t.Fatalf("should not skip when key is down, pc was 0x%X\n", cpu.pc)
+	}
+}
+
+func Test_opFX0A(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{0xF5, 0x0A})
+
+	currentPC := cpu.pc
+
+	cpu.cycle()
+	if cpu.pc != currentPC {
+		t.Fatalf("pc should not advance while no key is pressed\n")
+	}
+
+	cpu.SetKey(0x7, true)
+	cpu.cycle()
+	if cpu.pc != currentPC {
+		t.Fatalf("pc should not advance until the key is released\n")
+	}
+
+	cpu.SetKey(0x7, false)
+	cpu.cycle()
+	if cpu.pc != currentPC+2 {
+		t.Fatalf("pc should advance once the key is released\n")
+	}
+	if cpu.v[0x5] != 0x7 {
+		t.Fatalf("V5 should be 0x7, was 0x%X\n", cpu.v[0x5])
+	}
+}
+
+func Test_op00EE(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{
+		0x22, 0x04, // call 0x204
+		0x00, 0x00,
+		0x00, 0xEE, // return
+	})
+
+	cpu.cycle()
+	cpu.cycle()
+
+	if cpu.sp != 0 {
+		t.Fatalf("sp should be back to 0, was %d\n", cpu.sp)
+	}
+	if cpu.pc != 0x202 {
+		t.Fatalf("pc should return to the instruction after the call, was 0x%X\n", cpu.pc)
+	}
+}
+
+func Test_opFX07(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{0xF3, 0x07})
+
+	cpu.delayTimer = 0x42
+
+	currentPC := cpu.pc
+
+	cpu.cycle()
+
+	if cpu.pc != currentPC+2 {
+		t.Fatalf("program counter did not increase by two\n")
+	}
+	if cpu.v[0x3] != 0x42 {
+		t.Fatalf("V3 should be 0x42, was 0x%X\n", cpu.v[0x3])
+	}
+}
+
+func Test_opFX15(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{0xF3, 0x15})
+
+	cpu.v[0x3] = 0x42
+
+	currentPC := cpu.pc
+
+	cpu.cycle()
+
+	if cpu.pc != currentPC+2 {
+		t.Fatalf("program counter did not increase by two\n")
+	}
+	if cpu.delayTimer != 0x42 {
+		t.Fatalf("delay timer should be 0x42, was 0x%X\n", cpu.delayTimer)
+	}
+
+	cpu.updateTimers()
+	if cpu.delayTimer != 0x41 {
+		t.Fatalf("delay timer should count down, was 0x%X\n", cpu.delayTimer)
+	}
+}
+
+func Test_opFX18(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{0xF3, 0x18})
+
+	cpu.v[0x3] = 0x42
+
+	currentPC := cpu.pc
+
+	cpu.cycle()
+
+	if cpu.pc != currentPC+2 {
+		t.Fatalf("program counter did not increase by two\n")
+	}
+	if cpu.soundTimer != 0x42 {
+		t.Fatalf("sound timer should be 0x42, was 0x%X\n", cpu.soundTimer)
+	}
+}
+
+func Test_opFX29(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{0xF3, 0x29})
+
+	cpu.v[0x3] = 0xA
+
+	currentPC := cpu.pc
+
+	cpu.cycle()
+
+	if cpu.pc != currentPC+2 {
+		t.Fatalf("program counter did not increase by two\n")
+	}
+	if cpu.i != 50 {
+		t.Fatalf("i should point at the A character (50), was %d\n", cpu.i)
+	}
+	if cpu.memory[cpu.i] != 0xF0 || cpu.memory[cpu.i+4] != 0x90 {
+		t.Fatalf("i does not point at the A character\n")
+	}
+}
+
+func Test_opFX55(t *testing.T) {
+	cpu := NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{0xF2, 0x55})
+
+	cpu.i = 0x300
+	cpu.v[0x0] = 1
+	cpu.v[0x1] = 2
+	cpu.v[0x2] = 3
+	cpu.v[0x3] = 4
+
+	currentPC := cpu.pc
+
+	cpu.cycle()
+
+	if cpu.pc != currentPC+2 {
+		t.Fatalf("program counter did not increase by two\n")
+	}
+	for r := 0; r <= 2; r++ {
+		if cpu.memory[0x300+r] != uint8(r+1) {
+			t.Fatalf("memory at 0x%X should be %d, was %d\n", 0x300+r, r+1, cpu.memory[0x300+r])
+		}
+	}
+	if cpu.memory[0x303] != 0 {
+		t.Fatalf("V3 should not have been stored\n")
+	}
+	if cpu.i != 0x300 {
+		t.Fatalf("i should not be modified, was 0x%X\n", cpu.i)
+	}
+}
+
+func Test_opFX65(t *testing.T) {
+	cpu := NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{0xF2, 0x65})
+
+	cpu.i = 0x300
+	cpu.memory[0x300] = 1
+	cpu.memory[0x301] = 2
+	cpu.memory[0x302] = 3
+	cpu.memory[0x303] = 4
+
+	currentPC := cpu.pc
+
+	cpu.cycle()
+
+	if cpu.pc != currentPC+2 {
+		t.Fatalf("program counter did not increase by two\n")
+	}
+	for r := 0; r <= 2; r++ {
+		if cpu.v[r] != uint8(r+1) {
+			t.Fatalf("V%X should be %d, was %d\n", r, r+1, cpu.v[r])
+		}
+	}
+	if cpu.v[0x3] != 0 {
+		t.Fatalf("V3 should not have been loaded\n")
+	}
+	if cpu.i != 0x300 {
+		t.Fatalf("i should not be modified, was 0x%X\n", cpu.i)
+	}
+}
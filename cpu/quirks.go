@@ -0,0 +1,75 @@
+package cpu
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Quirks selects how the ambiguous instructions behave. The original COSMAC VIP interpreter, SUPER-CHIP and
+// XO-CHIP all disagree on a handful of opcodes, and ROMs tend to rely on the behaviour of the interpreter they
+// were written for.
+type Quirks struct {
+	ShiftVY       bool // 8XY6/8XYE shift VY and store the result in VX, rather than shifting VX in place
+	LoadStoreIncI bool // FX55/FX65 increment I by X+1, leaving it just past the last register
+	JumpVX        bool // BNNN behaves as BXNN, jumping to XNN plus VX rather than NNN plus V0
+	LogicResetsVF bool // 8XY1/8XY2/8XY3 reset VF to 0
+	ClipSprites   bool // DXYN clips sprites at the edge of the screen rather than wrapping them around
+	DisplayWait   bool // DXYN waits for the vertical blank, so at most one sprite is drawn per frame
+}
+
+// QuirksVIP matches the original COSMAC VIP interpreter
+var QuirksVIP = Quirks{
+	ShiftVY:       true,
+	LoadStoreIncI: true,
+	JumpVX:        false,
+	LogicResetsVF: true,
+	ClipSprites:   true,
+	DisplayWait:   true,
+}
+
+// QuirksSCHIP matches SUPER-CHIP 1.1 on the HP48
+var QuirksSCHIP = Quirks{
+	ShiftVY:       false,
+	LoadStoreIncI: false,
+	JumpVX:        true,
+	LogicResetsVF: false,
+	ClipSprites:   true,
+	DisplayWait:   false,
+}
+
+// QuirksXOCHIP matches XO-CHIP as implemented by Octo
+var QuirksXOCHIP = Quirks{
+	ShiftVY:       true,
+	LoadStoreIncI: true,
+	JumpVX:        false,
+	LogicResetsVF: false,
+	ClipSprites:   false,
+	DisplayWait:   false,
+}
+
+// QuirkPresets are the named quirk profiles that can be selected from the command line
+var QuirkPresets = map[string]Quirks{
+	"vip":    QuirksVIP,
+	"schip":  QuirksSCHIP,
+	"xochip": QuirksXOCHIP,
+}
+
+// ParseQuirks looks up a quirk profile by name
+func ParseQuirks(name string) (Quirks, error) {
+	quirks, ok := QuirkPresets[strings.ToLower(name)]
+	if !ok {
+		return Quirks{}, fmt.Errorf("unknown quirks profile %q, must be one of: %s", name, strings.Join(QuirkPresetNames(), ", "))
+	}
+	return quirks, nil
+}
+
+// QuirkPresetNames returns the names of the quirk profiles in alphabetical order
+func QuirkPresetNames() []string {
+	names := make([]string, 0, len(QuirkPresets))
+	for name := range QuirkPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
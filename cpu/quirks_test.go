@@ -0,0 +1,179 @@
+package cpu
+
+import (
+	"testing"
+)
+
+func Test_quirkShiftVY(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{
+		0x80, 0x16,
+		0x82, 0x3E,
+	})
+
+	cpu.v[0x0] = 0xFF
+	cpu.v[0x1] = 0x03
+	cpu.v[0x2] = 0xFF
+	cpu.v[0x3] = 0x81
+
+	cpu.cycle()
+	if cpu.v[0x0] != 0x01 || cpu.v[0xF] != 1 {
+		t.Fatalf("8XY6 should shift VY into VX, V0 was 0x%X VF was %d\n", cpu.v[0x0], cpu.v[0xF])
+	}
+
+	cpu.cycle()
+	if cpu.v[0x2] != 0x02 || cpu.v[0xF] != 1 {
+		t.Fatalf("8XYE should shift VY into VX, V2 was 0x%X VF was %d\n", cpu.v[0x2], cpu.v[0xF])
+	}
+
+	cpu = NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{0x80, 0x16})
+
+	cpu.v[0x0] = 0x04
+	cpu.v[0x1] = 0x03
+
+	cpu.cycle()
+	if cpu.v[0x0] != 0x02 || cpu.v[0xF] != 0 {
+		t.Fatalf("8XY6 should shift VX in place, V0 was 0x%X VF was %d\n", cpu.v[0x0], cpu.v[0xF])
+	}
+}
+
+func Test_quirkShiftFlagWins(t *testing.T) {
+	cpu := NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{0x8F, 0x06})
+
+	cpu.v[0xF] = 0x03
+
+	cpu.cycle()
+	if cpu.v[0xF] != 1 {
+		t.Fatalf("VF should hold the flag when X is F, was 0x%X\n", cpu.v[0xF])
+	}
+}
+
+func Test_quirkLoadStoreIncI(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{
+		0xF2, 0x55,
+		0xF1, 0x65,
+	})
+
+	cpu.i = 0x300
+
+	cpu.cycle()
+	if cpu.i != 0x303 {
+		t.Fatalf("FX55 should increment I by X+1, was 0x%X\n", cpu.i)
+	}
+
+	cpu.cycle()
+	if cpu.i != 0x305 {
+		t.Fatalf("FX65 should increment I by X+1, was 0x%X\n", cpu.i)
+	}
+}
+
+func Test_quirkJumpVX(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{0xB3, 0x00})
+
+	cpu.v[0x0] = 0x10
+	cpu.v[0x3] = 0x20
+
+	cpu.cycle()
+	if cpu.pc != 0x310 {
+		t.Fatalf("BNNN should jump to NNN plus V0, was 0x%X\n", cpu.pc)
+	}
+
+	cpu = NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{0xB3, 0x00})
+
+	cpu.v[0x0] = 0x10
+	cpu.v[0x3] = 0x20
+
+	cpu.cycle()
+	if cpu.pc != 0x320 {
+		t.Fatalf("BXNN should jump to XNN plus VX, was 0x%X\n", cpu.pc)
+	}
+}
+
+func Test_quirkLogicResetsVF(t *testing.T) {
+	for _, opcode := range []uint8{0x11, 0x12, 0x13} {
+		cpu := NewCPU(QuirksVIP)
+		cpu.LoadROM([]uint8{0x80, opcode})
+		cpu.v[0xF] = 1
+
+		cpu.cycle()
+		if cpu.v[0xF] != 0 {
+			t.Fatalf("8XY%X should reset VF\n", opcode&0x0F)
+		}
+
+		cpu = NewCPU(QuirksSCHIP)
+		cpu.LoadROM([]uint8{0x80, opcode})
+		cpu.v[0xF] = 1
+
+		cpu.cycle()
+		if cpu.v[0xF] != 1 {
+			t.Fatalf("8XY%X should not touch VF\n", opcode&0x0F)
+		}
+	}
+}
+
+func Test_quirkClipSprites(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{0xD0, 0x11})
+
+	cpu.i = 0x300
+	cpu.memory[0x300] = 0xFF
+	cpu.v[0x0] = 60
+	cpu.v[0x1] = 0
+
+	cpu.cycle()
+	if cpu.gfx[63][0] != 1 {
+		t.Fatalf("pixel on screen should be drawn\n")
+	}
+	if cpu.gfx[0][0] != 0 {
+		t.Fatalf("sprite should be clipped at the edge of the screen\n")
+	}
+
+	cpu = NewCPU(QuirksXOCHIP)
+	cpu.LoadROM([]uint8{0xD0, 0x11})
+
+	cpu.i = 0x300
+	cpu.memory[0x300] = 0xFF
+	cpu.v[0x0] = 60
+	cpu.v[0x1] = 0
+
+	cpu.cycle()
+	if cpu.gfx[63][0] != 1 || cpu.gfx[3][0] != 1 {
+		t.Fatalf("sprite should wrap around the edge of the screen\n")
+	}
+}
+
+func Test_quirkDisplayWait(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{0xD0, 0x11})
+
+	cpu.cycle()
+	if !cpu.vblankWait {
+		t.Fatalf("DXYN should wait for the vertical blank\n")
+	}
+
+	cpu = NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{0xD0, 0x11})
+
+	cpu.cycle()
+	if cpu.vblankWait {
+		t.Fatalf("DXYN should not wait for the vertical blank\n")
+	}
+}
+
+func Test_parseQuirks(t *testing.T) {
+	quirks, err := ParseQuirks("SCHIP")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if quirks != QuirksSCHIP {
+		t.Fatalf("should return the schip profile\n")
+	}
+	if _, err := ParseQuirks("nope"); err == nil {
+		t.Fatalf("unknown profile should return an error\n")
+	}
+}
@@ -0,0 +1,88 @@
+package cpu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// RNG is the random number source CXNN draws from. Its state is saved in snapshots, so a restored machine draws
+// the same numbers the original would have
+type RNG interface {
+	Next() uint32
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary(data []byte) error
+}
+
+// Xorshift is a xorshift128 generator, fast and good enough for games.
+// See http://en.wikipedia.org/wiki/Xorshift
+type Xorshift struct {
+	x, y, z, w uint32
+}
+
+// NewXorshift creates a generator whose sequence is decided by seed
+func NewXorshift(seed uint64) *Xorshift {
+	// Spread the seed over the state with splitmix64, which never leaves the state all zero
+	next := func() uint32 {
+		seed += 0x9E3779B97F4A7C15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		return uint32(z ^ (z >> 31))
+	}
+	r := &Xorshift{x: next(), y: next(), z: next(), w: next()}
+	if r.x|r.y|r.z|r.w == 0 {
+		r.w = 1
+	}
+	return r
+}
+
+// Next returns the next number in the sequence
+func (r *Xorshift) Next() uint32 {
+	t := r.x ^ (r.x << 11)
+	r.x, r.y, r.z = r.y, r.z, r.w
+	r.w = (r.w ^ (r.w >> 19)) ^ (t ^ (t >> 8))
+	return r.w
+}
+
+// MarshalBinary encodes the state of the generator
+func (r *Xorshift) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, 16)
+	for _, v := range []uint32{r.x, r.y, r.z, r.w} {
+		data = binary.BigEndian.AppendUint32(data, v)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary restores a state encoded by MarshalBinary
+func (r *Xorshift) UnmarshalBinary(data []byte) error {
+	if len(data) != 16 {
+		return fmt.Errorf("xorshift state should be 16 bytes, was %d", len(data))
+	}
+	r.x = binary.BigEndian.Uint32(data[0:])
+	r.y = binary.BigEndian.Uint32(data[4:])
+	r.z = binary.BigEndian.Uint32(data[8:])
+	r.w = binary.BigEndian.Uint32(data[12:])
+	return nil
+}
+
+// WithSeed seeds the random number generator, so every run of a ROM draws the same random numbers
+func WithSeed(seed uint64) Option {
+	return func(cpu *CPU) {
+		cpu.rng = NewXorshift(seed)
+	}
+}
+
+// WithRNG sets the random number generator CXNN draws from
+func WithRNG(rng RNG) Option {
+	return func(cpu *CPU) {
+		if rng != nil {
+			cpu.rng = rng
+		}
+	}
+}
+
+// defaultRNG is used unless a seed or generator is given, it is seeded from the clock so runs differ
+func defaultRNG() RNG {
+	return NewXorshift(uint64(time.Now().UnixNano()))
+}
@@ -0,0 +1,75 @@
+package cpu
+
+import (
+	"bytes"
+	"testing"
+)
+
+// randomROM draws a random byte into V0 forever
+var randomROM = []uint8{
+	0xC0, 0xFF, // V0 := random 0xFF
+	0x12, 0x00, // jump 0x200
+}
+
+// draws runs n draws of randomROM and returns them
+func draws(cpu *CPU, n int) []uint8 {
+	values := make([]uint8, n)
+	for i := range values {
+		cpu.cycle()
+		cpu.cycle()
+		values[i] = cpu.v[0x0]
+	}
+	return values
+}
+
+func Test_opCXNNSeeded(t *testing.T) {
+	a := NewCPU(QuirksVIP, WithSeed(42))
+	a.LoadROM(randomROM)
+	b := NewCPU(QuirksVIP, WithSeed(42))
+	b.LoadROM(randomROM)
+
+	if !bytes.Equal(draws(a, 100), draws(b, 100)) {
+		t.Fatalf("the same seed should draw the same numbers\n")
+	}
+
+	c := NewCPU(QuirksVIP, WithSeed(43))
+	c.LoadROM(randomROM)
+	if bytes.Equal(draws(a, 100), draws(c, 100)) {
+		t.Fatalf("different seeds should draw different numbers\n")
+	}
+}
+
+func Test_opCXNNRange(t *testing.T) {
+	cpu := NewCPU(QuirksVIP, WithSeed(1))
+	cpu.LoadROM(randomROM)
+
+	seen := map[uint8]bool{}
+	for _, v := range draws(cpu, 5000) {
+		seen[v] = true
+	}
+	if !seen[0xFF] || len(seen) != 256 {
+		t.Fatalf("every value including 0xFF should be drawn, saw %d values\n", len(seen))
+	}
+}
+
+func Test_rngSaveState(t *testing.T) {
+	cpu := NewCPU(QuirksVIP, WithSeed(7))
+	cpu.LoadROM(randomROM)
+	draws(cpu, 10)
+
+	var buf bytes.Buffer
+	if err := cpu.SaveState(&buf); err != nil {
+		t.Fatalf("unexpected error saving state: %v\n", err)
+	}
+	want := draws(cpu, 10)
+
+	// A machine seeded differently should pick up the saved generator along with the rest of the state
+	restored := NewCPU(QuirksVIP, WithSeed(99))
+	restored.LoadROM(randomROM)
+	if err := restored.LoadState(&buf); err != nil {
+		t.Fatalf("unexpected error loading state: %v\n", err)
+	}
+	if !bytes.Equal(draws(restored, 10), want) {
+		t.Fatalf("restored machine should draw the same numbers as the original\n")
+	}
+}
@@ -0,0 +1,150 @@
+package cpu
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// DefaultRewindBudget is the default memory budget of the rewind buffer, typically several minutes of gameplay
+const DefaultRewindBudget = 32 << 20
+
+// RewindBuffer is a ring buffer of recent snapshots used to rewind gameplay. Consecutive snapshots are mostly
+// identical, so only the newest snapshot is kept in full and every older one is kept as a compressed delta against
+// the snapshot after it. Deltas are dropped oldest first once the buffer grows past its memory budget, which never
+// invalidates the snapshots that remain.
+type RewindBuffer struct {
+	budget  int
+	size    int      // Bytes used by current and the deltas
+	current []byte   // The newest snapshot
+	deltas  [][]byte // Ring of deltas, deltas[head] is the oldest
+	head    int
+	count   int
+}
+
+// NewRewindBuffer creates a rewind buffer that keeps as many snapshots as fit in budget bytes
+func NewRewindBuffer(budget int) *RewindBuffer {
+	return &RewindBuffer{budget: budget}
+}
+
+// Len returns the number of snapshots that can be rewound to
+func (b *RewindBuffer) Len() int {
+	return b.count
+}
+
+// Size returns the number of bytes used by the buffer
+func (b *RewindBuffer) Size() int {
+	return b.size
+}
+
+// Push adds a snapshot as the newest entry
+func (b *RewindBuffer) Push(snapshot []byte) {
+	if b.current != nil {
+		b.pushDelta(encodeDelta(b.current, snapshot))
+	}
+
+	b.size -= len(b.current)
+	b.current = append(b.current[:0], snapshot...)
+	b.size += len(b.current)
+
+	for b.size > b.budget && b.count > 0 {
+		b.dropOldest()
+	}
+}
+
+// Rewind steps back to the snapshot before the newest one and returns it, it returns false when there is nothing
+// older to rewind to. The returned slice is only valid until the next call to Push or Rewind
+func (b *RewindBuffer) Rewind() ([]byte, bool) {
+	if b.count == 0 {
+		return nil, false
+	}
+
+	newest := (b.head + b.count - 1) % len(b.deltas)
+	delta := b.deltas[newest]
+	b.deltas[newest] = nil
+	b.count--
+	b.size -= len(delta)
+
+	size := len(b.current)
+	b.current = applyDelta(b.current, delta)
+	b.size += len(b.current) - size
+	return b.current, true
+}
+
+// Reset discards every snapshot
+func (b *RewindBuffer) Reset() {
+	*b = RewindBuffer{budget: b.budget}
+}
+
+func (b *RewindBuffer) pushDelta(delta []byte) {
+	if b.count == len(b.deltas) {
+		// The ring is full, grow it and unwrap the entries so the oldest is at the start again
+		grown := make([][]byte, max(16, len(b.deltas)*2))
+		for n := 0; n < b.count; n++ {
+			grown[n] = b.deltas[(b.head+n)%len(b.deltas)]
+		}
+		b.deltas = grown
+		b.head = 0
+	}
+
+	b.deltas[(b.head+b.count)%len(b.deltas)] = delta
+	b.count++
+	b.size += len(delta)
+}
+
+func (b *RewindBuffer) dropOldest() {
+	b.size -= len(b.deltas[b.head])
+	b.deltas[b.head] = nil
+	b.head = (b.head + 1) % len(b.deltas)
+	b.count--
+}
+
+// encodeDelta returns a delta that turns to back into from. The two snapshots are XORed together, which leaves
+// zeroes wherever they match, and the result is run length encoded as pairs of (run of zeroes, literal bytes).
+// Both lengths are uvarints. When the snapshots are different sizes the delta is the whole of from, marked by a
+// leading 1 rather than 0
+func encodeDelta(from, to []byte) []byte {
+	if len(from) != len(to) {
+		return append([]byte{1}, from...)
+	}
+
+	delta := []byte{0}
+	for n := 0; n < len(from); {
+		zeroes := n
+		for zeroes < len(from) && from[zeroes] == to[zeroes] {
+			zeroes++
+		}
+		literals := zeroes
+		for literals < len(from) && from[literals] != to[literals] {
+			literals++
+		}
+
+		delta = binary.AppendUvarint(delta, uint64(zeroes-n))
+		delta = binary.AppendUvarint(delta, uint64(literals-zeroes))
+		for i := zeroes; i < literals; i++ {
+			delta = append(delta, from[i]^to[i])
+		}
+		n = literals
+	}
+	return delta
+}
+
+// applyDelta turns snapshot back into the snapshot the delta was encoded from, reusing its storage where possible
+func applyDelta(snapshot, delta []byte) []byte {
+	if delta[0] == 1 {
+		return append(snapshot[:0], delta[1:]...)
+	}
+
+	r := bytes.NewReader(delta[1:])
+	n := 0
+	for r.Len() > 0 {
+		zeroes, _ := binary.ReadUvarint(r)
+		literals, _ := binary.ReadUvarint(r)
+		n += int(zeroes)
+		for i := 0; i < int(literals); i++ {
+			b, _ := r.ReadByte()
+			snapshot[n] ^= b
+			n++
+		}
+	}
+	return snapshot
+}
@@ -0,0 +1,108 @@
+package cpu
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_rewindBuffer(t *testing.T) {
+	buf := NewRewindBuffer(1 << 20)
+
+	var snapshots [][]byte
+	for n := 0; n < 100; n++ {
+		snapshot := make([]byte, 1024)
+		snapshot[n] = byte(n)
+		snapshot[1000] = byte(n * 3)
+		snapshots = append(snapshots, snapshot)
+		buf.Push(snapshot)
+	}
+
+	if buf.Len() != 99 {
+		t.Fatalf("should be able to rewind 99 snapshots, was %d\n", buf.Len())
+	}
+
+	for n := 98; n >= 0; n-- {
+		snapshot, ok := buf.Rewind()
+		if !ok {
+			t.Fatalf("should be able to rewind to snapshot %d\n", n)
+		}
+		if !bytes.Equal(snapshot, snapshots[n]) {
+			t.Fatalf("snapshot %d was not restored correctly\n", n)
+		}
+	}
+
+	if _, ok := buf.Rewind(); ok {
+		t.Fatalf("should not be able to rewind past the oldest snapshot\n")
+	}
+}
+
+func Test_rewindBufferBudget(t *testing.T) {
+	buf := NewRewindBuffer(4096)
+
+	for n := 0; n < 1000; n++ {
+		snapshot := make([]byte, 1024)
+		for i := range snapshot {
+			snapshot[i] = byte(n + i)
+		}
+		buf.Push(snapshot)
+
+		if buf.Size() > 4096 {
+			t.Fatalf("buffer should stay within budget, was %d bytes\n", buf.Size())
+		}
+	}
+
+	if buf.Len() == 0 {
+		t.Fatalf("buffer should keep the newest snapshots\n")
+	}
+	for buf.Len() > 0 {
+		buf.Rewind()
+	}
+}
+
+func Test_rewindBufferDeltaSize(t *testing.T) {
+	buf := NewRewindBuffer(1 << 20)
+
+	snapshot := make([]byte, 70000)
+	buf.Push(snapshot)
+	snapshot[500] = 1
+	buf.Push(snapshot)
+
+	if delta := buf.Size() - len(snapshot); delta > 16 {
+		t.Fatalf("a one byte change should produce a tiny delta, was %d bytes\n", delta)
+	}
+}
+
+func Test_cpuRewind(t *testing.T) {
+	cpu := NewCPU(QuirksVIP, WithInstructionsPerFrame(1), WithRewind(DefaultRewindBudget))
+	cpu.SetHost(NopHost{})
+	cpu.LoadROM([]uint8{
+		0x70, 0x01, // V0 += 1
+		0x12, 0x00, // jump back
+	})
+
+	for n := 0; n < 10; n++ {
+		cpu.runFrame()
+	}
+	if cpu.v[0x0] != 5 {
+		t.Fatalf("V0 should be 5 after 10 frames, was %d\n", cpu.v[0x0])
+	}
+
+	cpu.SetRewinding(true)
+	cpu.SetKey(0x1, true)
+	for n := 0; n < 4; n++ {
+		cpu.runFrame()
+	}
+	cpu.SetRewinding(false)
+
+	if cpu.pc != 0x200 || cpu.v[0x0] != 3 {
+		t.Fatalf("should rewind 4 frames, pc was 0x%X V0 was %d\n", cpu.pc, cpu.v[0x0])
+	}
+	if !cpu.keys[0x1] {
+		t.Fatalf("rewinding should not change the keypad\n")
+	}
+
+	cpu.runFrame()
+	if cpu.pc != 0x202 {
+		t.Fatalf("execution should resume after rewinding, pc was 0x%X\n", cpu.pc)
+	}
+}
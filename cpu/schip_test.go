@@ -0,0 +1,142 @@
+package cpu
+
+import (
+	"testing"
+)
+
+func Test_op00FF(t *testing.T) {
+	cpu := NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{
+		0x00, 0xFF,
+		0x00, 0xFE,
+	})
+
+	cpu.cycle()
+	if frame := cpu.frame(); frame.Width != 128 || frame.Height != 64 {
+		t.Fatalf("display should be 128x64, was %dx%d\n", frame.Width, frame.Height)
+	}
+
+	cpu.cycle()
+	if frame := cpu.frame(); frame.Width != 64 || frame.Height != 32 {
+		t.Fatalf("display should be 64x32, was %dx%d\n", frame.Width, frame.Height)
+	}
+}
+
+func Test_op00CN(t *testing.T) {
+	cpu := NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{0x00, 0xC3})
+
+	cpu.gfx[5][0] = 1
+	cpu.gfx[5][31] = 1
+
+	cpu.cycle()
+	if cpu.gfx[5][3] != 1 || cpu.gfx[5][0] != 0 {
+		t.Fatalf("pixel should scroll down 3 rows\n")
+	}
+	if cpu.gfx[5][31] != 0 {
+		t.Fatalf("pixel at the bottom should scroll off screen\n")
+	}
+}
+
+func Test_op00FBand00FC(t *testing.T) {
+	cpu := NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{
+		0x00, 0xFB,
+		0x00, 0xFC,
+		0x00, 0xFC,
+	})
+
+	cpu.gfx[10][0] = 1
+
+	cpu.cycle()
+	if cpu.gfx[14][0] != 1 || cpu.gfx[10][0] != 0 {
+		t.Fatalf("pixel should scroll right 4 pixels\n")
+	}
+
+	cpu.cycle()
+	cpu.cycle()
+	if cpu.gfx[6][0] != 1 {
+		t.Fatalf("pixel should scroll left 4 pixels\n")
+	}
+}
+
+func Test_op00FD(t *testing.T) {
+	cpu := NewCPU(QuirksSCHIP, WithInstructionsPerFrame(10))
+	cpu.SetHost(NopHost{})
+	cpu.LoadROM([]uint8{0x00, 0xFD})
+
+	if executed := cpu.runFrame(); executed != 1 {
+		t.Fatalf("should stop executing after exit, executed %d\n", executed)
+	}
+	if executed := cpu.runFrame(); executed != 0 {
+		t.Fatalf("should not execute once halted, executed %d\n", executed)
+	}
+}
+
+func Test_opDXY0(t *testing.T) {
+	cpu := NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{
+		0x00, 0xFF,
+		0xD0, 0x10,
+	})
+
+	cpu.i = 0x300
+	for b := 0; b < 32; b++ {
+		cpu.memory[0x300+b] = 0xFF
+	}
+	cpu.v[0x0] = 100
+	cpu.v[0x1] = 40
+
+	cpu.cycle()
+	cpu.cycle()
+
+	for x := 100; x < 116; x++ {
+		for y := 40; y < 56; y++ {
+			if cpu.gfx[x][y] != 1 {
+				t.Fatalf("pixel at (%d, %d) should be set\n", x, y)
+			}
+		}
+	}
+	if cpu.gfx[116][40] != 0 || cpu.gfx[100][56] != 0 {
+		t.Fatalf("sprite should be 16x16\n")
+	}
+}
+
+func Test_opFX30(t *testing.T) {
+	cpu := NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{0xF3, 0x30})
+
+	cpu.v[0x3] = 0x2
+
+	cpu.cycle()
+	if cpu.i != bigFontAddr+20 {
+		t.Fatalf("i should point at the big 2 character, was 0x%X\n", cpu.i)
+	}
+	if cpu.memory[cpu.i] != bigFontset[20] {
+		t.Fatalf("big font should be loaded into memory\n")
+	}
+}
+
+func Test_opFX75andFX85(t *testing.T) {
+	cpu := NewCPU(QuirksSCHIP)
+	cpu.LoadROM([]uint8{
+		0xF2, 0x75,
+		0xF3, 0x85,
+	})
+
+	cpu.v[0x0] = 1
+	cpu.v[0x1] = 2
+	cpu.v[0x2] = 3
+	cpu.v[0x3] = 4
+
+	cpu.cycle()
+	cpu.v = [16]uint8{}
+	cpu.cycle()
+
+	if cpu.v[0x0] != 1 || cpu.v[0x1] != 2 || cpu.v[0x2] != 3 {
+		t.Fatalf("registers should be restored from the flags\n")
+	}
+	if cpu.v[0x3] != 0 {
+		t.Fatalf("V3 should not have been saved, was %d\n", cpu.v[0x3])
+	}
+}
@@ -0,0 +1,221 @@
+package cpu
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// stateMagic identifies a gate save state
+var stateMagic = [4]byte{'G', 'A', 'T', 'E'}
+
+// stateVersion is bumped whenever the layout of machineState changes, old save states are rejected rather than
+// being loaded incorrectly
+const stateVersion = 4
+
+// ErrStateROMMismatch is returned by LoadState when the save state was made with a different ROM
+var ErrStateROMMismatch = errors.New("save state was made with a different ROM")
+
+// stateHeader is written before the machine state
+type stateHeader struct {
+	Magic   [4]byte
+	Version uint16
+	ROMHash [sha1.Size]byte // SHA-1 of the ROM that was loaded when the state was saved
+}
+
+// machineState is everything needed to resume execution apart from memory, the display and the random number
+// generator, fields are fixed size so it can be encoded with encoding/binary. Memory and the display follow it as raw
+// bytes, encoding/binary is too slow on large arrays to snapshot every frame, then the generator's state prefixed
+// with its length
+type machineState struct {
+	Opcode uint16
+	V      [16]uint8
+	I      uint16
+	PC     uint16
+
+	Hires      bool
+	Plane      uint8
+	VBlankWait bool
+
+	DelayTimer uint8
+	SoundTimer uint8
+	Pattern    [16]uint8
+	Pitch      uint8
+	HasPattern bool
+
+	Stack [16]uint16
+	SP    uint16
+
+	RPL    [16]uint8
+	Halted bool
+
+	Keys       [16]bool
+	KeyWaiting bool
+	KeyHeld    uint8
+
+	ClockRemainder int64
+}
+
+// ROMHash returns the SHA-1 of the loaded ROM
+func (cpu *CPU) ROMHash() [sha1.Size]byte {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	return cpu.romHash
+}
+
+// SaveState writes a snapshot of the machine to w, it is safe to call while the CPU is running
+func (cpu *CPU) SaveState(w io.Writer) error {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	return cpu.saveState(w)
+}
+
+// LoadState restores a snapshot written by SaveState. The snapshot must have been made with the ROM that is
+// currently loaded, otherwise ErrStateROMMismatch is returned and the machine is left untouched
+func (cpu *CPU) LoadState(r io.Reader) error {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	return cpu.loadState(r)
+}
+
+// saveState is SaveState for callers that already hold cpu.mu
+func (cpu *CPU) saveState(w io.Writer) error {
+	header := stateHeader{
+		Magic:   stateMagic,
+		Version: stateVersion,
+		ROMHash: cpu.romHash,
+	}
+	if err := binary.Write(w, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("writing save state header: %w", err)
+	}
+
+	state := machineState{
+		Opcode: cpu.opcode,
+		V:      cpu.v,
+		I:      cpu.i,
+		PC:     cpu.pc,
+
+		Hires:      cpu.hires,
+		Plane:      cpu.plane,
+		VBlankWait: cpu.vblankWait,
+
+		DelayTimer: cpu.delayTimer,
+		SoundTimer: cpu.soundTimer,
+		Pattern:    cpu.pattern,
+		Pitch:      cpu.pitch,
+		HasPattern: cpu.hasPattern,
+
+		Stack: cpu.stack,
+		SP:    cpu.sp,
+
+		RPL:    cpu.rpl,
+		Halted: cpu.halted,
+
+		Keys:       cpu.keys,
+		KeyWaiting: cpu.keyWaiting,
+		KeyHeld:    cpu.keyHeld,
+
+		ClockRemainder: int64(cpu.clockRemainder),
+	}
+	if err := binary.Write(w, binary.BigEndian, &state); err != nil {
+		return fmt.Errorf("writing save state: %w", err)
+	}
+	if _, err := w.Write(cpu.memory[:]); err != nil {
+		return fmt.Errorf("writing save state memory: %w", err)
+	}
+	for x := range cpu.gfx {
+		if _, err := w.Write(cpu.gfx[x][:]); err != nil {
+			return fmt.Errorf("writing save state display: %w", err)
+		}
+	}
+
+	rng, err := cpu.rng.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("writing save state random number generator: %w", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(len(rng))); err != nil {
+		return fmt.Errorf("writing save state random number generator: %w", err)
+	}
+	if _, err := w.Write(rng); err != nil {
+		return fmt.Errorf("writing save state random number generator: %w", err)
+	}
+	return nil
+}
+
+// loadState is LoadState for callers that already hold cpu.mu
+func (cpu *CPU) loadState(r io.Reader) error {
+	var header stateHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("reading save state header: %w", err)
+	}
+	if header.Magic != stateMagic {
+		return errors.New("not a save state")
+	}
+	if header.Version != stateVersion {
+		return fmt.Errorf("unsupported save state version %d, expected %d", header.Version, stateVersion)
+	}
+	if !bytes.Equal(header.ROMHash[:], cpu.romHash[:]) {
+		return ErrStateROMMismatch
+	}
+
+	var state machineState
+	if err := binary.Read(r, binary.BigEndian, &state); err != nil {
+		return fmt.Errorf("reading save state: %w", err)
+	}
+	// Read into copies so a truncated state leaves the machine untouched
+	var memory [len(cpu.memory)]uint8
+	if _, err := io.ReadFull(r, memory[:]); err != nil {
+		return fmt.Errorf("reading save state memory: %w", err)
+	}
+	var gfx [HiResWidth][HiResHeight]uint8
+	for x := range gfx {
+		if _, err := io.ReadFull(r, gfx[x][:]); err != nil {
+			return fmt.Errorf("reading save state display: %w", err)
+		}
+	}
+	var rngLen uint16
+	if err := binary.Read(r, binary.BigEndian, &rngLen); err != nil {
+		return fmt.Errorf("reading save state random number generator: %w", err)
+	}
+	rng := make([]byte, rngLen)
+	if _, err := io.ReadFull(r, rng); err != nil {
+		return fmt.Errorf("reading save state random number generator: %w", err)
+	}
+	if err := cpu.rng.UnmarshalBinary(rng); err != nil {
+		return fmt.Errorf("reading save state random number generator: %w", err)
+	}
+
+	cpu.opcode = state.Opcode
+	cpu.memory = memory
+	cpu.v = state.V
+	cpu.i = state.I
+	cpu.pc = state.PC
+
+	cpu.gfx = gfx
+	cpu.hires = state.Hires
+	cpu.plane = state.Plane
+	cpu.vblankWait = state.VBlankWait
+	cpu.drawFlag = true // The display has changed underneath the renderer
+
+	cpu.delayTimer = state.DelayTimer
+	cpu.soundTimer = state.SoundTimer
+	cpu.pattern = state.Pattern
+	cpu.pitch = state.Pitch
+	cpu.hasPattern = state.HasPattern
+
+	cpu.stack = state.Stack
+	cpu.sp = state.SP
+
+	cpu.rpl = state.RPL
+	cpu.halted = state.Halted
+
+	cpu.keys = state.Keys
+	cpu.keyWaiting = state.KeyWaiting
+	cpu.keyHeld = state.KeyHeld
+
+	cpu.clockRemainder = int(state.ClockRemainder)
+	return nil
+}
@@ -0,0 +1,87 @@
+package cpu
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func Test_saveLoadState(t *testing.T) {
+	rom := []uint8{
+		0x60, 0x05, // V0 := 5
+		0x22, 0x06, // call 0x206
+		0x12, 0x04, // loop forever
+		0xA3, 0x00, // I := 0x300
+		0xF0, 0x55, // save V0
+		0x00, 0xEE, // return
+	}
+
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM(rom)
+	cpu.cycle()
+	cpu.cycle()
+	cpu.cycle()
+	cpu.gfx[10][10] = 1
+	cpu.delayTimer = 30
+	cpu.SetKey(0x4, true)
+
+	var buf bytes.Buffer
+	if err := cpu.SaveState(&buf); err != nil {
+		t.Fatalf("unexpected error saving state: %v\n", err)
+	}
+
+	restored := NewCPU(QuirksVIP)
+	restored.LoadROM(rom)
+	if err := restored.LoadState(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("unexpected error loading state: %v\n", err)
+	}
+
+	if restored.pc != cpu.pc || restored.sp != cpu.sp || restored.stack != cpu.stack {
+		t.Fatalf("pc, sp and stack should be restored\n")
+	}
+	if restored.v != cpu.v || restored.i != cpu.i {
+		t.Fatalf("registers should be restored\n")
+	}
+	if restored.gfx[10][10] != 1 || restored.delayTimer != 30 || !restored.keys[0x4] {
+		t.Fatalf("display, timers and keypad should be restored\n")
+	}
+
+	// Both machines should carry on identically
+	for n := 0; n < 3; n++ {
+		cpu.cycle()
+		restored.cycle()
+	}
+	if restored.pc != cpu.pc || restored.memory != cpu.memory {
+		t.Fatalf("restored machine should execute the same as the original\n")
+	}
+}
+
+func Test_loadStateROMMismatch(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+	cpu.LoadROM([]uint8{0x12, 0x00})
+
+	var buf bytes.Buffer
+	if err := cpu.SaveState(&buf); err != nil {
+		t.Fatalf("unexpected error saving state: %v\n", err)
+	}
+
+	other := NewCPU(QuirksVIP)
+	other.LoadROM([]uint8{0x12, 0x02})
+	other.v[0x0] = 0x42
+
+	err := other.LoadState(&buf)
+	if !errors.Is(err, ErrStateROMMismatch) {
+		t.Fatalf("should reject a state from a different ROM, got %v\n", err)
+	}
+	if other.v[0x0] != 0x42 {
+		t.Fatalf("machine should be untouched by a rejected state\n")
+	}
+}
+
+func Test_loadStateInvalid(t *testing.T) {
+	cpu := NewCPU(QuirksVIP)
+
+	if err := cpu.LoadState(bytes.NewReader([]byte("not a save state at all"))); err == nil {
+		t.Fatalf("should reject data that is not a save state\n")
+	}
+}
@@ -0,0 +1,76 @@
+package cpu
+
+// TraceEntry records an executed instruction and the changes it made. PC is only listed in Registers when the
+// instruction jumped, skipped or waited rather than moving on to the next instruction
+type TraceEntry struct {
+	Cycle     uint64 // Instructions executed before this one since the machine was reset
+	PC        uint16
+	Opcode    uint16
+	Long      uint16 // The address following an F000 opcode, zero for every other instruction
+	Registers []RegisterChange
+	Memory    []MemoryChange // In the order the instruction wrote them
+}
+
+// RegisterChange is a register an instruction changed
+type RegisterChange struct {
+	Register Register
+	Old, New uint16
+}
+
+// MemoryChange is a byte of memory an instruction wrote, Old and New are equal if it wrote the same value
+type MemoryChange struct {
+	Addr     uint16
+	Old, New uint8
+}
+
+// Tracer receives an entry for every executed instruction. It is called with cpu.mu held, so it must not call back
+// into the CPU, and the entry is reused so it must be copied to be kept
+type Tracer interface {
+	Trace(entry *TraceEntry)
+}
+
+// SetTracer sets the tracer, or stops tracing when tracer is nil. Once it returns the previous tracer won't be
+// called again, so it can be safely flushed
+func (cpu *CPU) SetTracer(tracer Tracer) {
+	cpu.mu.Lock()
+	defer cpu.mu.Unlock()
+	cpu.tracer = tracer
+}
+
+// execute executes an instruction, tracing it when there is a tracer
+func (cpu *CPU) execute() {
+	if cpu.tracer == nil {
+		cpu.cycle()
+		cpu.cycles++
+		return
+	}
+
+	entry := &cpu.trace
+	entry.Cycle = cpu.cycles
+	entry.PC = cpu.pc
+	entry.Opcode = uint16(cpu.memory[cpu.pc])<<8 | uint16(cpu.memory[cpu.pc+1])
+	entry.Long = 0
+	next := cpu.pc + 2
+	if entry.Opcode == 0xF000 {
+		entry.Long = uint16(cpu.memory[cpu.pc+2])<<8 | uint16(cpu.memory[cpu.pc+3])
+		next += 2
+	}
+	entry.Registers = entry.Registers[:0]
+	entry.Memory = entry.Memory[:0] // Filled in by write
+
+	var before [NumRegisters]uint16
+	for r := RegV0; r < NumRegisters; r++ {
+		before[r] = cpu.register(r)
+	}
+
+	cpu.cycle()
+	cpu.cycles++
+
+	for r := RegV0; r < NumRegisters; r++ {
+		after := cpu.register(r)
+		if after != before[r] && (r != RegPC || after != next) {
+			entry.Registers = append(entry.Registers, RegisterChange{Register: r, Old: before[r], New: after})
+		}
+	}
+	cpu.tracer.Trace(entry)
+}
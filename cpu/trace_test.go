@@ -0,0 +1,60 @@
+package cpu
+
+import (
+	"testing"
+)
+
+// recorder keeps copies of every entry traced
+type recorder struct {
+	entries []TraceEntry
+}
+
+func (r *recorder) Trace(entry *TraceEntry) {
+	e := *entry
+	e.Registers = append([]RegisterChange(nil), entry.Registers...)
+	e.Memory = append([]MemoryChange(nil), entry.Memory...)
+	r.entries = append(r.entries, e)
+}
+
+func Test_trace(t *testing.T) {
+	cpu := NewCPU(QuirksVIP, WithInstructionsPerFrame(5))
+	cpu.LoadROM([]uint8{
+		0x60, 0x05, // V0 := 5
+		0xA3, 0x00, // I := 0x300
+		0xF0, 0x55, // save V0
+		0x30, 0x05, // skip if V0 == 5
+		0x00, 0x00,
+		0x12, 0x0A, // jump 0x20A
+	})
+	rec := &recorder{}
+	cpu.SetTracer(rec)
+	cpu.runFrame()
+
+	if len(rec.entries) != 5 {
+		t.Fatalf("should trace every instruction, traced %d\n", len(rec.entries))
+	}
+	e := rec.entries[0]
+	if e.Cycle != 0 || e.PC != 0x200 || e.Opcode != 0x6005 {
+		t.Fatalf("entry should record cycle, PC and opcode, was %+v\n", e)
+	}
+	if len(e.Registers) != 1 || e.Registers[0] != (RegisterChange{Register: RegV0, Old: 0, New: 5}) {
+		t.Fatalf("moving on to the next instruction should not record PC, was %+v\n", e.Registers)
+	}
+
+	// VIP's FX55 moves I along as it stores
+	e = rec.entries[2]
+	if len(e.Registers) != 1 || e.Registers[0] != (RegisterChange{Register: RegI, Old: 0x300, New: 0x301}) {
+		t.Fatalf("save should record I, was %+v\n", e.Registers)
+	}
+	if len(e.Memory) != 1 || e.Memory[0] != (MemoryChange{Addr: 0x300, Old: 0, New: 5}) {
+		t.Fatalf("save should record the memory written, was %+v\n", e.Memory)
+	}
+
+	e = rec.entries[3]
+	if len(e.Registers) != 1 || e.Registers[0] != (RegisterChange{Register: RegPC, Old: 0x206, New: 0x20A}) {
+		t.Fatalf("skipping should record PC, was %+v\n", e.Registers)
+	}
+	if rec.entries[4].Cycle != 4 {
+		t.Fatalf("cycle should count instructions executed, was %d\n", rec.entries[4].Cycle)
+	}
+}
@@ -0,0 +1,71 @@
+package cpu
+
+import "sync/atomic"
+
+// freshBit is set in TripleBuffer.middle when the middle buffer holds a frame the reader hasn't taken
+const freshBit = 1 << 2
+
+// TripleBuffer hands frames from the machine's goroutine to a host's drawing goroutine without either waiting on the
+// other: the writer always has a buffer of its own to fill and the reader always gets the latest complete frame. The
+// two only share the middle buffer, which they swap theirs with atomically. There must be one writer and one reader.
+// Frames are numbered as they are published so the reader can tell when it has missed some, see FrameStats
+type TripleBuffer struct {
+	frames [3]Frame
+	seqs   [3]uint64     // Sequence number of the frame in each buffer
+	middle atomic.Uint32 // Index of the middle buffer, with freshBit
+	write  int           // Index of the writer's buffer, only used by Publish
+	read   int           // Index of the reader's buffer, only used by Latest
+	seq    uint64        // Sequence number of the last frame published, only used by Publish
+}
+
+// NewTripleBuffer creates a triple buffer, until the first frame is published the reader gets a blank low resolution
+// frame numbered 0
+func NewTripleBuffer() *TripleBuffer {
+	b := &TripleBuffer{write: 0, read: 2}
+	for n := range b.frames {
+		b.frames[n] = Frame{Width: LoResWidth, Height: LoResHeight}
+	}
+	b.middle.Store(1)
+	return b
+}
+
+// Publish copies frame into the buffer as the latest frame and returns its sequence number, which starts at 1
+func (b *TripleBuffer) Publish(frame *Frame) uint64 {
+	b.seq++
+	b.frames[b.write] = *frame
+	b.seqs[b.write] = b.seq
+	b.write = int(b.middle.Swap(uint32(b.write)|freshBit) &^ freshBit)
+	return b.seq
+}
+
+// Latest returns the most recently published frame and its sequence number, fresh is false if it is the frame the
+// last call returned. The frame belongs to the reader until the next call
+func (b *TripleBuffer) Latest() (frame *Frame, seq uint64, fresh bool) {
+	if b.middle.Load()&freshBit != 0 {
+		b.read = int(b.middle.Swap(uint32(b.read)) &^ freshBit)
+		fresh = true
+	}
+	return &b.frames[b.read], b.seqs[b.read], fresh
+}
+
+// FrameStats counts what a reader of a TripleBuffer sees. A dropped frame was published and replaced before the
+// reader looked, a repeat is the reader drawing a frame it has already drawn
+type FrameStats struct {
+	Seq      uint64 // Sequence number of the last frame seen
+	Shown    uint64
+	Dropped  uint64
+	Repeated uint64
+}
+
+// See counts a frame returned by Latest
+func (s *FrameStats) See(seq uint64, fresh bool) {
+	if !fresh {
+		s.Repeated++
+		return
+	}
+	if seq > s.Seq+1 {
+		s.Dropped += seq - s.Seq - 1
+	}
+	s.Seq = seq
+	s.Shown++
+}
@@ -0,0 +1,76 @@
+package cpu
+
+import (
+	"sync"
+	"testing"
+)
+
+func Test_tripleBufferSequence(t *testing.T) {
+	b := NewTripleBuffer()
+	var stats FrameStats
+
+	frame, seq, fresh := b.Latest()
+	if fresh || seq != 0 || frame.Width != LoResWidth {
+		t.Fatalf("should start with a blank low resolution frame numbered 0\n")
+	}
+	stats.See(seq, fresh)
+
+	for n := 1; n <= 3; n++ {
+		b.Publish(&Frame{Width: HiResWidth, Height: HiResHeight})
+	}
+	frame, seq, fresh = b.Latest()
+	if !fresh || seq != 3 || frame.Width != HiResWidth {
+		t.Fatalf("should get the latest frame, got %d\n", seq)
+	}
+	stats.See(seq, fresh)
+
+	_, seq, fresh = b.Latest()
+	if fresh || seq != 3 {
+		t.Fatalf("should get the same frame again when nothing is published\n")
+	}
+	stats.See(seq, fresh)
+
+	b.Publish(&Frame{})
+	_, seq, fresh = b.Latest()
+	stats.See(seq, fresh)
+
+	if stats.Shown != 2 || stats.Dropped != 2 || stats.Repeated != 2 || stats.Seq != 4 {
+		t.Fatalf("should count 2 shown, 2 dropped and 2 repeated, counted %+v\n", stats)
+	}
+}
+
+func Test_tripleBufferConcurrent(t *testing.T) {
+	const frames = 5000
+	b := NewTripleBuffer()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var frame Frame
+		for n := 1; n <= frames; n++ {
+			// Mark both ends of the frame, a torn frame would have them disagree
+			frame.Width = n
+			frame.Pixels[0][0] = uint8(n)
+			frame.Pixels[HiResWidth-1][HiResHeight-1] = uint8(n)
+			b.Publish(&frame)
+		}
+	}()
+
+	var stats FrameStats
+	for stats.Seq < frames {
+		frame, seq, fresh := b.Latest()
+		if seq < stats.Seq {
+			t.Fatalf("sequence went backwards from %d to %d\n", stats.Seq, seq)
+		}
+		if seq > 0 && (frame.Width != int(seq) || frame.Pixels[0][0] != uint8(seq) || frame.Pixels[HiResWidth-1][HiResHeight-1] != uint8(seq)) {
+			t.Fatalf("frame %d is torn\n", seq)
+		}
+		stats.See(seq, fresh)
+	}
+	wg.Wait()
+
+	if stats.Shown+stats.Dropped != frames {
+		t.Fatalf("every frame should be shown or dropped, counted %+v\n", stats)
+	}
+}
@@ -0,0 +1,169 @@
+package cpu
+
+import (
+	"testing"
+)
+
+func Test_opF000(t *testing.T) {
+	cpu := NewCPU(QuirksXOCHIP)
+	cpu.LoadROM([]uint8{0xF0, 0x00, 0xBE, 0xEF})
+
+	currentPC := cpu.pc
+
+	cpu.cycle()
+
+	if cpu.pc != currentPC+4 {
+		t.Fatalf("program counter did not increase by four\n")
+	}
+	if cpu.i != 0xBEEF {
+		t.Fatalf("i should be 0xBEEF, was 0x%X\n", cpu.i)
+	}
+}
+
+func Test_skipF000(t *testing.T) {
+	cpu := NewCPU(QuirksXOCHIP)
+	cpu.LoadROM([]uint8{
+		0x30, 0x00, // skip if V0 == 0
+		0xF0, 0x00, 0x12, 0x34,
+		0x00, 0xE0,
+	})
+
+	cpu.cycle()
+
+	if cpu.pc != 0x206 {
+		t.Fatalf("skip should step over the four byte instruction, pc was 0x%X\n", cpu.pc)
+	}
+}
+
+func Test_opFN01(t *testing.T) {
+	cpu := NewCPU(QuirksXOCHIP)
+	cpu.LoadROM([]uint8{
+		0xF3, 0x01, // select both planes
+		0xD0, 0x01, // draw one row
+		0xF2, 0x01, // select plane 2
+		0x00, 0xE0, // clear plane 2
+	})
+
+	cpu.i = 0x300
+	cpu.memory[0x300] = 0x80 // plane 1
+	cpu.memory[0x301] = 0xC0 // plane 2
+
+	cpu.cycle()
+	cpu.cycle()
+
+	if cpu.gfx[0][0] != 0x3 {
+		t.Fatalf("pixel should be set in both planes, was %d\n", cpu.gfx[0][0])
+	}
+	if cpu.gfx[1][0] != 0x2 {
+		t.Fatalf("pixel should be set in plane 2, was %d\n", cpu.gfx[1][0])
+	}
+
+	cpu.cycle()
+	cpu.cycle()
+
+	if cpu.gfx[0][0] != 0x1 || cpu.gfx[1][0] != 0 {
+		t.Fatalf("only plane 2 should be cleared\n")
+	}
+}
+
+func Test_op5XY2and5XY3(t *testing.T) {
+	cpu := NewCPU(QuirksXOCHIP)
+	cpu.LoadROM([]uint8{
+		0x52, 0x42, // save V2-V4
+		0x57, 0x53, // load V7-V5, reversed
+	})
+
+	cpu.i = 0x300
+	cpu.v[0x2] = 1
+	cpu.v[0x3] = 2
+	cpu.v[0x4] = 3
+
+	cpu.cycle()
+	if cpu.memory[0x300] != 1 || cpu.memory[0x301] != 2 || cpu.memory[0x302] != 3 {
+		t.Fatalf("V2-V4 should be stored at I\n")
+	}
+	if cpu.i != 0x300 {
+		t.Fatalf("i should not be modified, was 0x%X\n", cpu.i)
+	}
+
+	cpu.cycle()
+	if cpu.v[0x7] != 1 || cpu.v[0x6] != 2 || cpu.v[0x5] != 3 {
+		t.Fatalf("V7-V5 should be loaded in descending order\n")
+	}
+}
+
+func Test_op00DN(t *testing.T) {
+	cpu := NewCPU(QuirksXOCHIP)
+	cpu.LoadROM([]uint8{0x00, 0xD2})
+
+	cpu.gfx[5][10] = 1
+
+	cpu.cycle()
+	if cpu.gfx[5][8] != 1 || cpu.gfx[5][10] != 0 {
+		t.Fatalf("pixel should scroll up 2 rows\n")
+	}
+}
+
+func Test_extendedMemory(t *testing.T) {
+	cpu := NewCPU(QuirksXOCHIP)
+	cpu.LoadROM([]uint8{
+		0xF0, 0x00, 0xF0, 0x00, // i := 0xF000
+		0xF1, 0x55, // save V0-V1
+	})
+
+	cpu.v[0x0] = 0xAB
+	cpu.v[0x1] = 0xCD
+
+	cpu.cycle()
+	cpu.cycle()
+
+	if cpu.memory[0xF000] != 0xAB || cpu.memory[0xF001] != 0xCD {
+		t.Fatalf("registers should be stored above 4KB\n")
+	}
+}
+
+func Test_opF002(t *testing.T) {
+	cpu := NewCPU(QuirksXOCHIP)
+	cpu.LoadROM([]uint8{0xF0, 0x02})
+
+	cpu.i = 0x300
+	for n := 0; n < 16; n++ {
+		cpu.memory[0x300+n] = uint8(n + 1)
+	}
+
+	cpu.cycle()
+
+	if cpu.pc != 0x202 {
+		t.Fatalf("program counter did not increase by two\n")
+	}
+	if !cpu.hasPattern {
+		t.Fatalf("the pattern should be loaded\n")
+	}
+	for n, b := range cpu.pattern {
+		if b != uint8(n+1) {
+			t.Fatalf("pattern byte %d should be %d, was %d\n", n, n+1, b)
+		}
+	}
+	if cpu.i != 0x300 {
+		t.Fatalf("i should not be modified, was 0x%X\n", cpu.i)
+	}
+}
+
+func Test_opFX3A(t *testing.T) {
+	cpu := NewCPU(QuirksXOCHIP)
+	cpu.LoadROM([]uint8{0xF4, 0x3A})
+
+	if cpu.pitch != 64 {
+		t.Fatalf("pitch should start at 64, was %d\n", cpu.pitch)
+	}
+	cpu.v[0x4] = 112
+
+	cpu.cycle()
+
+	if cpu.pitch != 112 {
+		t.Fatalf("pitch should be 112, was %d\n", cpu.pitch)
+	}
+	if rate := patternRate(cpu.pitch); rate != 8000 {
+		t.Fatalf("pitch 112 should play the pattern at 8000Hz, was %v\n", rate)
+	}
+}
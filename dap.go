@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/pthm/gate/dap"
+	"net"
+)
+
+// dapCommand serves the Debug Adapter Protocol so editors can debug ROMs, which run in a raylib window. Clients
+// either launch a program or attach to the ROM given on the command line
+func dapCommand(args []string) error {
+	flags := flag.NewFlagSet("dap", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gate dap [flags] [rom.ch8|game.8o|source.asm]")
+		flags.PrintDefaults()
+	}
+	listen := flags.String("listen", ":4711", "address to accept debug clients on")
+	machine := addMachineFlags(flags)
+
+	flags.Parse(args)
+	romPath := flags.Arg(0)
+
+	chip8, err := machine.emptyCPU()
+	if err != nil {
+		return err
+	}
+	server := dap.NewServer(chip8, loadProgram)
+
+	if romPath != "" {
+		program, err := loadProgram(romPath)
+		if err != nil {
+			return err
+		}
+		if err := chip8.LoadROM(program.Binary); err != nil {
+			return err
+		}
+		server.SetProgram(program, romPath)
+	} else {
+		chip8.Pause() // Nothing to run until a client launches a program
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	fmt.Printf("Listening for debug clients on %s\n", ln.Addr())
+	go server.Serve(ln)
+
+	rlRenderer, err := openWindow(chip8, machine)
+	if err != nil {
+		return err
+	}
+	defer rlRenderer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go chip8.Run(ctx)
+	rlRenderer.Run()
+	return nil
+}
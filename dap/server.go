@@ -0,0 +1,614 @@
+// Package dap serves the Debug Adapter Protocol, so editors such as VS Code can debug ROMs running on a CPU
+package dap
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pthm/gate/asm"
+	"github.com/pthm/gate/cpu"
+	"github.com/pthm/gate/disasm"
+)
+
+// threadID is the only thread, CHIP-8 has one
+const threadID = 1
+
+// Variable references of the scopes
+const (
+	registersReference = 1
+	timersReference    = 2
+)
+
+// Server exposes a CPU to debug clients. It serves one client at a time, the CPU and its breakpoints are shared
+// between them
+type Server struct {
+	cpu  *cpu.CPU
+	load func(path string) (*asm.Output, error)
+
+	mu                     sync.Mutex
+	program                *asm.Output // Symbols and source lines of the loaded program, may be nil
+	syntax                 disasm.Syntax
+	sourceBreakpoints      map[string]map[uint16]*cpu.Condition // Breakpoints set on the lines of each source file
+	instructionBreakpoints map[uint16]*cpu.Condition
+}
+
+// NewServer creates a server for chip8. load reads the program a client launches, compiling it if need be
+func NewServer(chip8 *cpu.CPU, load func(path string) (*asm.Output, error)) *Server {
+	return &Server{
+		cpu:                    chip8,
+		load:                   load,
+		syntax:                 disasm.Octo,
+		sourceBreakpoints:      map[string]map[uint16]*cpu.Condition{},
+		instructionBreakpoints: map[uint16]*cpu.Condition{},
+	}
+}
+
+// SetProgram sets the symbols and source lines of a program already loaded into the CPU, for clients that attach
+// rather than launch
+func (s *Server) SetProgram(program *asm.Output, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.program = program
+	s.syntax = disasm.Octo
+	if strings.EqualFold(filepath.Ext(path), ".asm") {
+		s.syntax = disasm.Cowgod
+	}
+}
+
+// Serve accepts clients from ln one at a time until ln is closed
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		if err := s.ServeConn(conn); err != nil {
+			fmt.Printf("Debug session ended: %v\n", err)
+		}
+		conn.Close()
+	}
+}
+
+// ServeConn runs a debug session over conn until the client disconnects
+func (s *Server) ServeConn(conn io.ReadWriter) error {
+	sess := &session{server: s, w: &writer{w: conn}}
+
+	s.cpu.SetStopHandler(sess.stopped)
+	defer s.cpu.SetStopHandler(nil)
+
+	r := bufio.NewReader(conn)
+	for {
+		var req request
+		if err := readMessage(r, &req); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		body, err := sess.handle(&req)
+		resp := &response{RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		if err := sess.w.write(resp); err != nil {
+			return err
+		}
+
+		if sess.afterResponse != nil {
+			sess.afterResponse()
+			sess.afterResponse = nil
+		}
+		if sess.done {
+			return nil
+		}
+	}
+}
+
+// session is the state of one client
+type session struct {
+	server        *Server
+	w             *writer
+	stopOnEntry   bool   // Whether to stay paused when configuration is done
+	afterResponse func() // Run once the response is written, for events that must follow it
+	done          bool
+
+	mu         sync.Mutex // Guards the fields the stop handler reads, it runs on the CPU's goroutine
+	configured bool       // Set by configurationDone, stops before it are the client's entry stop
+	entry      bool       // Set until the entry stop is reported
+}
+
+func (sess *session) event(name string, body any) {
+	if err := sess.w.write(&event{Event: name, Body: body}); err != nil {
+		fmt.Printf("Could not send %s event: %v\n", name, err)
+	}
+}
+
+// stopped is the CPU's stop handler
+func (sess *session) stopped(stop cpu.Stop) {
+	sess.mu.Lock()
+	configured, entry := sess.configured, sess.entry && stop.Reason == cpu.StopPause
+	if entry {
+		sess.entry = false
+	}
+	sess.mu.Unlock()
+
+	if !configured {
+		return // Launch pauses the CPU, whether the client sees a stop depends on stopOnEntry
+	}
+	if entry {
+		sess.event("stopped", map[string]any{"reason": "entry", "threadId": threadID, "allThreadsStopped": true})
+		return
+	}
+
+	reason := map[cpu.StopReason]string{
+		cpu.StopPause:      "pause",
+		cpu.StopStep:       "step",
+		cpu.StopBreakpoint: "breakpoint",
+		cpu.StopWatchpoint: "data breakpoint",
+		cpu.StopCondition:  "breakpoint",
+	}[stop.Reason]
+
+	description := fmt.Sprintf("Paused on %s at 0x%03X", stop.Reason, stop.PC)
+	if stop.Reason == cpu.StopCondition {
+		description = fmt.Sprintf("Paused as %s", stop.Condition)
+	}
+	sess.event("stopped", map[string]any{
+		"reason":            reason,
+		"description":       description,
+		"threadId":          threadID,
+		"allThreadsStopped": true,
+	})
+}
+
+func (sess *session) handle(req *request) (any, error) {
+	s := sess.server
+	chip8 := s.cpu
+
+	switch req.Command {
+	case "initialize":
+		return capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsConditionalBreakpoints:   true,
+			SupportsInstructionBreakpoints:   true,
+			SupportsSetVariable:              true,
+			SupportsReadMemoryRequest:        true,
+			SupportsDisassembleRequest:       true,
+			SupportsSteppingGranularity:      true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		if args.Program == "" {
+			return nil, errors.New("launch needs a program")
+		}
+		program, err := s.load(args.Program)
+		if err != nil {
+			return nil, err
+		}
+		chip8.Pause()
+		if err := chip8.ReloadROM(program.Binary); err != nil {
+			return nil, err
+		}
+		s.SetProgram(program, args.Program)
+		sess.stopOnEntry = args.StopOnEntry
+		// The client sends breakpoints once it sees initialized, which must come after the program is loaded
+		sess.afterResponse = func() { sess.event("initialized", nil) }
+		return nil, nil
+	case "attach":
+		var args launchArguments
+		json.Unmarshal(req.Arguments, &args)
+		sess.stopOnEntry = args.StopOnEntry
+		if sess.stopOnEntry {
+			chip8.Pause()
+		}
+		sess.afterResponse = func() { sess.event("initialized", nil) }
+		return nil, nil
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]any{"breakpoints": s.setSourceBreakpoints(args)}, nil
+	case "setInstructionBreakpoints":
+		var args setInstructionBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]any{"breakpoints": s.setInstructionBreakpoints(args)}, nil
+	case "setExceptionBreakpoints":
+		return map[string]any{"breakpoints": []breakpoint{}}, nil
+	case "configurationDone":
+		sess.mu.Lock()
+		sess.configured = true
+		sess.entry = sess.stopOnEntry
+		sess.mu.Unlock()
+		if sess.stopOnEntry {
+			// Pausing again reports a stop, which the client is told about as the entry stop
+			chip8.Pause()
+			return nil, nil
+		}
+		chip8.Resume()
+		return nil, nil
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": threadID, "name": "CHIP-8"}}}, nil
+	case "stackTrace":
+		frames := s.stackTrace()
+		return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		return map[string]any{"scopes": []scope{
+			{Name: "Registers", VariablesReference: registersReference},
+			{Name: "Timers", VariablesReference: timersReference},
+		}}, nil
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]any{"variables": s.variables(args.VariablesReference)}, nil
+	case "setVariable":
+		var args setVariableArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		reg, err := cpu.ParseRegister(args.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseUint(args.Value, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", args.Value)
+		}
+		chip8.SetRegister(reg, uint16(value))
+		return registerVariable(reg, chip8.Register(reg)), nil
+	case "continue":
+		chip8.Resume()
+		return map[string]any{"allThreadsContinued": true}, nil
+	case "next":
+		chip8.StepOver()
+		return nil, nil
+	case "stepIn":
+		chip8.Step()
+		return nil, nil
+	case "stepOut":
+		return nil, chip8.StepOut()
+	case "pause":
+		chip8.Pause()
+		return nil, nil
+	case "readMemory":
+		var args readMemoryArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.readMemory(args)
+	case "disassemble":
+		var args disassembleArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.disassemble(args)
+	case "evaluate":
+		var args evaluateArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args.Expression)
+	case "disconnect", "terminate":
+		// Leave the game running without the client's breakpoints
+		s.clearBreakpoints()
+		chip8.Resume()
+		sess.done = true
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request %s", req.Command)
+}
+
+// setSourceBreakpoints replaces the breakpoints of a source file, each moves to the first line with code
+func (s *Server) setSourceBreakpoints(args setBreakpointsArguments) []breakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := args.Source.Path
+	addrs := map[uint16]*cpu.Condition{}
+	results := make([]breakpoint, len(args.Breakpoints))
+	for n, bp := range args.Breakpoints {
+		result := breakpoint{Source: &args.Source, Line: bp.Line}
+		cond, err := parseCondition(bp.Condition)
+
+		var line asm.Line
+		found := false
+		if s.program != nil {
+			line, found = s.program.AddrOf(path, bp.Line)
+		}
+		switch {
+		case err != nil:
+			result.Message = err.Error()
+		case !found:
+			result.Message = "No code at or after this line"
+		default:
+			result.Verified = true
+			result.Line = line.Line
+			result.InstructionReference = reference(line.Addr)
+			addrs[line.Addr] = cond
+		}
+		results[n] = result
+	}
+
+	s.sourceBreakpoints[path] = addrs
+	s.syncBreakpoints()
+	return results
+}
+
+func (s *Server) setInstructionBreakpoints(args setInstructionBreakpointsArguments) []breakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.instructionBreakpoints = map[uint16]*cpu.Condition{}
+	results := make([]breakpoint, len(args.Breakpoints))
+	for n, bp := range args.Breakpoints {
+		base, err := parseReference(bp.InstructionReference)
+		if err != nil {
+			results[n] = breakpoint{Message: err.Error()}
+			continue
+		}
+		cond, err := parseCondition(bp.Condition)
+		if err != nil {
+			results[n] = breakpoint{Message: err.Error()}
+			continue
+		}
+		addr := uint16(base + bp.Offset)
+		s.instructionBreakpoints[addr] = cond
+		results[n] = breakpoint{Verified: true, InstructionReference: reference(addr)}
+	}
+
+	s.syncBreakpoints()
+	return results
+}
+
+func (s *Server) clearBreakpoints() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sourceBreakpoints = map[string]map[uint16]*cpu.Condition{}
+	s.instructionBreakpoints = map[uint16]*cpu.Condition{}
+	s.syncBreakpoints()
+}
+
+// syncBreakpoints sets the CPU's breakpoints to those of every source plus the instruction breakpoints, the caller
+// must hold s.mu
+func (s *Server) syncBreakpoints() {
+	s.cpu.ClearBreakpoints()
+	set := func(addrs map[uint16]*cpu.Condition) {
+		for addr, cond := range addrs {
+			if cond != nil {
+				s.cpu.SetConditionalBreakpoint(addr, *cond)
+			} else {
+				s.cpu.SetBreakpoint(addr)
+			}
+		}
+	}
+	for _, addrs := range s.sourceBreakpoints {
+		set(addrs)
+	}
+	set(s.instructionBreakpoints)
+}
+
+// stackTrace derives frames from the CPU stack, the stack holds the address of each call
+func (s *Server) stackTrace() []stackFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addrs := []uint16{s.cpu.Register(cpu.RegPC)}
+	stack := s.cpu.Stack()
+	for n := len(stack) - 1; n >= 0; n-- {
+		addrs = append(addrs, stack[n])
+	}
+
+	frames := make([]stackFrame, len(addrs))
+	for n, addr := range addrs {
+		frame := stackFrame{ID: n, Name: s.symbolize(addr), InstructionPointerReference: reference(addr)}
+		if s.program != nil {
+			if line, ok := s.program.LineAt(addr); ok {
+				frame.Source = &source{Name: filepath.Base(line.File), Path: line.File}
+				frame.Line, frame.Column = line.Line, 1
+			}
+		}
+		frames[n] = frame
+	}
+	return frames
+}
+
+// symbolize names an address by the closest label at or before it, e.g. draw+0x4
+func (s *Server) symbolize(addr uint16) string {
+	best, bestAddr := "", uint16(0)
+	if s.program != nil {
+		for name, labelAddr := range s.program.Labels {
+			if labelAddr <= addr && (best == "" || labelAddr > bestAddr || labelAddr == bestAddr && name < best) {
+				best, bestAddr = name, labelAddr
+			}
+		}
+	}
+	switch {
+	case best == "":
+		return reference(addr)
+	case bestAddr == addr:
+		return best
+	}
+	return fmt.Sprintf("%s+0x%X", best, addr-bestAddr)
+}
+
+func (s *Server) variables(ref int) []variable {
+	var regs []cpu.Register
+	switch ref {
+	case registersReference:
+		for r := cpu.RegV0; r <= cpu.RegSP; r++ {
+			regs = append(regs, r)
+		}
+	case timersReference:
+		regs = []cpu.Register{cpu.RegDT, cpu.RegST}
+	}
+
+	vars := make([]variable, len(regs))
+	for n, r := range regs {
+		vars[n] = registerVariable(r, s.cpu.Register(r))
+	}
+	return vars
+}
+
+func registerVariable(r cpu.Register, value uint16) variable {
+	v := variable{Name: r.String(), Value: fmt.Sprintf("0x%02X", value), Type: "uint8"}
+	switch r {
+	case cpu.RegI:
+		// I usually points at sprites or data, let the client open it in a memory view
+		v.Value, v.Type, v.MemoryReference = fmt.Sprintf("0x%03X", value), "uint16", reference(value)
+	case cpu.RegPC:
+		v.Value, v.Type = fmt.Sprintf("0x%03X", value), "uint16"
+	case cpu.RegSP:
+		v.Value, v.Type = strconv.Itoa(int(value)), "uint16"
+	}
+	return v
+}
+
+func (s *Server) readMemory(args readMemoryArguments) (any, error) {
+	base, err := parseReference(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+	start := base + args.Offset
+	if start < 0 || start > 0xFFFF || args.Count <= 0 {
+		return map[string]any{"address": reference(uint16(max(start, 0))), "unreadableBytes": max(args.Count, 0)}, nil
+	}
+
+	// The count comes from the client, anything past the end of memory is reported as unreadable
+	data := s.cpu.ReadMemory(uint16(start), min(args.Count, 0x10000-start))
+	return map[string]any{
+		"address":         reference(uint16(start)),
+		"data":            base64.StdEncoding.EncodeToString(data),
+		"unreadableBytes": args.Count - len(data),
+	}, nil
+}
+
+// maxDisassemble is the most instructions a disassemble request returns, enough to cover all of memory
+const maxDisassemble = 0x10000 / 2
+
+// disassemble decodes instructions around a reference. Instructions are two bytes apart except for the four byte
+// i := long, so negative instruction offsets step back two bytes at a time
+func (s *Server) disassemble(args disassembleArguments) (any, error) {
+	base, err := parseReference(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	memory := s.cpu.ReadMemory(0, 0x10000)
+	names := map[uint16]string{}
+	var lines []asm.Line
+	if s.program != nil {
+		for name, addr := range s.program.Labels {
+			if existing, ok := names[addr]; !ok || name < existing {
+				names[addr] = name
+			}
+		}
+		// In address order, so they can be walked alongside the instructions rather than searched for each one
+		lines = slices.Clone(s.program.Lines)
+		slices.SortStableFunc(lines, func(a, b asm.Line) int { return cmp.Compare(a.Addr, b.Addr) })
+	}
+	labels := func(addr uint16) (string, bool) {
+		name, ok := names[addr]
+		return name, ok
+	}
+
+	// The count comes from the client, so keep it to what could fit in memory
+	count := min(max(args.InstructionCount, 0), maxDisassemble)
+	addr := base + args.Offset + args.InstructionOffset*2
+	instructions := make([]disassembledInstruction, 0, count)
+	for n := 0; n < count; n++ {
+		if addr < 0 || addr > 0xFFFF {
+			instructions = append(instructions, disassembledInstruction{Address: fmt.Sprintf("0x%X", addr), Instruction: "??"})
+			addr += 2
+			continue
+		}
+
+		in := disasm.DecodeAt(memory, uint16(addr))
+		d := disassembledInstruction{
+			Address:          reference(uint16(addr)),
+			Instruction:      disasm.Format(in, s.syntax, labels),
+			InstructionBytes: hex.EncodeToString(memory[addr:min(addr+in.Size, len(memory))]),
+			Symbol:           names[uint16(addr)],
+		}
+		for len(lines) > 0 && int(lines[0].Addr)+lines[0].Size <= addr {
+			lines = lines[1:]
+		}
+		if len(lines) > 0 && int(lines[0].Addr) <= addr {
+			d.Location, d.Line = &source{Name: filepath.Base(lines[0].File), Path: lines[0].File}, lines[0].Line
+		}
+		instructions = append(instructions, d)
+		addr += in.Size
+	}
+	return map[string]any{"instructions": instructions}, nil
+}
+
+// evaluate looks up a register or label, for hovers and the watch view
+func (s *Server) evaluate(expr string) (any, error) {
+	expr = strings.TrimSpace(expr)
+	if reg, err := cpu.ParseRegister(expr); err == nil {
+		v := registerVariable(reg, s.cpu.Register(reg))
+		return map[string]any{"result": v.Value, "type": v.Type, "variablesReference": 0, "memoryReference": v.MemoryReference}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.program != nil {
+		if addr, ok := s.program.Labels[expr]; ok {
+			return map[string]any{"result": reference(addr), "variablesReference": 0, "memoryReference": reference(addr)}, nil
+		}
+		if value, ok := s.program.Constants[expr]; ok {
+			return map[string]any{"result": strconv.Itoa(value), "variablesReference": 0}, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not a register, label or constant", expr)
+}
+
+// reference formats an address as a memory or instruction reference
+func reference(addr uint16) string {
+	return fmt.Sprintf("0x%03X", addr)
+}
+
+func parseReference(ref string) (int, error) {
+	addr, err := strconv.ParseUint(ref, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory reference %q", ref)
+	}
+	return int(addr), nil
+}
+
+// parseCondition parses a breakpoint condition, an empty condition means the breakpoint always stops
+func parseCondition(s string) (*cpu.Condition, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	cond, err := cpu.ParseCondition(s)
+	if err != nil {
+		return nil, err
+	}
+	return &cond, nil
+}
@@ -0,0 +1,214 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pthm/gate/asm"
+	"github.com/pthm/gate/cpu"
+)
+
+const testSource = `main:
+	LD V0, 5
+	CALL sub
+loop:
+	JP loop
+; the subroutine
+sub:
+	ADD V0, 1
+	RET
+`
+
+// message is any message from the server, decoded loosely
+type message struct {
+	Type       string          `json:"type"`
+	Event      string          `json:"event"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type testClient struct {
+	t        *testing.T
+	conn     net.Conn
+	w        *writer
+	seq      int
+	messages chan message
+}
+
+func newTestClient(t *testing.T, conn net.Conn) *testClient {
+	c := &testClient{t: t, conn: conn, w: &writer{w: conn}, messages: make(chan message, 100)}
+	go func() {
+		r := bufio.NewReader(conn)
+		for {
+			var msg message
+			if err := readMessage(r, &msg); err != nil {
+				close(c.messages)
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	return c
+}
+
+func (c *testClient) next() message {
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("connection closed\n")
+		}
+		return msg
+	case <-time.After(time.Second):
+		c.t.Fatalf("timed out waiting for a message\n")
+	}
+	return message{}
+}
+
+// request sends a request and decodes the body of its response into body
+func (c *testClient) request(command string, args any, body any) {
+	c.seq++
+	raw, _ := json.Marshal(args)
+	c.w.write(&request{Seq: c.seq, Type: "request", Command: command, Arguments: raw})
+
+	msg := c.next()
+	if msg.Type != "response" || msg.RequestSeq != c.seq {
+		c.t.Fatalf("expected the response to %s, got %+v\n", command, msg)
+	}
+	if !msg.Success {
+		c.t.Fatalf("%s failed: %s\n", command, msg.Message)
+	}
+	if body != nil {
+		json.Unmarshal(msg.Body, body)
+	}
+}
+
+// expectEvent reads the next message, which must be the named event
+func (c *testClient) expectEvent(name string) map[string]any {
+	msg := c.next()
+	if msg.Type != "event" || msg.Event != name {
+		c.t.Fatalf("expected a %s event, got %+v\n", name, msg)
+	}
+	var body map[string]any
+	json.Unmarshal(msg.Body, &body)
+	return body
+}
+
+func Test_serverSession(t *testing.T) {
+	chip8 := cpu.NewCPU(cpu.QuirksVIP)
+	server := NewServer(chip8, func(path string) (*asm.Output, error) {
+		return asm.Assemble(path, []byte(testSource))
+	})
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go server.ServeConn(serverConn)
+	client := newTestClient(t, clientConn)
+
+	var caps capabilities
+	client.request("initialize", map[string]any{"adapterID": "gate"}, &caps)
+	if !caps.SupportsDisassembleRequest || !caps.SupportsReadMemoryRequest {
+		t.Fatalf("capabilities should include disassemble and readMemory, got %+v\n", caps)
+	}
+
+	client.request("launch", launchArguments{Program: "game.asm", StopOnEntry: true}, nil)
+	client.expectEvent("initialized")
+
+	// Line 6 is a comment, so the breakpoint moves to the ADD on line 8
+	var bps struct{ Breakpoints []breakpoint }
+	client.request("setBreakpoints", setBreakpointsArguments{
+		Source:      source{Path: "game.asm"},
+		Breakpoints: []sourceBreakpoint{{Line: 6}},
+	}, &bps)
+	if len(bps.Breakpoints) != 1 || !bps.Breakpoints[0].Verified || bps.Breakpoints[0].Line != 8 ||
+		bps.Breakpoints[0].InstructionReference != "0x206" {
+		t.Fatalf("breakpoint should be verified on line 8 at 0x206, got %+v\n", bps.Breakpoints)
+	}
+
+	client.request("configurationDone", nil, nil)
+	chip8.RunFrame()
+	if stopped := client.expectEvent("stopped"); stopped["reason"] != "entry" {
+		t.Fatalf("should stop on entry, got %v\n", stopped)
+	}
+
+	client.request("continue", map[string]any{"threadId": threadID}, nil)
+	chip8.RunFrame()
+	if stopped := client.expectEvent("stopped"); stopped["reason"] != "breakpoint" {
+		t.Fatalf("should stop at the breakpoint, got %v\n", stopped)
+	}
+
+	var trace struct{ StackFrames []stackFrame }
+	client.request("stackTrace", map[string]any{"threadId": threadID}, &trace)
+	frames := trace.StackFrames
+	if len(frames) != 2 || frames[0].Name != "sub" || frames[0].Line != 8 || frames[1].Name != "main+0x2" || frames[1].Line != 3 {
+		t.Fatalf("stack should be sub on line 8 called from main+0x2 on line 3, got %+v\n", frames)
+	}
+
+	var vars struct{ Variables []variable }
+	client.request("variables", map[string]any{"variablesReference": registersReference}, &vars)
+	if vars.Variables[0].Name != "V0" || vars.Variables[0].Value != "0x05" {
+		t.Fatalf("V0 should be 0x05, got %+v\n", vars.Variables[0])
+	}
+
+	var mem struct{ Address, Data string }
+	client.request("readMemory", readMemoryArguments{MemoryReference: "0x200", Count: 4}, &mem)
+	if mem.Address != "0x200" || mem.Data != "YAUiBg==" {
+		t.Fatalf("memory at 0x200 should be 60 05 22 06, got %+v\n", mem)
+	}
+
+	var dis struct{ Instructions []disassembledInstruction }
+	client.request("disassemble", disassembleArguments{MemoryReference: "0x206", InstructionCount: 2}, &dis)
+	got := fmt.Sprint(dis.Instructions[0].Instruction, "; ", dis.Instructions[1].Instruction)
+	if got != "ADD V0, 0x01; RET" || dis.Instructions[0].Symbol != "sub" || dis.Instructions[1].Line != 9 {
+		t.Fatalf("disassembly should use the source's syntax and lines, got %+v\n", dis.Instructions)
+	}
+
+	client.request("disconnect", nil, nil)
+	if chip8.Paused() || len(chip8.Breakpoints()) != 0 {
+		t.Fatalf("disconnecting should clear breakpoints and resume\n")
+	}
+}
+
+func Test_disassembleCount(t *testing.T) {
+	chip8 := cpu.NewCPU(cpu.QuirksVIP)
+	program, err := asm.Assemble("test.asm", []byte(testSource))
+	if err != nil {
+		t.Fatalf("could not assemble: %v\n", err)
+	}
+	chip8.LoadROM(program.Binary)
+	server := NewServer(chip8, nil)
+	server.SetProgram(program, "test.asm")
+
+	count := func(n int) int {
+		body, err := server.disassemble(disassembleArguments{MemoryReference: "0x200", InstructionCount: n})
+		if err != nil {
+			t.Fatalf("could not disassemble: %v\n", err)
+		}
+		return len(body.(map[string]any)["instructions"].([]disassembledInstruction))
+	}
+	if n := count(-1); n != 0 {
+		t.Fatalf("a negative count should disassemble nothing, got %d instructions\n", n)
+	}
+	if n := count(1 << 30); n != maxDisassemble {
+		t.Fatalf("a huge count should be capped at %d, got %d instructions\n", maxDisassemble, n)
+	}
+}
+
+func Test_readMemoryCount(t *testing.T) {
+	server := NewServer(cpu.NewCPU(cpu.QuirksVIP), nil)
+
+	body, err := server.readMemory(readMemoryArguments{MemoryReference: "0xFFFE", Count: math.MaxInt})
+	if err != nil {
+		t.Fatalf("could not read memory: %v\n", err)
+	}
+	mem := body.(map[string]any)
+	if mem["data"] != "AAA=" || mem["unreadableBytes"] != math.MaxInt-2 {
+		t.Fatalf("a huge count should read to the end of memory and report the rest as unreadable, got %+v\n", mem)
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/pthm/gate/cpu"
+	"github.com/pthm/gate/disasm"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+// debugCommand runs a ROM paused in a raylib window, driven by a console on stdin
+func debugCommand(args []string) error {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gate debug [flags] rom.ch8|game.8o|source.asm")
+		flags.PrintDefaults()
+	}
+	machine := addMachineFlags(flags)
+
+	flags.Parse(args)
+	romPath := flags.Arg(0)
+
+	if romPath == "" {
+		return errors.New("must supply a path to a ROM")
+	}
+
+	// Load the program once, the console needs its labels as well as its binary
+	program, err := loadProgram(romPath)
+	if err != nil {
+		return err
+	}
+	chip8, err := machine.emptyCPU()
+	if err != nil {
+		return err
+	}
+	if err := chip8.LoadROM(program.Binary); err != nil {
+		return err
+	}
+
+	// Quitting the console closes the window, so everything runWindow opened is closed on the way out
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	console := newConsole(chip8, program.Labels, os.Stdout)
+	chip8.Pause()
+	go func() {
+		console.run(os.Stdin)
+		cancel()
+	}()
+	return runWindow(ctx, chip8, romPath, machine)
+}
+
+// console is a command line debugger
+type console struct {
+	chip8  *cpu.CPU
+	labels map[string]uint16
+	names  map[uint16]string
+	stops  chan cpu.Stop
+	out    io.Writer
+}
+
+func newConsole(chip8 *cpu.CPU, labels map[string]uint16, out io.Writer) *console {
+	c := &console{
+		chip8:  chip8,
+		labels: labels,
+		names:  map[uint16]string{},
+		stops:  make(chan cpu.Stop, 1),
+		out:    out,
+	}
+	for name, addr := range labels {
+		if existing, ok := c.names[addr]; !ok || name < existing {
+			c.names[addr] = name
+		}
+	}
+	chip8.SetStopHandler(func(stop cpu.Stop) {
+		// Stops the console isn't waiting for replace older ones, the CPU must not block on the console
+		select {
+		case <-c.stops:
+		default:
+		}
+		c.stops <- stop
+	})
+	return c
+}
+
+const consoleHelp = `commands:
+  c, continue              run until a breakpoint, watchpoint or condition stops execution, ctrl-c pauses
+  s, step [n]              execute n instructions, default 1
+  n, next                  step, running calls until they return
+  finish                   run until the current subroutine returns
+  b, break <addr> [if <reg> <op> <value>]
+                           stop when PC reaches addr, addresses may be labels
+  watch <addr> [len] [r|w|rw]
+                           stop after an instruction accesses memory, default 1 byte written
+  when <reg> <op> <value>  stop when a condition becomes true, e.g. when v3 == 5
+  d, delete [addr | <reg> <op> <value>]
+                           remove breakpoints and watchpoints at addr, a condition, or everything
+  info                     list breakpoints, watchpoints and conditions
+  r, regs                  show the registers
+  set <reg> <value>        set a register
+  x <addr> [n]             dump n bytes of memory, default 16
+  l, list [addr] [n]       disassemble n instructions from addr, default PC
+  bt, stack                show the call stack
+  reset                    reset the machine
+  q, quit                  exit`
+
+// run reads commands until input ends or quit is entered
+func (c *console) run(in io.Reader) {
+	c.waitStop() // The CPU starts paused
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(c.out, "(gate) ")
+		if !scanner.Scan() {
+			return
+		}
+		quit, err := c.exec(scanner.Text())
+		if err != nil {
+			fmt.Fprintln(c.out, err)
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// exec runs a command, it reports true when the console should exit
+func (c *console) exec(line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	command, args := fields[0], fields[1:]
+
+	switch command {
+	case "help", "h", "?":
+		fmt.Fprintln(c.out, consoleHelp)
+	case "c", "continue":
+		c.chip8.Resume()
+		c.waitStop()
+	case "s", "step":
+		count := 1
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return false, fmt.Errorf("invalid step count %q", args[0])
+			}
+			count = n
+		}
+		for n := 0; n < count; n++ {
+			c.chip8.Step()
+			// Only the last step is shown, unless something else stops execution first
+			if stop := c.wait(); stop.Reason != cpu.StopStep || n == count-1 {
+				c.show(stop)
+				break
+			}
+		}
+	case "n", "next":
+		c.chip8.StepOver()
+		c.waitStop()
+	case "finish":
+		if err := c.chip8.StepOut(); err != nil {
+			return false, err
+		}
+		c.waitStop()
+	case "b", "break":
+		return false, c.setBreakpoint(args)
+	case "watch":
+		w, err := c.parseWatchpoint(args)
+		if err != nil {
+			return false, err
+		}
+		c.chip8.AddWatchpoint(w)
+	case "when":
+		cond, err := cpu.ParseCondition(strings.Join(args, " "))
+		if err != nil {
+			return false, err
+		}
+		c.chip8.AddCondition(cond)
+	case "d", "delete":
+		return false, c.delete(args)
+	case "info":
+		c.info()
+	case "r", "regs":
+		c.registers()
+	case "set":
+		if len(args) != 2 {
+			return false, fmt.Errorf("usage: set <reg> <value>")
+		}
+		reg, err := cpu.ParseRegister(args[0])
+		if err != nil {
+			return false, err
+		}
+		value, err := strconv.ParseUint(args[1], 0, 16)
+		if err != nil {
+			return false, fmt.Errorf("invalid value %q", args[1])
+		}
+		c.chip8.SetRegister(reg, uint16(value))
+	case "x":
+		return false, c.dump(args)
+	case "l", "list":
+		return false, c.list(args)
+	case "bt", "stack":
+		c.stack()
+	case "reset":
+		c.chip8.Reset()
+	case "q", "quit":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown command %q, try help", command)
+	}
+	return false, nil
+}
+
+// wait blocks until execution stops, ctrl-c pauses execution
+func (c *console) wait() cpu.Stop {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	for {
+		select {
+		case stop := <-c.stops:
+			return stop
+		case <-interrupt:
+			c.chip8.Pause()
+		}
+	}
+}
+
+func (c *console) waitStop() {
+	c.show(c.wait())
+}
+
+// show describes a stop and the instruction execution stopped at
+func (c *console) show(stop cpu.Stop) {
+	switch stop.Reason {
+	case cpu.StopBreakpoint:
+		fmt.Fprintf(c.out, "Breakpoint at %s\n", c.address(stop.PC))
+	case cpu.StopWatchpoint:
+		access := "read"
+		if stop.Write {
+			access = "written"
+		}
+		fmt.Fprintf(c.out, "Watchpoint, %s was %s\n", c.address(stop.Addr), access)
+	case cpu.StopCondition:
+		fmt.Fprintf(c.out, "Condition %s became true\n", stop.Condition)
+	case cpu.StopPause:
+		fmt.Fprintf(c.out, "Paused at %s\n", c.address(stop.PC))
+	}
+	c.disassemble(stop.PC, 1)
+}
+
+// address formats an address with its label, if it has one
+func (c *console) address(addr uint16) string {
+	if name, ok := c.names[addr]; ok {
+		return fmt.Sprintf("0x%03X (%s)", addr, name)
+	}
+	return fmt.Sprintf("0x%03X", addr)
+}
+
+// parseAddress parses a number or label
+func (c *console) parseAddress(s string) (uint16, error) {
+	if addr, ok := c.labels[s]; ok {
+		return addr, nil
+	}
+	addr, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an address or label", s)
+	}
+	return uint16(addr), nil
+}
+
+func (c *console) setBreakpoint(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: break <addr> [if <reg> <op> <value>]")
+	}
+	addr, err := c.parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		c.chip8.SetBreakpoint(addr)
+		return nil
+	}
+	if args[1] != "if" {
+		return fmt.Errorf("expected if after the address, found %q", args[1])
+	}
+	cond, err := cpu.ParseCondition(strings.Join(args[2:], " "))
+	if err != nil {
+		return err
+	}
+	c.chip8.SetConditionalBreakpoint(addr, cond)
+	return nil
+}
+
+func (c *console) parseWatchpoint(args []string) (cpu.Watchpoint, error) {
+	if len(args) == 0 || len(args) > 3 {
+		return cpu.Watchpoint{}, fmt.Errorf("usage: watch <addr> [len] [r|w|rw]")
+	}
+	addr, err := c.parseAddress(args[0])
+	if err != nil {
+		return cpu.Watchpoint{}, err
+	}
+	w := cpu.Watchpoint{Addr: addr, Len: 1, Kind: cpu.WatchWrite}
+	for _, arg := range args[1:] {
+		switch arg {
+		case "r":
+			w.Kind = cpu.WatchRead
+		case "w":
+			w.Kind = cpu.WatchWrite
+		case "rw":
+			w.Kind = cpu.WatchAccess
+		default:
+			length, err := strconv.ParseUint(arg, 0, 16)
+			if err != nil || length == 0 {
+				return cpu.Watchpoint{}, fmt.Errorf("invalid length %q", arg)
+			}
+			w.Len = uint16(length)
+		}
+	}
+	return w, nil
+}
+
+func (c *console) delete(args []string) error {
+	switch len(args) {
+	case 0:
+		c.chip8.ClearBreakpoints()
+		for _, w := range c.chip8.Watchpoints() {
+			c.chip8.RemoveWatchpoint(w)
+		}
+		for _, cond := range c.chip8.Conditions() {
+			c.chip8.RemoveCondition(cond)
+		}
+	case 1:
+		addr, err := c.parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		c.chip8.ClearBreakpoint(addr)
+		for _, w := range c.chip8.Watchpoints() {
+			if w.Addr == addr {
+				c.chip8.RemoveWatchpoint(w)
+			}
+		}
+	default:
+		cond, err := cpu.ParseCondition(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		c.chip8.RemoveCondition(cond)
+	}
+	return nil
+}
+
+func (c *console) info() {
+	for _, addr := range c.chip8.Breakpoints() {
+		fmt.Fprintf(c.out, "breakpoint %s\n", c.address(addr))
+	}
+	for _, w := range c.chip8.Watchpoints() {
+		kind := map[cpu.WatchKind]string{cpu.WatchRead: "r", cpu.WatchWrite: "w", cpu.WatchAccess: "rw"}[w.Kind]
+		fmt.Fprintf(c.out, "watchpoint %s %d %s\n", c.address(w.Addr), w.Len, kind)
+	}
+	for _, cond := range c.chip8.Conditions() {
+		fmt.Fprintf(c.out, "when %s\n", cond)
+	}
+}
+
+func (c *console) registers() {
+	for r := cpu.RegV0; r <= cpu.RegVF; r++ {
+		fmt.Fprintf(c.out, "%-2s %02X  ", r, c.chip8.Register(r))
+		if r%8 == 7 {
+			fmt.Fprintln(c.out)
+		}
+	}
+	fmt.Fprintf(c.out, "I  %03X  PC %s  SP %d  DT %02X  ST %02X\n", c.chip8.Register(cpu.RegI),
+		c.address(c.chip8.Register(cpu.RegPC)), c.chip8.Register(cpu.RegSP), c.chip8.Register(cpu.RegDT),
+		c.chip8.Register(cpu.RegST))
+}
+
+func (c *console) dump(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: x <addr> [n]")
+	}
+	addr, err := c.parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+	n := 16
+	if len(args) > 1 {
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+			return fmt.Errorf("invalid length %q", args[1])
+		}
+	}
+
+	data := c.chip8.ReadMemory(addr, n)
+	for row := 0; row < len(data); row += 16 {
+		fmt.Fprintf(c.out, "%04X ", int(addr)+row)
+		for _, b := range data[row:min(row+16, len(data))] {
+			fmt.Fprintf(c.out, " %02X", b)
+		}
+		fmt.Fprintln(c.out)
+	}
+	return nil
+}
+
+func (c *console) list(args []string) error {
+	addr := c.chip8.Register(cpu.RegPC)
+	n := 10
+	var err error
+	if len(args) > 0 {
+		if addr, err = c.parseAddress(args[0]); err != nil {
+			return err
+		}
+	}
+	if len(args) > 1 {
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+			return fmt.Errorf("invalid count %q", args[1])
+		}
+	}
+	c.disassemble(addr, n)
+	return nil
+}
+
+// disassemble prints n instructions from addr, marking the one at PC
+func (c *console) disassemble(addr uint16, n int) {
+	memory := c.chip8.ReadMemory(0, 0x10000)
+	pc := c.chip8.Register(cpu.RegPC)
+	labels := func(addr uint16) (string, bool) {
+		name, ok := c.names[addr]
+		return name, ok
+	}
+
+	for ; n > 0; n-- {
+		in := disasm.DecodeAt(memory, addr)
+		marker := "  "
+		if addr == pc {
+			marker = "=>"
+		}
+		if name, ok := c.names[addr]; ok {
+			fmt.Fprintf(c.out, "%s:\n", name)
+		}
+		fmt.Fprintf(c.out, "%s %03X  %02X%02X  %s\n", marker, addr, in.Opcode>>8, in.Opcode&0xFF,
+			disasm.Format(in, disasm.Octo, labels))
+		if int(addr)+in.Size > 0xFFFF {
+			return
+		}
+		addr += uint16(in.Size)
+	}
+}
+
+func (c *console) stack() {
+	fmt.Fprintf(c.out, "#0 %s\n", c.address(c.chip8.Register(cpu.RegPC)))
+	stack := c.chip8.Stack()
+	for n := len(stack) - 1; n >= 0; n-- {
+		// The stack holds the address of each call, execution continues after it
+		fmt.Fprintf(c.out, "#%d %s\n", len(stack)-n, c.address(stack[n]))
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"github.com/pthm/gate/cpu"
+	"strings"
+	"testing"
+)
+
+// consoleROM calls sub once then loops, sub adds 1 to V0
+var consoleROM = []uint8{
+	0x60, 0x05, // 0x200 LD V0, 5
+	0x22, 0x06, // 0x202 CALL sub
+	0x12, 0x04, // 0x204 JP 0x204
+	0x70, 0x01, // 0x206 ADD V0, 1
+	0x00, 0xEE, // 0x208 RET
+}
+
+// runConsole runs the console over input against a fresh CPU and returns what it wrote
+func runConsole(t *testing.T, input string) string {
+	chip8 := cpu.NewCPU(cpu.QuirksVIP)
+	if err := chip8.LoadROM(consoleROM); err != nil {
+		t.Fatalf("could not load ROM: %v\n", err)
+	}
+	chip8.SetHost(cpu.NopHost{})
+
+	var out strings.Builder
+	console := newConsole(chip8, map[string]uint16{"main": 0x200, "sub": 0x206}, &out)
+	chip8.Pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go chip8.Run(ctx)
+
+	console.run(strings.NewReader(input))
+	return out.String()
+}
+
+func Test_consoleBreakpoint(t *testing.T) {
+	out := runConsole(t, "b sub\nc\nbt\nr\nq\n")
+
+	for _, want := range []string{
+		"Paused at 0x200 (main)",
+		"Breakpoint at 0x206 (sub)",
+		"#0 0x206 (sub)\n#1 0x202\n",
+		"V0 05",
+		"SP 1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output should contain %q, got:\n%s\n", want, out)
+		}
+	}
+}
+
+func Test_consoleStep(t *testing.T) {
+	out := runConsole(t, "s 2\nfinish\nr\n")
+
+	if !strings.Contains(out, "=> 206") || !strings.Contains(out, "=> 204") {
+		t.Fatalf("should show the instruction at each stop, got:\n%s\n", out)
+	}
+	if !strings.Contains(out, "V0 06") {
+		t.Fatalf("finish should run the subroutine to its return, got:\n%s\n", out)
+	}
+}
+
+func Test_consoleMemory(t *testing.T) {
+	out := runConsole(t, "x main 4\nl sub 2\n")
+
+	if !strings.Contains(out, "0200  60 05 22 06\n") {
+		t.Fatalf("x should dump memory in hex, got:\n%s\n", out)
+	}
+	if !strings.Contains(out, "sub:\n   206  7001") || !strings.Contains(out, "   208  00EE") {
+		t.Fatalf("list should disassemble from a label, got:\n%s\n", out)
+	}
+}
+
+func Test_consoleWatchAndDelete(t *testing.T) {
+	out := runConsole(t, "b 0x204\nwatch 0x300 2 rw\nwhen v0 == 9\ninfo\nd\ninfo\n")
+
+	info := "breakpoint 0x204\nwatchpoint 0x300 2 rw\nwhen V0 == 0x9\n"
+	if !strings.Contains(out, info) {
+		t.Fatalf("info should list what was set, got:\n%s\n", out)
+	}
+	if strings.Count(out, "breakpoint 0x204") != 1 {
+		t.Fatalf("delete should remove everything, got:\n%s\n", out)
+	}
+}
+
+func Test_consoleErrors(t *testing.T) {
+	out := runConsole(t, "bogus\nb nowhere\nwatch 0x300 0\ns 0\nx\nset v0\n")
+
+	for _, want := range []string{
+		`unknown command "bogus", try help`,
+		`"nowhere" is not an address or label`,
+		`invalid length "0"`,
+		`invalid step count "0"`,
+		"usage: x <addr> [n]",
+		"usage: set <reg> <value>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output should contain %q, got:\n%s\n", want, out)
+		}
+	}
+}
+
+func Test_consoleParseAddress(t *testing.T) {
+	c := &console{labels: map[string]uint16{"sub": 0x206}}
+
+	tests := []struct {
+		s    string
+		want uint16
+		ok   bool
+	}{
+		{"sub", 0x206, true},
+		{"0x300", 0x300, true},
+		{"512", 0x200, true},
+		{"0x10000", 0, false},
+		{"nowhere", 0, false},
+	}
+	for _, test := range tests {
+		addr, err := c.parseAddress(test.s)
+		if (err == nil) != test.ok || addr != test.want {
+			t.Fatalf("parseAddress(%q) should return 0x%X, ok %v, got 0x%X, %v\n", test.s, test.want, test.ok, addr, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/pthm/gate/disasm"
+	"os"
+)
+
+// disasmCommand disassembles a ROM into a listing
+func disasmCommand(args []string) error {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gate disasm [flags] rom.ch8")
+		flags.PrintDefaults()
+	}
+	syntaxName := flags.String("syntax", "octo", "assembly syntax, octo or cowgod")
+	variantName := flags.String("variant", "xochip", "instruction set, chip8, schip or xochip. Instructions from later variants are treated as data")
+	outPath := flags.String("o", "", "write the listing to a file instead of stdout")
+
+	flags.Parse(args)
+	romPath := flags.Arg(0)
+	if romPath == "" {
+		return errors.New("must supply a path to a ROM")
+	}
+
+	syntax, err := disasm.ParseSyntax(*syntaxName)
+	if err != nil {
+		return err
+	}
+	variant, err := disasm.ParseVariant(*variantName)
+	if err != nil {
+		return err
+	}
+
+	rom, err := os.ReadFile(romPath)
+	if err != nil {
+		return fmt.Errorf("could not read ROM file at (%s): %w", romPath, err)
+	}
+
+	program := disasm.Disassemble(rom, disasm.Options{Variant: variant})
+
+	out := os.Stdout
+	if *outPath != "" {
+		out, err = os.Create(*outPath)
+		if err != nil {
+			return fmt.Errorf("could not create listing (%s): %w", *outPath, err)
+		}
+		defer out.Close()
+	}
+	return program.Write(out, syntax)
+}
@@ -0,0 +1,206 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DefaultOrigin is the address ROMs are loaded at
+const DefaultOrigin = 0x200
+
+// Options configure Disassemble
+type Options struct {
+	Origin  uint16  // Address the ROM is loaded at, DefaultOrigin when zero
+	Variant Variant // Instructions from later dialects are treated as data
+}
+
+// Program is a disassembled ROM
+type Program struct {
+	Origin       uint16
+	ROM          []byte
+	Instructions map[uint16]Instruction // Every instruction reached from the entry point, keyed by address
+	Labels       map[uint16]string      // Names for the addresses jumped to, called and pointed at by I
+}
+
+// Disassemble follows every path of execution from the start of the ROM to separate code from data. Jumps and
+// calls are followed, skips follow both outcomes, and BNNN is assumed to jump into a table at NNN. Anything not
+// reached is data
+func Disassemble(rom []byte, opts Options) *Program {
+	origin := opts.Origin
+	if origin == 0 {
+		origin = DefaultOrigin
+	}
+	end := int(origin) + len(rom)
+
+	// Lay the ROM out as it would be in memory so instructions decode with their real addresses
+	memory := make([]byte, end)
+	copy(memory[origin:], rom)
+
+	p := &Program{
+		Origin:       origin,
+		ROM:          rom,
+		Instructions: map[uint16]Instruction{},
+		Labels:       map[uint16]string{},
+	}
+
+	inROM := func(addr uint16) bool {
+		return int(addr) >= int(origin) && int(addr) < end
+	}
+	claimed := make([]bool, len(rom)) // Bytes that belong to an instruction
+
+	work := []uint16{origin}
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		for inROM(addr) {
+			if _, seen := p.Instructions[addr]; seen {
+				break
+			}
+			in := DecodeAt(memory, addr)
+			if !in.Valid() || in.Variant > opts.Variant || int(addr)+in.Size > end {
+				break
+			}
+			overlaps := false
+			for b := 0; b < in.Size; b++ {
+				overlaps = overlaps || claimed[int(addr)-int(origin)+b]
+			}
+			if overlaps {
+				break // Execution would run into the middle of another instruction, leave it to the first decode
+			}
+
+			p.Instructions[addr] = in
+			for b := 0; b < in.Size; b++ {
+				claimed[int(addr)-int(origin)+b] = true
+			}
+
+			next := addr + uint16(in.Size)
+			switch in.Kind {
+			case Jump:
+				p.label(in.NNN, "label", inROM)
+				work = append(work, in.NNN)
+			case JumpOffset:
+				p.label(in.NNN, "table", inROM)
+				work = append(work, in.NNN)
+			case Call:
+				p.label(in.NNN, "sub", inROM)
+				work = append(work, in.NNN)
+			case LoadIndex, LoadLong:
+				p.label(in.NNN, "data", inROM)
+			}
+
+			if in.IsSkip() {
+				// The skipped instruction may be four bytes long
+				work = append(work, next+uint16(DecodeAt(memory, next).Size))
+			}
+			if in.Kind == Jump || in.Kind == JumpOffset || in.Kind == Return || in.Kind == Exit {
+				break
+			}
+			addr = next
+		}
+	}
+
+	p.Labels[origin] = "main"
+	return p
+}
+
+// labelPriority decides which name an address gets when it is referred to in several ways
+var labelPriority = map[string]int{"data": 0, "table": 1, "label": 2, "sub": 3}
+
+// label names addr if it is in the ROM, code labels take priority over data labels
+func (p *Program) label(addr uint16, prefix string, inROM func(uint16) bool) {
+	if !inROM(addr) {
+		return
+	}
+	if existing, ok := p.Labels[addr]; ok && labelPriority[strings.SplitN(existing, "_", 2)[0]] >= labelPriority[prefix] {
+		return
+	}
+	p.Labels[addr] = fmt.Sprintf("%s_%03X", prefix, addr)
+}
+
+// Label returns the name of addr, it can be used as a Labeler
+func (p *Program) Label(addr uint16) (string, bool) {
+	label, ok := p.Labels[addr]
+	return label, ok
+}
+
+// Write writes a listing of the program in the given syntax, the listing can be assembled back into the same ROM
+func (p *Program) Write(w io.Writer, syntax Syntax) error {
+	bw := bufio.NewWriter(w)
+	end := int(p.Origin) + len(p.ROM)
+
+	// Work out where each line starts, labels that land in the middle of an instruction are written as constants
+	starts := map[uint16]bool{}
+	for addr := p.Origin; int(addr) < end; {
+		starts[addr] = true
+		if in, ok := p.Instructions[addr]; ok {
+			addr += uint16(in.Size)
+		} else {
+			addr++
+		}
+	}
+	var constants []uint16
+	for addr := range p.Labels {
+		if !starts[addr] {
+			constants = append(constants, addr)
+		}
+	}
+	sort.Slice(constants, func(i, j int) bool { return constants[i] < constants[j] })
+
+	if syntax == Octo {
+		fmt.Fprintln(bw, "# Disassembled by gate")
+	} else {
+		fmt.Fprintln(bw, "; Disassembled by gate")
+	}
+	for _, addr := range constants {
+		if syntax == Octo {
+			fmt.Fprintf(bw, ":const %s 0x%03X\n", p.Labels[addr], addr)
+		} else {
+			fmt.Fprintf(bw, "%s EQU 0x%03X\n", p.Labels[addr], addr)
+		}
+	}
+
+	var data []string
+	flush := func() {
+		if len(data) == 0 {
+			return
+		}
+		if syntax == Octo {
+			fmt.Fprintf(bw, "\t%s\n", strings.Join(data, " "))
+		} else {
+			fmt.Fprintf(bw, "\tDB %s\n", strings.Join(data, ", "))
+		}
+		data = data[:0]
+	}
+
+	for addr := p.Origin; int(addr) < end; {
+		if label, ok := p.Labels[addr]; ok {
+			flush()
+			if syntax == Octo {
+				fmt.Fprintf(bw, ": %s\n", label)
+			} else {
+				fmt.Fprintf(bw, "%s:\n", label)
+			}
+		}
+
+		in, ok := p.Instructions[addr]
+		if !ok {
+			data = append(data, fmt.Sprintf("0x%02X", p.ROM[int(addr)-int(p.Origin)]))
+			if len(data) == 8 {
+				flush()
+			}
+			addr++
+			continue
+		}
+
+		flush()
+		fmt.Fprintf(bw, "\t%s\n", Format(in, syntax, p.Label))
+		addr += uint16(in.Size)
+	}
+	flush()
+
+	return bw.Flush()
+}
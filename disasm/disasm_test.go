@@ -0,0 +1,154 @@
+package disasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_decode(t *testing.T) {
+	tests := []struct {
+		opcode  uint16
+		kind    Kind
+		variant Variant
+		cowgod  string
+		octo    string
+	}{
+		{0x00E0, Clear, CHIP8, "CLS", "clear"},
+		{0x00EE, Return, CHIP8, "RET", "return"},
+		{0x00C4, ScrollDown, SCHIP, "SCD 4", "scroll-down 4"},
+		{0x00D2, ScrollUp, XOCHIP, "SCU 2", "scroll-up 2"},
+		{0x00FF, HiRes, SCHIP, "HIGH", "hires"},
+		{0x1234, Jump, CHIP8, "JP 0x234", "jump 0x234"},
+		{0x2456, Call, CHIP8, "CALL 0x456", ":call 0x456"},
+		{0x3A12, SkipEqImm, CHIP8, "SE VA, 0x12", "if va != 0x12 then"},
+		{0x4A12, SkipNeImm, CHIP8, "SNE VA, 0x12", "if va == 0x12 then"},
+		{0x5120, SkipEqReg, CHIP8, "SE V1, V2", "if v1 != v2 then"},
+		{0x5122, SaveRange, XOCHIP, "SAVE V1, V2", "save v1 - v2"},
+		{0x6B0C, LoadImm, CHIP8, "LD VB, 0x0C", "vb := 0x0C"},
+		{0x7001, AddImm, CHIP8, "ADD V0, 0x01", "v0 += 0x01"},
+		{0x8126, ShiftRight, CHIP8, "SHR V1, V2", "v1 >>= v2"},
+		{0x8127, SubN, CHIP8, "SUBN V1, V2", "v1 =- v2"},
+		{0x9120, SkipNeReg, CHIP8, "SNE V1, V2", "if v1 == v2 then"},
+		{0xA300, LoadIndex, CHIP8, "LD I, 0x300", "i := 0x300"},
+		{0xB300, JumpOffset, CHIP8, "JP V0, 0x300", "jump0 0x300"},
+		{0xC3FF, Random, CHIP8, "RND V3, 0xFF", "v3 := random 0xFF"},
+		{0xD125, Draw, CHIP8, "DRW V1, V2, 5", "sprite v1 v2 5"},
+		{0xD120, Draw, SCHIP, "DRW V1, V2, 0", "sprite v1 v2 0"},
+		{0xE59E, SkipKey, CHIP8, "SKP V5", "if v5 -key then"},
+		{0xE5A1, SkipNotKey, CHIP8, "SKNP V5", "if v5 key then"},
+		{0xF201, Plane, XOCHIP, "PLANE 2", "plane 2"},
+		{0xF002, Audio, XOCHIP, "AUDIO", "audio"},
+		{0xF50A, WaitKey, CHIP8, "LD V5, K", "v5 := key"},
+		{0xF529, Font, CHIP8, "LD F, V5", "i := hex v5"},
+		{0xF530, BigFont, SCHIP, "LD HF, V5", "i := bighex v5"},
+		{0xF533, BCD, CHIP8, "LD B, V5", "bcd v5"},
+		{0xF53A, Pitch, XOCHIP, "PITCH V5", "pitch := v5"},
+		{0xF555, Store, CHIP8, "LD [I], V5", "save v5"},
+		{0xF565, Load, CHIP8, "LD V5, [I]", "load v5"},
+		{0xF575, StoreFlags, SCHIP, "LD R, V5", "saveflags v5"},
+		{0x5121, Invalid, CHIP8, "DW 0x5121", "0x51 0x21"},
+	}
+
+	for _, test := range tests {
+		in := Decode(test.opcode)
+		if in.Kind != test.kind {
+			t.Fatalf("0x%04X should decode as kind %d, was %d\n", test.opcode, test.kind, in.Kind)
+		}
+		if in.Valid() && in.Variant != test.variant {
+			t.Fatalf("0x%04X should be %s, was %s\n", test.opcode, test.variant, in.Variant)
+		}
+		if got := Format(in, Cowgod, nil); got != test.cowgod {
+			t.Fatalf("0x%04X should format as %q, was %q\n", test.opcode, test.cowgod, got)
+		}
+		if got := Format(in, Octo, nil); got != test.octo {
+			t.Fatalf("0x%04X should format as %q, was %q\n", test.opcode, test.octo, got)
+		}
+	}
+}
+
+func Test_decodeAtLong(t *testing.T) {
+	in := DecodeAt([]byte{0xF0, 0x00, 0xBE, 0xEF}, 0)
+
+	if in.Kind != LoadLong || in.Size != 4 || in.NNN != 0xBEEF {
+		t.Fatalf("should decode i := long 0xBEEF, was %+v\n", in)
+	}
+	if got := Format(in, Cowgod, nil); got != "LD I, LONG 0xBEEF" {
+		t.Fatalf("unexpected format %q\n", got)
+	}
+}
+
+func Test_disassemble(t *testing.T) {
+	rom := []byte{
+		0xA2, 0x0C, // 0x200 I := sprite
+		0x22, 0x08, // 0x202 call sub
+		0x12, 0x06, // 0x204 jump to self... via loop label
+		0x12, 0x06, // 0x206 loop
+		0xD0, 0x11, // 0x208 sub: draw
+		0x00, 0xEE, // 0x20A return
+		0xFF, 0x81, // 0x20C sprite data, 0xFF81 would decode as an instruction if it were reached
+	}
+
+	p := Disassemble(rom, Options{Variant: XOCHIP})
+
+	for _, addr := range []uint16{0x200, 0x202, 0x204, 0x206, 0x208, 0x20A} {
+		if _, ok := p.Instructions[addr]; !ok {
+			t.Fatalf("0x%03X should be code\n", addr)
+		}
+	}
+	if _, ok := p.Instructions[0x20C]; ok {
+		t.Fatalf("0x20C should be data\n")
+	}
+
+	wantLabels := map[uint16]string{
+		0x200: "main",
+		0x206: "label_206",
+		0x208: "sub_208",
+		0x20C: "data_20C",
+	}
+	for addr, want := range wantLabels {
+		if got := p.Labels[addr]; got != want {
+			t.Fatalf("0x%03X should be labelled %q, was %q\n", addr, want, got)
+		}
+	}
+
+	var listing bytes.Buffer
+	if err := p.Write(&listing, Cowgod); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	for _, line := range []string{"main:", "\tLD I, data_20C", "\tCALL sub_208", "\tJP label_206", "data_20C:", "\tDB 0xFF, 0x81"} {
+		if !strings.Contains(listing.String(), line+"\n") {
+			t.Fatalf("listing should contain %q:\n%s", line, listing.String())
+		}
+	}
+
+	listing.Reset()
+	if err := p.Write(&listing, Octo); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	for _, line := range []string{": main", "\ti := data_20C", "\tsub_208", "\tjump label_206", ": data_20C", "\t0xFF 0x81"} {
+		if !strings.Contains(listing.String(), line+"\n") {
+			t.Fatalf("listing should contain %q:\n%s", line, listing.String())
+		}
+	}
+}
+
+func Test_disassembleSkips(t *testing.T) {
+	rom := []byte{
+		0x30, 0x00, // 0x200 skip if V0 == 0
+		0x00, 0xFD, // 0x202 exit
+		0x00, 0xE0, // 0x204 reached by the skip
+		0x00, 0xFD, // 0x206 exit
+	}
+
+	p := Disassemble(rom, Options{Variant: XOCHIP})
+	if _, ok := p.Instructions[0x204]; !ok {
+		t.Fatalf("the instruction after a skipped one should be code\n")
+	}
+
+	// SUPER-CHIP instructions are data when disassembling CHIP-8
+	p = Disassemble(rom, Options{Variant: CHIP8})
+	if _, ok := p.Instructions[0x202]; ok {
+		t.Fatalf("00FD should not be code in a CHIP-8 program\n")
+	}
+}
@@ -0,0 +1,219 @@
+package disasm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Syntax selects the assembly language instructions are written in
+type Syntax int
+
+const (
+	Cowgod Syntax = iota // Mnemonics from Cowgod's Chip-8 technical reference, e.g. LD V0, 0x05
+	Octo                 // Octo's high level syntax, e.g. v0 := 0x05
+)
+
+// ParseSyntax looks up a syntax by name
+func ParseSyntax(name string) (Syntax, error) {
+	switch strings.ToLower(name) {
+	case "cowgod":
+		return Cowgod, nil
+	case "octo":
+		return Octo, nil
+	}
+	return Cowgod, fmt.Errorf("unknown syntax %q, must be cowgod or octo", name)
+}
+
+// Labeler returns the label for an address, or false if it has none
+type Labeler func(addr uint16) (string, bool)
+
+// Format writes an instruction in the given syntax. Addresses are written as labels where labels returns one,
+// labels may be nil
+func Format(in Instruction, syntax Syntax, labels Labeler) string {
+	if syntax == Octo {
+		return formatOcto(in, labels)
+	}
+	return formatCowgod(in, labels)
+}
+
+func address(addr uint16, labels Labeler) string {
+	if labels != nil {
+		if label, ok := labels(addr); ok {
+			return label
+		}
+	}
+	return fmt.Sprintf("0x%03X", addr)
+}
+
+func formatCowgod(in Instruction, labels Labeler) string {
+	if !in.Valid() {
+		return fmt.Sprintf("DW 0x%04X", in.Opcode)
+	}
+
+	operands := make([]string, 0, len(in.Operands))
+	for n := 0; n < len(in.Operands); n++ {
+		o := in.Operands[n]
+		switch o.Kind {
+		case Register:
+			operands = append(operands, fmt.Sprintf("V%X", o.Value))
+		case Byte:
+			operands = append(operands, fmt.Sprintf("0x%02X", o.Value))
+		case Nibble:
+			operands = append(operands, fmt.Sprintf("%d", o.Value))
+		case Address:
+			operands = append(operands, address(o.Value, labels))
+		case Index:
+			operands = append(operands, "I")
+		case IndexMem:
+			operands = append(operands, "[I]")
+		case Delay:
+			operands = append(operands, "DT")
+		case Sound:
+			operands = append(operands, "ST")
+		case Key:
+			operands = append(operands, "K")
+		case FontChar:
+			operands = append(operands, "F")
+		case BigFontChar:
+			operands = append(operands, "HF")
+		case BCDDigits:
+			operands = append(operands, "B")
+		case Flags:
+			operands = append(operands, "R")
+		case Long:
+			// LONG prefixes the address that follows it rather than being an operand of its own
+			n++
+			operands = append(operands, "LONG "+address(in.Operands[n].Value, labels))
+		}
+	}
+
+	if len(operands) == 0 {
+		return in.Mnemonic
+	}
+	return in.Mnemonic + " " + strings.Join(operands, ", ")
+}
+
+func formatOcto(in Instruction, labels Labeler) string {
+	vx := fmt.Sprintf("v%x", in.X)
+	vy := fmt.Sprintf("v%x", in.Y)
+	nn := fmt.Sprintf("0x%02X", in.NN)
+	addr := address(in.NNN, labels)
+
+	switch in.Kind {
+	case Clear:
+		return "clear"
+	case Return:
+		return "return"
+	case ScrollDown:
+		return fmt.Sprintf("scroll-down %d", in.N)
+	case ScrollUp:
+		return fmt.Sprintf("scroll-up %d", in.N)
+	case ScrollRight:
+		return "scroll-right"
+	case ScrollLeft:
+		return "scroll-left"
+	case Exit:
+		return "exit"
+	case LoRes:
+		return "lores"
+	case HiRes:
+		return "hires"
+	case Jump:
+		return "jump " + addr
+	case Call:
+		if _, ok := labels.lookup(in.NNN); ok {
+			return addr // Octo calls a subroutine by naming it
+		}
+		return ":call " + addr
+	// Octo conditionals say when the next instruction runs, which is the opposite of when it is skipped
+	case SkipEqImm:
+		return fmt.Sprintf("if %s != %s then", vx, nn)
+	case SkipNeImm:
+		return fmt.Sprintf("if %s == %s then", vx, nn)
+	case SkipEqReg:
+		return fmt.Sprintf("if %s != %s then", vx, vy)
+	case SkipNeReg:
+		return fmt.Sprintf("if %s == %s then", vx, vy)
+	case SkipKey:
+		return fmt.Sprintf("if %s -key then", vx)
+	case SkipNotKey:
+		return fmt.Sprintf("if %s key then", vx)
+	case SaveRange:
+		return fmt.Sprintf("save %s - %s", vx, vy)
+	case LoadRange:
+		return fmt.Sprintf("load %s - %s", vx, vy)
+	case LoadImm:
+		return fmt.Sprintf("%s := %s", vx, nn)
+	case AddImm:
+		return fmt.Sprintf("%s += %s", vx, nn)
+	case Move:
+		return fmt.Sprintf("%s := %s", vx, vy)
+	case Or:
+		return fmt.Sprintf("%s |= %s", vx, vy)
+	case And:
+		return fmt.Sprintf("%s &= %s", vx, vy)
+	case Xor:
+		return fmt.Sprintf("%s ^= %s", vx, vy)
+	case AddReg:
+		return fmt.Sprintf("%s += %s", vx, vy)
+	case Sub:
+		return fmt.Sprintf("%s -= %s", vx, vy)
+	case ShiftRight:
+		return fmt.Sprintf("%s >>= %s", vx, vy)
+	case SubN:
+		return fmt.Sprintf("%s =- %s", vx, vy)
+	case ShiftLeft:
+		return fmt.Sprintf("%s <<= %s", vx, vy)
+	case LoadIndex:
+		return "i := " + addr
+	case JumpOffset:
+		return "jump0 " + addr
+	case Random:
+		return fmt.Sprintf("%s := random %s", vx, nn)
+	case Draw:
+		return fmt.Sprintf("sprite %s %s %d", vx, vy, in.N)
+	case LoadLong:
+		return "i := long " + addr
+	case Plane:
+		return fmt.Sprintf("plane %d", in.X)
+	case Audio:
+		return "audio"
+	case GetDelay:
+		return vx + " := delay"
+	case WaitKey:
+		return vx + " := key"
+	case SetDelay:
+		return "delay := " + vx
+	case SetSound:
+		return "buzzer := " + vx
+	case AddIndex:
+		return "i += " + vx
+	case Font:
+		return "i := hex " + vx
+	case BigFont:
+		return "i := bighex " + vx
+	case BCD:
+		return "bcd " + vx
+	case Pitch:
+		return "pitch := " + vx
+	case Store:
+		return "save " + vx
+	case Load:
+		return "load " + vx
+	case StoreFlags:
+		return "saveflags " + vx
+	case LoadFlags:
+		return "loadflags " + vx
+	}
+
+	// Octo has no syntax for machine code calls or invalid opcodes, so write them as raw bytes
+	return fmt.Sprintf("0x%02X 0x%02X", in.Opcode>>8, in.Opcode&0xFF)
+}
+
+// lookup is safe to call on a nil Labeler
+func (l Labeler) lookup(addr uint16) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	return l(addr)
+}
@@ -0,0 +1,347 @@
+// Package disasm decodes CHIP-8, SUPER-CHIP and XO-CHIP machine code into structured instructions and
+// disassembles whole ROMs into listings that separate code from data.
+package disasm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Variant is a CHIP-8 dialect, each one is a superset of the one before it
+type Variant int
+
+const (
+	CHIP8  Variant = iota // The original COSMAC VIP instruction set
+	SCHIP                 // SUPER-CHIP 1.1
+	XOCHIP                // XO-CHIP
+)
+
+func (v Variant) String() string {
+	switch v {
+	case CHIP8:
+		return "chip8"
+	case SCHIP:
+		return "schip"
+	case XOCHIP:
+		return "xochip"
+	}
+	return "unknown"
+}
+
+// ParseVariant looks up a variant by name
+func ParseVariant(name string) (Variant, error) {
+	for _, v := range []Variant{CHIP8, SCHIP, XOCHIP} {
+		if strings.EqualFold(name, v.String()) {
+			return v, nil
+		}
+	}
+	return XOCHIP, fmt.Errorf("unknown variant %q, must be chip8, schip or xochip", name)
+}
+
+// Kind identifies the operation an instruction performs
+type Kind int
+
+const (
+	Invalid     Kind = iota // Not an instruction, usually data
+	Sys                     // 0NNN - Call machine code routine, ignored by modern interpreters
+	Clear                   // 00E0
+	Return                  // 00EE
+	ScrollDown              // 00CN
+	ScrollUp                // 00DN
+	ScrollRight             // 00FB
+	ScrollLeft              // 00FC
+	Exit                    // 00FD
+	LoRes                   // 00FE
+	HiRes                   // 00FF
+	Jump                    // 1NNN
+	Call                    // 2NNN
+	SkipEqImm               // 3XNN
+	SkipNeImm               // 4XNN
+	SkipEqReg               // 5XY0
+	SaveRange               // 5XY2
+	LoadRange               // 5XY3
+	LoadImm                 // 6XNN
+	AddImm                  // 7XNN
+	Move                    // 8XY0
+	Or                      // 8XY1
+	And                     // 8XY2
+	Xor                     // 8XY3
+	AddReg                  // 8XY4
+	Sub                     // 8XY5
+	ShiftRight              // 8XY6
+	SubN                    // 8XY7
+	ShiftLeft               // 8XYE
+	SkipNeReg               // 9XY0
+	LoadIndex               // ANNN
+	JumpOffset              // BNNN
+	Random                  // CXNN
+	Draw                    // DXYN
+	SkipKey                 // EX9E
+	SkipNotKey              // EXA1
+	LoadLong                // F000 NNNN
+	Plane                   // FN01
+	Audio                   // F002
+	GetDelay                // FX07
+	WaitKey                 // FX0A
+	SetDelay                // FX15
+	SetSound                // FX18
+	AddIndex                // FX1E
+	Font                    // FX29
+	BigFont                 // FX30
+	BCD                     // FX33
+	Pitch                   // FX3A
+	Store                   // FX55
+	Load                    // FX65
+	StoreFlags              // FX75
+	LoadFlags               // FX85
+)
+
+// OperandKind identifies what an operand refers to
+type OperandKind int
+
+const (
+	Register    OperandKind = iota // VX, Value is the register number
+	Byte                           // An 8-bit immediate value
+	Nibble                         // A 4-bit immediate value
+	Address                        // A 12-bit address, or 16-bit after LONG
+	Index                          // I
+	IndexMem                       // [I], memory at I
+	Delay                          // DT, the delay timer
+	Sound                          // ST, the sound timer
+	Key                            // K, a key press
+	FontChar                       // F, the font sprite for a digit
+	BigFontChar                    // HF, the big font sprite for a digit
+	BCDDigits                      // B, the BCD digits of a value
+	Flags                          // R, the RPL user flags
+	Long                           // LONG, marks a 16-bit address
+)
+
+// Operand is a single operand of an instruction
+type Operand struct {
+	Kind  OperandKind
+	Value uint16
+}
+
+// Instruction is a decoded instruction
+type Instruction struct {
+	Addr     uint16 // Where the instruction was decoded from
+	Opcode   uint16 // The first two bytes of the instruction
+	Size     int    // Length in bytes, 4 for F000 NNNN and 2 for everything else
+	Kind     Kind
+	Mnemonic string // Cowgod style mnemonic, e.g. LD
+	Operands []Operand
+	Variant  Variant // The first dialect that supports the instruction
+
+	X, Y uint8  // Register operands
+	N    uint8  // 4-bit immediate
+	NN   uint8  // 8-bit immediate
+	NNN  uint16 // Address, 12 bits or 16 bits for F000 NNNN
+}
+
+// Valid returns whether the instruction decoded to a known operation
+func (in Instruction) Valid() bool {
+	return in.Kind != Invalid
+}
+
+// Target returns the address an instruction refers to and whether it has one. Jumps and calls refer to code,
+// LoadIndex and LoadLong refer to data
+func (in Instruction) Target() (uint16, bool) {
+	switch in.Kind {
+	case Jump, Call, JumpOffset, LoadIndex, LoadLong:
+		return in.NNN, true
+	}
+	return 0, false
+}
+
+// IsSkip returns whether the instruction conditionally skips the next one
+func (in Instruction) IsSkip() bool {
+	switch in.Kind {
+	case SkipEqImm, SkipNeImm, SkipEqReg, SkipNeReg, SkipKey, SkipNotKey:
+		return true
+	}
+	return false
+}
+
+func reg(r uint8) Operand {
+	return Operand{Kind: Register, Value: uint16(r)}
+}
+
+func op(kind OperandKind) Operand {
+	return Operand{Kind: kind}
+}
+
+// Decode decodes a two byte opcode. F000 is decoded as LoadLong with an address of zero, use DecodeAt to read the
+// address that follows it
+func Decode(opcode uint16) Instruction {
+	in := Instruction{
+		Opcode: opcode,
+		Size:   2,
+		X:      uint8((opcode & 0x0F00) >> 8),
+		Y:      uint8((opcode & 0x00F0) >> 4),
+		N:      uint8(opcode & 0x000F),
+		NN:     uint8(opcode & 0x00FF),
+		NNN:    opcode & 0x0FFF,
+	}
+	x, y := in.X, in.Y
+
+	set := func(kind Kind, variant Variant, mnemonic string, operands ...Operand) Instruction {
+		in.Kind = kind
+		in.Variant = variant
+		in.Mnemonic = mnemonic
+		in.Operands = operands
+		return in
+	}
+
+	switch opcode & 0xF000 {
+	case 0x0000:
+		switch {
+		case opcode&0xFFF0 == 0x00C0:
+			return set(ScrollDown, SCHIP, "SCD", Operand{Nibble, uint16(in.N)})
+		case opcode&0xFFF0 == 0x00D0:
+			return set(ScrollUp, XOCHIP, "SCU", Operand{Nibble, uint16(in.N)})
+		case opcode == 0x00E0:
+			return set(Clear, CHIP8, "CLS")
+		case opcode == 0x00EE:
+			return set(Return, CHIP8, "RET")
+		case opcode == 0x00FB:
+			return set(ScrollRight, SCHIP, "SCR")
+		case opcode == 0x00FC:
+			return set(ScrollLeft, SCHIP, "SCL")
+		case opcode == 0x00FD:
+			return set(Exit, SCHIP, "EXIT")
+		case opcode == 0x00FE:
+			return set(LoRes, SCHIP, "LOW")
+		case opcode == 0x00FF:
+			return set(HiRes, SCHIP, "HIGH")
+		case opcode != 0x0000:
+			return set(Sys, CHIP8, "SYS", Operand{Address, in.NNN})
+		}
+	case 0x1000:
+		return set(Jump, CHIP8, "JP", Operand{Address, in.NNN})
+	case 0x2000:
+		return set(Call, CHIP8, "CALL", Operand{Address, in.NNN})
+	case 0x3000:
+		return set(SkipEqImm, CHIP8, "SE", reg(x), Operand{Byte, uint16(in.NN)})
+	case 0x4000:
+		return set(SkipNeImm, CHIP8, "SNE", reg(x), Operand{Byte, uint16(in.NN)})
+	case 0x5000:
+		switch in.N {
+		case 0x0:
+			return set(SkipEqReg, CHIP8, "SE", reg(x), reg(y))
+		case 0x2:
+			return set(SaveRange, XOCHIP, "SAVE", reg(x), reg(y))
+		case 0x3:
+			return set(LoadRange, XOCHIP, "LOAD", reg(x), reg(y))
+		}
+	case 0x6000:
+		return set(LoadImm, CHIP8, "LD", reg(x), Operand{Byte, uint16(in.NN)})
+	case 0x7000:
+		return set(AddImm, CHIP8, "ADD", reg(x), Operand{Byte, uint16(in.NN)})
+	case 0x8000:
+		switch in.N {
+		case 0x0:
+			return set(Move, CHIP8, "LD", reg(x), reg(y))
+		case 0x1:
+			return set(Or, CHIP8, "OR", reg(x), reg(y))
+		case 0x2:
+			return set(And, CHIP8, "AND", reg(x), reg(y))
+		case 0x3:
+			return set(Xor, CHIP8, "XOR", reg(x), reg(y))
+		case 0x4:
+			return set(AddReg, CHIP8, "ADD", reg(x), reg(y))
+		case 0x5:
+			return set(Sub, CHIP8, "SUB", reg(x), reg(y))
+		case 0x6:
+			return set(ShiftRight, CHIP8, "SHR", reg(x), reg(y))
+		case 0x7:
+			return set(SubN, CHIP8, "SUBN", reg(x), reg(y))
+		case 0xE:
+			return set(ShiftLeft, CHIP8, "SHL", reg(x), reg(y))
+		}
+	case 0x9000:
+		if in.N == 0 {
+			return set(SkipNeReg, CHIP8, "SNE", reg(x), reg(y))
+		}
+	case 0xA000:
+		return set(LoadIndex, CHIP8, "LD", op(Index), Operand{Address, in.NNN})
+	case 0xB000:
+		return set(JumpOffset, CHIP8, "JP", reg(0), Operand{Address, in.NNN})
+	case 0xC000:
+		return set(Random, CHIP8, "RND", reg(x), Operand{Byte, uint16(in.NN)})
+	case 0xD000:
+		variant := CHIP8
+		if in.N == 0 {
+			variant = SCHIP // DXY0 draws a 16x16 sprite
+		}
+		return set(Draw, variant, "DRW", reg(x), reg(y), Operand{Nibble, uint16(in.N)})
+	case 0xE000:
+		switch in.NN {
+		case 0x9E:
+			return set(SkipKey, CHIP8, "SKP", reg(x))
+		case 0xA1:
+			return set(SkipNotKey, CHIP8, "SKNP", reg(x))
+		}
+	case 0xF000:
+		switch in.NN {
+		case 0x00:
+			if x == 0 {
+				in.Size = 4
+				in.NNN = 0
+				return set(LoadLong, XOCHIP, "LD", op(Index), op(Long), Operand{Address, 0})
+			}
+		case 0x01:
+			return set(Plane, XOCHIP, "PLANE", Operand{Nibble, uint16(x)})
+		case 0x02:
+			if x == 0 {
+				return set(Audio, XOCHIP, "AUDIO")
+			}
+		case 0x07:
+			return set(GetDelay, CHIP8, "LD", reg(x), op(Delay))
+		case 0x0A:
+			return set(WaitKey, CHIP8, "LD", reg(x), op(Key))
+		case 0x15:
+			return set(SetDelay, CHIP8, "LD", op(Delay), reg(x))
+		case 0x18:
+			return set(SetSound, CHIP8, "LD", op(Sound), reg(x))
+		case 0x1E:
+			return set(AddIndex, CHIP8, "ADD", op(Index), reg(x))
+		case 0x29:
+			return set(Font, CHIP8, "LD", op(FontChar), reg(x))
+		case 0x30:
+			return set(BigFont, SCHIP, "LD", op(BigFontChar), reg(x))
+		case 0x33:
+			return set(BCD, CHIP8, "LD", op(BCDDigits), reg(x))
+		case 0x3A:
+			return set(Pitch, XOCHIP, "PITCH", reg(x))
+		case 0x55:
+			return set(Store, CHIP8, "LD", op(IndexMem), reg(x))
+		case 0x65:
+			return set(Load, CHIP8, "LD", reg(x), op(IndexMem))
+		case 0x75:
+			return set(StoreFlags, SCHIP, "LD", op(Flags), reg(x))
+		case 0x85:
+			return set(LoadFlags, SCHIP, "LD", reg(x), op(Flags))
+		}
+	}
+
+	return set(Invalid, CHIP8, "")
+}
+
+// DecodeAt decodes the instruction at addr in memory, which is indexed from address zero. Reads past the end of
+// memory return zero
+func DecodeAt(memory []byte, addr uint16) Instruction {
+	in := Decode(uint16(byteAt(memory, int(addr)))<<8 | uint16(byteAt(memory, int(addr)+1)))
+	in.Addr = addr
+	if in.Kind == LoadLong {
+		in.NNN = uint16(byteAt(memory, int(addr)+2))<<8 | uint16(byteAt(memory, int(addr)+3))
+		in.Operands[2].Value = in.NNN
+	}
+	return in
+}
+
+func byteAt(memory []byte, addr int) byte {
+	if addr < 0 || addr >= len(memory) {
+		return 0
+	}
+	return memory[addr]
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/pthm/gate/gdbstub"
+	"net"
+)
+
+// gdbCommand runs a ROM paused in a raylib window and serves the GDB remote protocol, so it can be debugged with
+// `target remote` from GDB or any other remote debugging client
+func gdbCommand(args []string) error {
+	flags := flag.NewFlagSet("gdb", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gate gdb [flags] rom.ch8|game.8o|source.asm")
+		flags.PrintDefaults()
+	}
+	listen := flags.String("listen", ":1234", "address to accept GDB clients on")
+	machine := addMachineFlags(flags)
+
+	flags.Parse(args)
+	romPath := flags.Arg(0)
+
+	chip8, err := machine.newCPU(romPath)
+	if err != nil {
+		return err
+	}
+	chip8.Pause() // Wait for a client to set breakpoints before running
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	fmt.Printf("Listening for GDB clients on %s\n", ln.Addr())
+	go gdbstub.NewServer(chip8).Serve(ln)
+
+	return runWindow(context.Background(), chip8, romPath, machine)
+}
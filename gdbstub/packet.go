@@ -0,0 +1,109 @@
+package gdbstub
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// interrupt is the byte a client sends, outside of any packet, to stop a running target
+const interrupt = 0x03
+
+// packet is a packet from the client, or an interrupt
+type packet struct {
+	data      string
+	interrupt bool
+}
+
+// readPacket reads the next packet or interrupt, skipping acknowledgements. ok is false when the packet's checksum
+// doesn't match, so it should be retransmitted
+func readPacket(r *bufio.Reader) (p packet, ok bool, err error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, false, err
+		}
+		switch b {
+		case interrupt:
+			return packet{interrupt: true}, true, nil
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				return packet{}, false, err
+			}
+			data = data[:len(data)-1]
+
+			sum := make([]byte, 2)
+			if _, err := io.ReadFull(r, sum); err != nil {
+				return packet{}, false, err
+			}
+			want, err := strconv.ParseUint(string(sum), 16, 8)
+			return packet{data: data}, err == nil && uint8(want) == checksum(data), nil
+		}
+		// Anything else is an acknowledgement or line noise between packets
+	}
+}
+
+func checksum(data string) uint8 {
+	sum := uint8(0)
+	for n := 0; n < len(data); n++ {
+		sum += data[n]
+	}
+	return sum
+}
+
+// escape escapes the bytes that frame packets, for replies carrying text such as the target description
+func escape(data string) string {
+	if !strings.ContainsAny(data, "$#}*") {
+		return data
+	}
+	var b strings.Builder
+	for n := 0; n < len(data); n++ {
+		switch c := data[n]; c {
+		case '$', '#', '}', '*':
+			b.WriteByte('}')
+			b.WriteByte(c ^ 0x20)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// conn writes packets and acknowledgements, which are written from different goroutines
+type conn struct {
+	mu    sync.Mutex
+	w     io.Writer
+	noAck bool // Set once the client has asked to stop acknowledging packets
+}
+
+// ack acknowledges a packet, or asks for it to be sent again
+func (c *conn) ack(ok bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.noAck {
+		return nil
+	}
+	if ok {
+		_, err := io.WriteString(c.w, "+")
+		return err
+	}
+	_, err := io.WriteString(c.w, "-")
+	return err
+}
+
+func (c *conn) send(data string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := fmt.Fprintf(c.w, "$%s#%02x", data, checksum(data))
+	return err
+}
+
+func (c *conn) setNoAck() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.noAck = true
+}
@@ -0,0 +1,497 @@
+// Package gdbstub serves the GDB remote serial protocol, so GDB and other remote debugging clients can debug ROMs
+// running on a CPU. See https://sourceware.org/gdb/current/onlinedocs/gdb.html/Remote-Protocol.html
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pthm/gate/cpu"
+)
+
+// Signals reported in stop replies
+const (
+	sigint  = 2 // The client interrupted execution
+	sigtrap = 5 // A breakpoint, watchpoint, condition or step stopped execution
+)
+
+// Error replies
+const (
+	errPacket  = "E01" // The packet is malformed
+	errAddress = "E02" // The register or memory doesn't exist
+)
+
+// targetXML describes the registers, in the order of cpu.Register, as GDB has no built in CHIP-8 architecture
+var targetXML = func() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?>` + "\n")
+	b.WriteString(`<!DOCTYPE target SYSTEM "gdb-target.dtd">` + "\n")
+	b.WriteString(`<target version="1.0">` + "\n")
+	b.WriteString(`  <feature name="org.pthm.gate.chip8">` + "\n")
+	for r := cpu.RegV0; r < cpu.NumRegisters; r++ {
+		kind := "uint8"
+		switch r {
+		case cpu.RegI:
+			kind = "data_ptr"
+		case cpu.RegPC:
+			kind = "code_ptr"
+		case cpu.RegSP:
+			kind = "uint16"
+		}
+		fmt.Fprintf(&b, `    <reg name="%s" bitsize="%d" regnum="%d" type="%s"/>`+"\n",
+			strings.ToLower(r.String()), registerSize(r)*8, int(r), kind)
+	}
+	b.WriteString("  </feature>\n")
+	b.WriteString("</target>\n")
+	return b.String()
+}()
+
+// registerSize is the size of a register in bytes
+func registerSize(r cpu.Register) int {
+	switch r {
+	case cpu.RegI, cpu.RegPC, cpu.RegSP:
+		return 2
+	}
+	return 1
+}
+
+// Server exposes a CPU to remote debugging clients, one at a time
+type Server struct {
+	cpu *cpu.CPU
+}
+
+// NewServer creates a server for chip8
+func NewServer(chip8 *cpu.CPU) *Server {
+	return &Server{cpu: chip8}
+}
+
+// Serve accepts clients from ln one at a time until ln is closed
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		if err := s.ServeConn(c); err != nil {
+			fmt.Printf("GDB session ended: %v\n", err)
+		}
+		c.Close()
+	}
+}
+
+// ServeConn runs a debug session over rw until the client detaches. Execution is paused while the client is
+// connected, as GDB expects the target to be stopped when it attaches
+func (s *Server) ServeConn(rw io.ReadWriter) error {
+	sess := &session{
+		cpu:         s.cpu,
+		conn:        &conn{w: rw},
+		stops:       make(chan cpu.Stop, 1),
+		done:        make(chan struct{}),
+		breakpoints: map[uint16]bool{},
+	}
+	defer close(sess.done)
+
+	s.cpu.SetStopHandler(sess.stopped)
+	defer s.cpu.SetStopHandler(nil)
+	defer sess.detach()
+	s.cpu.Pause()
+
+	// Packets are read on another goroutine so an interrupt can arrive while waiting for execution to stop
+	packets := make(chan packet)
+	readErr := make(chan error, 1)
+	go func() {
+		r := bufio.NewReader(rw)
+		for {
+			p, ok, err := readPacket(r)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			if err := sess.conn.ack(ok); err != nil {
+				readErr <- err
+				return
+			}
+			if !ok {
+				continue
+			}
+			select {
+			case packets <- p:
+			case <-sess.done:
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case err := <-readErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case stop := <-sess.stops:
+			if !sess.running {
+				continue // Stops while the client thinks the target is stopped, such as pausing on connect
+			}
+			sess.running = false
+			if err := sess.conn.send(sess.stopReply(stop)); err != nil {
+				return err
+			}
+		case p := <-packets:
+			if p.interrupt {
+				if sess.running {
+					s.cpu.Pause()
+				}
+				continue
+			}
+			reply, ok := sess.handle(p.data)
+			if ok {
+				if err := sess.conn.send(reply); err != nil {
+					return err
+				}
+			}
+			if p.data == "QStartNoAckMode" {
+				sess.conn.setNoAck()
+			}
+			if sess.detached {
+				return nil
+			}
+		}
+	}
+}
+
+// session is the state of one client
+type session struct {
+	cpu         *cpu.CPU
+	conn        *conn
+	stops       chan cpu.Stop
+	done        chan struct{}
+	running     bool // Whether the client is waiting for a stop reply
+	detached    bool
+	breakpoints map[uint16]bool // Breakpoints the client set, removed when it detaches
+	watchpoints []cpu.Watchpoint
+}
+
+// stopped is the CPU's stop handler, it hands stops to the session's goroutine
+func (sess *session) stopped(stop cpu.Stop) {
+	select {
+	case sess.stops <- stop:
+	case <-sess.done:
+	}
+}
+
+// stopReply describes a stop along with PC, which saves the client reading it
+func (sess *session) stopReply(stop cpu.Stop) string {
+	signal := sigtrap
+	if stop.Reason == cpu.StopPause {
+		signal = sigint
+	}
+	reply := fmt.Sprintf("T%02xthread:1;%02x:%s;", signal, int(cpu.RegPC), encodeRegister(cpu.RegPC, stop.PC))
+	if stop.Reason == cpu.StopWatchpoint {
+		reply += fmt.Sprintf("%s:%x;", sess.watchKind(stop), stop.Addr)
+	}
+	return reply
+}
+
+// watchKind names the kind of watchpoint that stopped execution, as its stop reply does
+func (sess *session) watchKind(stop cpu.Stop) string {
+	for _, w := range sess.watchpoints {
+		if w.Kind == cpu.WatchAccess && stop.Addr >= w.Addr && int(stop.Addr) < int(w.Addr)+int(max(w.Len, 1)) {
+			return "awatch"
+		}
+	}
+	if stop.Write {
+		return "watch"
+	}
+	return "rwatch"
+}
+
+// resume continues execution with run, discarding any stop the client hasn't been told about
+func (sess *session) resume(run func()) {
+	select {
+	case <-sess.stops:
+	default:
+	}
+	sess.running = true
+	run()
+}
+
+// detach removes the client's breakpoints and watchpoints and resumes execution
+func (sess *session) detach() {
+	for addr := range sess.breakpoints {
+		sess.cpu.ClearBreakpoint(addr)
+	}
+	for _, w := range sess.watchpoints {
+		sess.cpu.RemoveWatchpoint(w)
+	}
+	sess.cpu.Resume()
+}
+
+// handle handles a packet, returning the reply and whether to send it. Packets that resume execution are replied
+// to once execution stops
+func (sess *session) handle(data string) (string, bool) {
+	chip8 := sess.cpu
+
+	switch {
+	case data == "?":
+		return fmt.Sprintf("S%02x", sigtrap), true
+	case strings.HasPrefix(data, "qSupported"):
+		return "PacketSize=1000;qXfer:features:read+;QStartNoAckMode+", true
+	case data == "QStartNoAckMode":
+		return "OK", true
+	case strings.HasPrefix(data, "qXfer:features:read:"):
+		return sess.readFeatures(strings.TrimPrefix(data, "qXfer:features:read:")), true
+	case data == "qAttached":
+		return "1", true
+	case data == "qC":
+		return "QC1", true
+	case data == "qfThreadInfo":
+		return "m1", true
+	case data == "qsThreadInfo":
+		return "l", true
+	case strings.HasPrefix(data, "H"), strings.HasPrefix(data, "T"):
+		return "OK", true // There is only one thread
+	case data == "g":
+		var b strings.Builder
+		for r := cpu.RegV0; r < cpu.NumRegisters; r++ {
+			b.WriteString(encodeRegister(r, chip8.Register(r)))
+		}
+		return b.String(), true
+	case strings.HasPrefix(data, "G"):
+		return sess.writeRegisters(data[1:]), true
+	case strings.HasPrefix(data, "p"):
+		r, err := parseRegister(data[1:])
+		if err != nil {
+			return errAddress, true
+		}
+		return encodeRegister(r, chip8.Register(r)), true
+	case strings.HasPrefix(data, "P"):
+		name, value, ok := strings.Cut(data[1:], "=")
+		if !ok {
+			return errPacket, true
+		}
+		r, err := parseRegister(name)
+		if err != nil {
+			return errAddress, true
+		}
+		v, err := decodeRegister(r, value)
+		if err != nil {
+			return errPacket, true
+		}
+		chip8.SetRegister(r, v)
+		return "OK", true
+	case strings.HasPrefix(data, "m"):
+		return sess.readMemory(data[1:]), true
+	case strings.HasPrefix(data, "M"):
+		return sess.writeMemory(data[1:]), true
+	case strings.HasPrefix(data, "Z"), strings.HasPrefix(data, "z"):
+		return sess.setBreakpoint(data[0] == 'Z', data[1:]), true
+	case strings.HasPrefix(data, "c"), strings.HasPrefix(data, "s"):
+		if addr := data[1:]; addr != "" {
+			pc, err := strconv.ParseUint(addr, 16, 16)
+			if err != nil {
+				return errPacket, true
+			}
+			chip8.SetRegister(cpu.RegPC, uint16(pc))
+		}
+		if data[0] == 'c' {
+			sess.resume(chip8.Resume)
+		} else {
+			sess.resume(chip8.Step)
+		}
+		return "", false
+	case data == "D" || strings.HasPrefix(data, "D;"):
+		sess.detached = true
+		return "OK", true
+	case data == "k":
+		sess.detached = true // Killing the target would close the window, so treat it as detaching
+		return "", false
+	}
+	return "", true // An empty reply tells the client the packet isn't supported
+}
+
+// readFeatures reads part of the target description, from an annex of the form target.xml:offset,length
+func (sess *session) readFeatures(annex string) string {
+	name, span, ok := strings.Cut(annex, ":")
+	if !ok || name != "target.xml" {
+		return errPacket
+	}
+	offset, length, err := parseSpan(span)
+	if err != nil {
+		return errPacket
+	}
+	if offset >= len(targetXML) {
+		return "l"
+	}
+	end := min(offset+length, len(targetXML))
+	prefix := "m"
+	if end == len(targetXML) {
+		prefix = "l"
+	}
+	return prefix + escape(targetXML[offset:end])
+}
+
+func (sess *session) writeRegisters(data string) string {
+	values := make([]uint16, cpu.NumRegisters)
+	for r := cpu.RegV0; r < cpu.NumRegisters; r++ {
+		size := registerSize(r) * 2
+		if len(data) < size {
+			return errPacket
+		}
+		v, err := decodeRegister(r, data[:size])
+		if err != nil {
+			return errPacket
+		}
+		values[r] = v
+		data = data[size:]
+	}
+	if data != "" {
+		return errPacket
+	}
+	for r, v := range values {
+		sess.cpu.SetRegister(cpu.Register(r), v)
+	}
+	return "OK"
+}
+
+// readMemory reads memory for a packet of the form addr,length
+func (sess *session) readMemory(span string) string {
+	addr, length, err := parseSpan(span)
+	if err != nil {
+		return errPacket
+	}
+	if addr > 0xFFFF {
+		return errAddress
+	}
+	return hex.EncodeToString(sess.cpu.ReadMemory(uint16(addr), length))
+}
+
+// writeMemory writes memory for a packet of the form addr,length:data
+func (sess *session) writeMemory(args string) string {
+	span, data, ok := strings.Cut(args, ":")
+	if !ok {
+		return errPacket
+	}
+	addr, length, err := parseSpan(span)
+	if err != nil {
+		return errPacket
+	}
+	bytes, err := hex.DecodeString(data)
+	if err != nil || len(bytes) != length {
+		return errPacket
+	}
+	if addr+length > 0x10000 {
+		return errAddress
+	}
+	sess.cpu.WriteMemory(uint16(addr), bytes)
+	return "OK"
+}
+
+// setBreakpoint inserts or removes a breakpoint or watchpoint for a packet of the form type,addr,kind. Software and
+// hardware breakpoints are the same thing here, for watchpoints kind is the number of bytes watched
+func (sess *session) setBreakpoint(insert bool, args string) string {
+	args, _, _ = strings.Cut(args, ";") // Target side conditions and commands aren't supported, GDB evaluates them
+	fields := strings.Split(args, ",")
+	if len(fields) != 3 {
+		return errPacket
+	}
+	addr, err := strconv.ParseUint(fields[1], 16, 16)
+	if err != nil {
+		return errPacket
+	}
+	kind, err := strconv.ParseUint(fields[2], 16, 16)
+	if err != nil {
+		return errPacket
+	}
+
+	var watch cpu.WatchKind
+	switch fields[0] {
+	case "0", "1":
+		if insert {
+			sess.cpu.SetBreakpoint(uint16(addr))
+			sess.breakpoints[uint16(addr)] = true
+		} else {
+			sess.cpu.ClearBreakpoint(uint16(addr))
+			delete(sess.breakpoints, uint16(addr))
+		}
+		return "OK"
+	case "2":
+		watch = cpu.WatchWrite
+	case "3":
+		watch = cpu.WatchRead
+	case "4":
+		watch = cpu.WatchAccess
+	default:
+		return ""
+	}
+
+	w := cpu.Watchpoint{Addr: uint16(addr), Len: uint16(kind), Kind: watch}
+	if insert {
+		sess.cpu.AddWatchpoint(w)
+		sess.watchpoints = append(sess.watchpoints, w)
+		return "OK"
+	}
+	sess.cpu.RemoveWatchpoint(w)
+	for n, existing := range sess.watchpoints {
+		if existing == w {
+			sess.watchpoints = append(sess.watchpoints[:n], sess.watchpoints[n+1:]...)
+			break
+		}
+	}
+	return "OK"
+}
+
+// encodeRegister writes a register value as little endian hex, sized as the target description says
+func encodeRegister(r cpu.Register, value uint16) string {
+	if registerSize(r) == 1 {
+		return fmt.Sprintf("%02x", uint8(value))
+	}
+	return fmt.Sprintf("%02x%02x", uint8(value), uint8(value>>8))
+}
+
+func decodeRegister(r cpu.Register, data string) (uint16, error) {
+	bytes, err := hex.DecodeString(data)
+	if err != nil {
+		return 0, err
+	}
+	if len(bytes) != registerSize(r) {
+		return 0, fmt.Errorf("%s is %d bytes", r, registerSize(r))
+	}
+	value := uint16(0)
+	for n := len(bytes) - 1; n >= 0; n-- {
+		value = value<<8 | uint16(bytes[n])
+	}
+	return value, nil
+}
+
+// parseRegister parses a register number
+func parseRegister(s string) (cpu.Register, error) {
+	n, err := strconv.ParseUint(s, 16, 8)
+	if err != nil || n >= uint64(cpu.NumRegisters) {
+		return 0, fmt.Errorf("unknown register %q", s)
+	}
+	return cpu.Register(n), nil
+}
+
+// parseSpan parses an offset and length written in hex as offset,length
+func parseSpan(s string) (offset, length int, err error) {
+	o, l, ok := strings.Cut(s, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid span %q", s)
+	}
+	start, err := strconv.ParseUint(o, 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, err := strconv.ParseUint(l, 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(start), int(n), nil
+}
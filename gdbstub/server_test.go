@@ -0,0 +1,131 @@
+package gdbstub
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pthm/gate/cpu"
+)
+
+// testClient speaks the protocol over loopback TCP, as GDB would
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *testClient) send(data string) {
+	fmt.Fprintf(c.conn, "$%s#%02x", data, checksum(data))
+}
+
+// reply reads the next packet from the server
+func (c *testClient) reply() string {
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	p, ok, err := readPacket(c.r)
+	if err != nil || !ok {
+		c.t.Fatalf("could not read a reply: %v\n", err)
+	}
+	return p.data
+}
+
+// expect sends a packet and checks the reply
+func (c *testClient) expect(data, want string) {
+	c.t.Helper()
+	c.send(data)
+	if got := c.reply(); got != want {
+		c.t.Fatalf("%s should reply %q, got %q\n", data, want, got)
+	}
+}
+
+func Test_serverSession(t *testing.T) {
+	chip8 := cpu.NewCPU(cpu.QuirksVIP)
+	chip8.LoadROM([]uint8{
+		0x60, 0x05, // 0x200 V0 := 5
+		0xA3, 0x00, // 0x202 I := 0x300
+		0xF0, 0x55, // 0x204 save V0
+		0x12, 0x06, // 0x206 jump 0x206
+	})
+	chip8.Pause()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	defer ln.Close()
+	go NewServer(chip8).Serve(ln)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			chip8.RunFrame()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	defer conn.Close()
+	client := &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	// Packets are acknowledged until the client turns it off
+	client.send("qSupported:swbreak+")
+	if ack, _ := client.r.ReadByte(); ack != '+' {
+		t.Fatalf("packet should be acknowledged, got %q\n", ack)
+	}
+	if reply := client.reply(); !strings.Contains(reply, "qXfer:features:read+") {
+		t.Fatalf("should support reading the target description, got %q\n", reply)
+	}
+	conn.Write([]byte("+"))
+	client.send("QStartNoAckMode")
+	client.r.ReadByte()
+	if reply := client.reply(); reply != "OK" {
+		t.Fatalf("QStartNoAckMode should reply OK, got %q\n", reply)
+	}
+
+	client.expect("?", "S05")
+	client.send("qXfer:features:read:target.xml:0,1000")
+	if reply := client.reply(); !strings.HasPrefix(reply, "l") || !strings.Contains(reply, `<reg name="pc" bitsize="16" regnum="17" type="code_ptr"/>`) {
+		t.Fatalf("target description should describe PC, got %q\n", reply)
+	}
+
+	// V0-VF, then I, PC and SP in little endian, then DT and ST
+	client.expect("g", strings.Repeat("00", 16)+"0000"+"0002"+"0000"+"00"+"00")
+	client.expect("P1=2a", "OK")
+	client.expect("p1", "2a")
+	client.expect("p15", errAddress)
+
+	client.expect("Z0,202,2", "OK")
+	client.expect("c", "T05thread:1;11:0202;")
+	client.expect("p0", "05")
+
+	// The watchpoint stops execution once the instruction writing it finishes
+	client.expect("Z2,300,1", "OK")
+	client.expect("c", "T05thread:1;11:0602;watch:300;")
+	client.expect("m300,2", "0500")
+	client.expect("M300,2:aabb", "OK")
+	client.expect("m300,2", "aabb")
+	client.expect("z2,300,1", "OK")
+
+	client.expect("s", "T05thread:1;11:0602;")
+
+	client.send("c")
+	time.Sleep(10 * time.Millisecond)
+	conn.Write([]byte{interrupt})
+	if reply := client.reply(); reply != "T02thread:1;11:0602;" {
+		t.Fatalf("interrupting should stop with SIGINT, got %q\n", reply)
+	}
+
+	client.expect("D", "OK")
+	time.Sleep(10 * time.Millisecond)
+	if chip8.Paused() || len(chip8.Breakpoints()) != 0 || len(chip8.Watchpoints()) != 0 {
+		t.Fatalf("detaching should remove breakpoints and resume\n")
+	}
+}
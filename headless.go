@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pthm/gate/audio"
+	"github.com/pthm/gate/cpu"
+	"github.com/pthm/gate/headless"
+	"github.com/pthm/gate/renderer"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// headlessFlags configure running a ROM without a window
+type headlessFlags struct {
+	enabled *bool
+	frames  *int
+	input   *string
+	dump    *string
+	wav     *string
+}
+
+func addHeadlessFlags(flags *flag.FlagSet) *headlessFlags {
+	return &headlessFlags{
+		enabled: flags.Bool("headless", false, "run without a window for -frames frames, then dump the display"),
+		frames:  flags.Int("frames", 600, "frames to run for when headless, 60 per second"),
+		input:   flags.String("input", "", "script of key presses when headless, a line per event e.g. 30 down 5"),
+		dump:    flags.String("dump", "-", "file to dump the display to when headless, .png for an image, - for text on stdout"),
+		wav:     flags.String("wav", "", "file to write the sound to when headless, as a WAV"),
+	}
+}
+
+// run runs chip8 headless as the flags say and dumps the display
+func (h *headlessFlags) run(chip8 *cpu.CPU, machine *machineFlags) error {
+	var script headless.Script
+	if *h.input != "" {
+		f, err := os.Open(*h.input)
+		if err != nil {
+			return fmt.Errorf("could not open input script (%s): %w", *h.input, err)
+		}
+		script, err = headless.ParseScript(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", *h.input, err)
+		}
+	}
+
+	host := &headless.Host{Frames: *h.frames, Script: script}
+	var finishWAV func() error
+	if *h.wav != "" {
+		var err error
+		if host.Sink, finishWAV, err = createWAV(*h.wav); err != nil {
+			return err
+		}
+		host.SampleRate = sampleRate
+	}
+
+	frame := host.Run(chip8)
+	if finishWAV != nil {
+		if err := finishWAV(); err != nil {
+			return err
+		}
+	}
+
+	if *h.dump == "-" {
+		fmt.Print(frame.Text())
+		return nil
+	}
+	out, err := os.Create(*h.dump)
+	if err != nil {
+		return fmt.Errorf("could not create dump (%s): %w", *h.dump, err)
+	}
+	defer out.Close()
+
+	if !strings.EqualFold(filepath.Ext(*h.dump), ".png") {
+		_, err = out.WriteString(frame.Text())
+		return err
+	}
+	colours, err := renderer.ParsePalette(*machine.palette)
+	if err != nil {
+		return err
+	}
+	palette := make(color.Palette, len(colours))
+	for n, c := range colours {
+		palette[n] = c
+	}
+	return png.Encode(out, frame.Image(palette))
+}
+
+// createWAV creates a WAV file at path for the sound, returning a function that finishes the file
+func createWAV(path string) (sink cpu.AudioSink, finish func() error, err error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create WAV (%s): %w", path, err)
+	}
+	wav, err := audio.NewWAVWriter(out, sampleRate)
+	if err != nil {
+		out.Close()
+		return nil, nil, err
+	}
+	return wav, func() error {
+		err := wav.Close()
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,112 @@
+// Package headless runs ROMs without a window, driving the keypad from a script, for tests and automation
+package headless
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pthm/gate/cpu"
+)
+
+// Event presses or releases a key at the start of a frame
+type Event struct {
+	Frame int
+	Key   uint8
+	Down  bool
+}
+
+// Script is a list of key events in frame order
+type Script []Event
+
+// ParseScript parses a script with an event per line: the frame, down or up, then the key as a hex digit, e.g.
+// "30 down 5". Blank lines and lines starting with # are ignored
+func ParseScript(r io.Reader) (Script, error) {
+	var script Script
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected frame, down or up, and key, e.g. 30 down 5", line)
+		}
+		frame, err := strconv.Atoi(fields[0])
+		if err != nil || frame < 0 {
+			return nil, fmt.Errorf("line %d: invalid frame %q", line, fields[0])
+		}
+		var down bool
+		switch fields[1] {
+		case "down":
+			down = true
+		case "up":
+		default:
+			return nil, fmt.Errorf("line %d: expected down or up, got %q", line, fields[1])
+		}
+		key, err := strconv.ParseUint(fields[2], 16, 4)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid key %q, must be 0-F", line, fields[2])
+		}
+		script = append(script, Event{Frame: frame, Key: uint8(key), Down: down})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(script, func(i, j int) bool { return script[i].Frame < script[j].Frame })
+	return script, nil
+}
+
+// Host is a cpu.Host without a window. Nothing is shown, the keypad follows a script and frames run as fast as they
+// can for a fixed number of frames
+type Host struct {
+	cpu.NopHost
+	Frames     int           // Frames to run before the host closes
+	Script     Script        // Key events, applied at the start of their frame
+	Sink       cpu.AudioSink // Where the sound goes, nil for silence
+	SampleRate int
+
+	frame int // Frames started so far
+}
+
+// Run runs chip8 on the host until it has run every frame and returns the display at the end
+func (h *Host) Run(chip8 *cpu.CPU) cpu.Frame {
+	chip8.SetHost(h)
+	chip8.Run(context.Background())
+	return chip8.Frame()
+}
+
+// WaitFrame starts the next frame straight away, until every frame has run
+func (h *Host) WaitFrame(ctx context.Context) bool {
+	if ctx.Err() != nil || h.frame >= h.Frames {
+		return false
+	}
+	h.frame++
+	return true
+}
+
+// PollInput applies the script's events up to the current frame
+func (h *Host) PollInput(keys *[16]bool) {
+	for len(h.Script) > 0 && h.Script[0].Frame < h.frame {
+		keys[h.Script[0].Key] = h.Script[0].Down
+		h.Script = h.Script[1:]
+	}
+}
+
+func (h *Host) Audio() (cpu.AudioSink, int) {
+	return h.Sink, h.SampleRate
+}
+
+// Run runs frames frames of chip8 as fast as it can, applying the script's events at the start of each frame, and
+// returns the display at the end
+func Run(chip8 *cpu.CPU, frames int, script Script) cpu.Frame {
+	host := &Host{Frames: frames, Script: script}
+	return host.Run(chip8)
+}
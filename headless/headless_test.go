@@ -0,0 +1,41 @@
+package headless
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pthm/gate/cpu"
+)
+
+func Test_parseScript(t *testing.T) {
+	script, err := ParseScript(strings.NewReader("# start\n40 up A\n\n30 down a\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	want := Script{{Frame: 30, Key: 0xA, Down: true}, {Frame: 40, Key: 0xA}}
+	if len(script) != 2 || script[0] != want[0] || script[1] != want[1] {
+		t.Fatalf("events should be parsed in frame order, got %+v\n", script)
+	}
+
+	if _, err := ParseScript(strings.NewReader("30 press 5")); err == nil || !strings.HasPrefix(err.Error(), "line 1:") {
+		t.Fatalf("invalid event should return an error with its line, got %v\n", err)
+	}
+}
+
+func Test_run(t *testing.T) {
+	chip8 := cpu.NewCPU(cpu.QuirksVIP)
+	chip8.LoadROM([]uint8{
+		0xF0, 0x0A, // V0 := key
+		0xF0, 0x29, // I := hex V0
+		0xD0, 0x05, // sprite V0 V0 5
+		0x12, 0x06, // jump 0x206
+	})
+
+	script := Script{{Frame: 2, Key: 0x1, Down: true}, {Frame: 3, Key: 0x1}}
+	frame := Run(chip8, 5, script)
+
+	// The 1 sprite is drawn at (1, 1), its top row is ..#.
+	if frame.Width != cpu.LoResWidth || frame.Pixels[3][1] != 1 || frame.Pixels[1][1] != 0 {
+		t.Fatalf("scripted key press should be drawn\n%s", frame.Text())
+	}
+}
@@ -1,38 +1,58 @@
 package main
 
 import (
-	"context"
-	"flag"
 	"fmt"
-	"github.com/pthm/gate/cpu"
-	"github.com/pthm/gate/renderer"
 	"os"
+	"sort"
 )
 
-func main() {
-
-	chip8 := cpu.NewCPU()
-
-	flag.Parse()
-	romPath := flag.Arg(0)
+// commands are the subcommands of gate, each is passed the arguments after its name
+var commands = map[string]func(args []string) error{
+	"run":         runCommand,
+	"asm":         asmCommand,
+	"conformance": conformanceCommand,
+	"debug":       debugCommand,
+	"dap":         dapCommand,
+	"disasm":      disasmCommand,
+	"gdb":         gdbCommand,
+	"tracediff":   tracediffCommand,
+}
 
-	if romPath == "" {
-		fmt.Println("Must supply a path to a ROM")
-		return
+func main() {
+	args := os.Args[1:]
+
+	// Running a ROM is the default, so `gate rom.ch8` still works
+	command := "run"
+	if len(args) > 0 {
+		if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+			usage()
+			return
+		}
+		if _, ok := commands[args[0]]; ok {
+			command = args[0]
+			args = args[1:]
+		}
 	}
 
-	romBytes, err := os.ReadFile(romPath)
-	if err != nil {
-		fmt.Printf("Could not read ROM file at (%s): %v", romPath, err)
-		return
+	if err := commands[command](args); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
-	chip8.LoadROM(romBytes)
-
-	rlRenderer := renderer.NewRaylibRenderer(64*16, 32*16)
-	chip8.SetRenderer(rlRenderer)
+}
 
-	go chip8.Run(context.Background())
-	rlRenderer.Run()
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	defer rlRenderer.Close()
+	fmt.Println("usage: gate <command> [flags] [args]")
+	fmt.Println()
+	fmt.Println("commands:")
+	for _, name := range names {
+		fmt.Printf("  %s\n", name)
+	}
+	fmt.Println()
+	fmt.Println("Run `gate <command> -h` for the flags of a command, gate runs a ROM when no command is given")
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/pthm/gate/cpu"
+	"github.com/pthm/gate/movie"
+	"os"
+	"time"
+)
+
+// movieFlags configure recording the keypad to a movie or playing one back
+type movieFlags struct {
+	record *string
+	play   *string
+	movie  *movie.Movie // The movie played back, read by newCPU
+}
+
+func addMovieFlags(flags *flag.FlagSet) *movieFlags {
+	return &movieFlags{
+		record: flags.String("record", "", "record the keypad to a movie file, rewinding is disabled while recording"),
+		play:   flags.String("play", "", "play back a movie file, the quirks, instruction rate and seed it was recorded with are used in place of the flags"),
+	}
+}
+
+// newCPU creates a CPU configured by the flags and loads the ROM at romPath into it, when playing back a movie the
+// CPU is configured as the movie was recorded instead
+func (f *movieFlags) newCPU(machine *machineFlags, romPath string) (*cpu.CPU, error) {
+	if *f.record != "" && *f.play != "" {
+		return nil, errors.New("-record and -play cannot be used together")
+	}
+	if *f.record != "" {
+		*machine.rewindMB = 0 // Rewinding is not recorded, so would put playback out of sync
+		if *machine.seed == 0 {
+			*machine.seed = uint64(time.Now().UnixNano()) | 1 // The seed goes in the movie, so pick one here
+		}
+	}
+	if *f.play == "" {
+		return machine.newCPU(romPath)
+	}
+
+	in, err := os.Open(*f.play)
+	if err != nil {
+		return nil, fmt.Errorf("could not open movie (%s): %w", *f.play, err)
+	}
+	f.movie, err = movie.Read(in)
+	in.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", *f.play, err)
+	}
+
+	tone, err := machine.tone()
+	if err != nil {
+		return nil, err
+	}
+	chip8 := f.movie.NewCPU(cpu.WithTone(tone))
+	if err := loadProgramInto(chip8, romPath); err != nil {
+		return nil, err
+	}
+	if chip8.ROMHash() != f.movie.ROMHash {
+		return nil, fmt.Errorf("%s was recorded with a different ROM", *f.play)
+	}
+	return chip8, nil
+}
+
+// start records or plays back chip8 as the flags say, returning a function that stops and saves the recording or
+// reports whether playback stayed in sync. Playing back headless runs for the length of the movie
+func (f *movieFlags) start(chip8 *cpu.CPU, machine *machineFlags, noWindow *headlessFlags) (stop func() error) {
+	switch {
+	case *f.record != "":
+		recorder := movie.NewRecorder(movie.HeaderOf(chip8, *machine.seed))
+		chip8.SetFrameHook(recorder)
+		return func() error {
+			chip8.SetFrameHook(nil)
+			out, err := os.Create(*f.record)
+			if err != nil {
+				return fmt.Errorf("could not create movie (%s): %w", *f.record, err)
+			}
+			if err := recorder.Movie().Write(out); err != nil {
+				out.Close()
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Recorded %d frames to %s\n", len(recorder.Movie().Frames), *f.record)
+			return out.Close()
+		}
+	case f.movie != nil:
+		player := movie.NewPlayer(f.movie)
+		chip8.SetFrameHook(player)
+		*noWindow.frames = len(f.movie.Frames)
+		return func() error {
+			chip8.SetFrameHook(nil)
+			if err := player.Err(); err != nil {
+				return err
+			}
+			if !player.Done() {
+				fmt.Fprintf(os.Stderr, "Playback stopped before the end of %s\n", *f.play)
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Played back %d frames in sync\n", len(f.movie.Frames))
+			return nil
+		}
+	default:
+		return func() error { return nil }
+	}
+}
@@ -0,0 +1,164 @@
+package movie
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pthm/gate/cpu"
+)
+
+// magic is the first line of a movie file, the number is bumped whenever the format changes
+const magic = "gate-movie 1"
+
+// quirkNames name the quirks in the header, a quirk is on when its name is listed
+var quirkNames = []struct {
+	name  string
+	quirk func(q *cpu.Quirks) *bool
+}{
+	{"shiftvy", func(q *cpu.Quirks) *bool { return &q.ShiftVY }},
+	{"loadstoreinci", func(q *cpu.Quirks) *bool { return &q.LoadStoreIncI }},
+	{"jumpvx", func(q *cpu.Quirks) *bool { return &q.JumpVX }},
+	{"logicresetsvf", func(q *cpu.Quirks) *bool { return &q.LogicResetsVF }},
+	{"clipsprites", func(q *cpu.Quirks) *bool { return &q.ClipSprites }},
+	{"displaywait", func(q *cpu.Quirks) *bool { return &q.DisplayWait }},
+}
+
+// Write writes the movie as text: the header a field per line, a blank line, then a line per frame with the keys
+// held as a four digit hex bitmask and the display hash, e.g. "0020 8a3f09c1d2e4b5a6"
+func (m *Movie) Write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	var quirks []string
+	for _, q := range quirkNames {
+		if *q.quirk(&m.Quirks) {
+			quirks = append(quirks, q.name)
+		}
+	}
+	fmt.Fprintln(b, magic)
+	fmt.Fprintf(b, "rom %x\n", m.ROMHash)
+	fmt.Fprintf(b, "quirks %s\n", strings.Join(quirks, ","))
+	fmt.Fprintf(b, "seed %d\n", m.Seed)
+	fmt.Fprintf(b, "hz %d\n", m.ClockSpeed)
+	fmt.Fprintln(b)
+	for _, f := range m.Frames {
+		fmt.Fprintf(b, "%04x %016x\n", f.Keys, f.Hash)
+	}
+	return b.Flush()
+}
+
+// Read reads a movie written by Write
+func Read(r io.Reader) (*Movie, error) {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	next := func() (string, bool) {
+		line++
+		if !scanner.Scan() {
+			return "", false
+		}
+		return strings.TrimSpace(scanner.Text()), true
+	}
+
+	if text, _ := next(); text != magic {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("not a gate movie")
+	}
+
+	movie := &Movie{}
+	seen := map[string]bool{}
+	for {
+		text, ok := next()
+		if !ok {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("line %d: header should end with a blank line", line)
+		}
+		if text == "" {
+			break
+		}
+		field, value, _ := strings.Cut(text, " ")
+		if err := movie.readField(field, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		seen[field] = true
+	}
+	for _, field := range []string{"rom", "quirks", "seed", "hz"} {
+		if !seen[field] {
+			return nil, fmt.Errorf("header is missing %s", field)
+		}
+	}
+
+	for {
+		text, ok := next()
+		if !ok {
+			break
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected keys and display hash", line)
+		}
+		keys, err := strconv.ParseUint(fields[0], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid keys %q", line, fields[0])
+		}
+		hash, err := strconv.ParseUint(fields[1], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid display hash %q", line, fields[1])
+		}
+		movie.Frames = append(movie.Frames, Frame{Keys: uint16(keys), Hash: hash})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return movie, nil
+}
+
+// readField sets a header field from its line
+func (m *Movie) readField(field, value string) error {
+	switch field {
+	case "rom":
+		hash, err := hex.DecodeString(value)
+		if err != nil || len(hash) != len(m.ROMHash) {
+			return fmt.Errorf("invalid ROM hash %q", value)
+		}
+		copy(m.ROMHash[:], hash)
+	case "quirks":
+		m.Quirks = cpu.Quirks{}
+		for _, name := range strings.Split(value, ",") {
+			if name == "" {
+				continue
+			}
+			found := false
+			for _, q := range quirkNames {
+				if q.name == name {
+					*q.quirk(&m.Quirks) = true
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("unknown quirk %q", name)
+			}
+		}
+	case "seed":
+		seed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid seed %q", value)
+		}
+		m.Seed = seed
+	case "hz":
+		hz, err := strconv.Atoi(value)
+		if err != nil || hz <= 0 {
+			return fmt.Errorf("invalid instruction rate %q", value)
+		}
+		m.ClockSpeed = hz
+	default:
+		return fmt.Errorf("unknown header field %q", field)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Package movie records the keypad a frame at a time so a session can be played back exactly, for reproducing bugs
+// and tool-assisted play. Only input is recorded: resetting, rewinding or loading a state while recording puts the
+// playback out of sync, which the display hashes stored with each frame catch
+package movie
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"sync"
+
+	"github.com/pthm/gate/cpu"
+)
+
+// Header describes the machine a movie was recorded on, playback needs the same ROM and settings to stay in sync
+type Header struct {
+	ROMHash    [sha1.Size]byte
+	Quirks     cpu.Quirks
+	Seed       uint64 // Seed of the random number generator
+	ClockSpeed int    // Instructions executed per second
+}
+
+// NewCPU creates a CPU configured as the header says, the ROM still has to be loaded. The header's settings win over
+// any options that would change them
+func (h Header) NewCPU(opts ...cpu.Option) *cpu.CPU {
+	opts = append(opts, cpu.WithClockSpeed(h.ClockSpeed), cpu.WithSeed(h.Seed))
+	return cpu.NewCPU(h.Quirks, opts...)
+}
+
+// Frame is the keypad held during a frame and the display at the end of it
+type Frame struct {
+	Keys uint16 // Bit n is set while key n is held
+	Hash uint64 // See cpu.Frame.Hash
+}
+
+// Movie is a recorded session
+type Movie struct {
+	Header
+	Frames []Frame
+}
+
+// Desync is returned by Player when the display does not match the one recorded
+type Desync struct {
+	Frame int
+	Want  uint64
+	Got   uint64
+}
+
+func (d *Desync) Error() string {
+	return fmt.Sprintf("playback out of sync at frame %d, display hash is %016x, recorded %016x", d.Frame, d.Got, d.Want)
+}
+
+// keyMask packs the keypad into a bitmask
+func keyMask(keys *[16]bool) uint16 {
+	var mask uint16
+	for k, down := range keys {
+		if down {
+			mask |= 1 << k
+		}
+	}
+	return mask
+}
+
+// Recorder is a cpu.FrameHook that records the frames a CPU executes
+type Recorder struct {
+	movie Movie
+	keys  uint16 // Keys held at the start of the current frame
+}
+
+// NewRecorder starts a movie with header, see HeaderOf
+func NewRecorder(header Header) *Recorder {
+	return &Recorder{movie: Movie{Header: header}}
+}
+
+// HeaderOf returns the header for a movie recorded on chip8. The CPU does not expose its seed, so it must be the
+// seed chip8 was created with
+func HeaderOf(chip8 *cpu.CPU, seed uint64) Header {
+	return Header{
+		ROMHash:    chip8.ROMHash(),
+		Quirks:     chip8.Quirks(),
+		Seed:       seed,
+		ClockSpeed: chip8.ClockSpeed(),
+	}
+}
+
+func (r *Recorder) BeginFrame(keys *[16]bool) {
+	r.keys = keyMask(keys)
+}
+
+func (r *Recorder) EndFrame(frame *cpu.Frame) {
+	r.movie.Frames = append(r.movie.Frames, Frame{Keys: r.keys, Hash: frame.Hash()})
+}
+
+// Movie returns the movie recorded so far, the recorder must be removed from the CPU first
+func (r *Recorder) Movie() *Movie {
+	return &r.movie
+}
+
+// Player is a cpu.FrameHook that plays a movie back, holding the recorded keys each frame and checking the display
+// against the recorded hashes. Keys pressed on the keypad while playing are ignored. Once the movie has finished the
+// keys are left as they are
+type Player struct {
+	mu    sync.Mutex // The CPU calls the hook from its own goroutine
+	movie *Movie
+	frame int   // Next frame to play
+	err   error // The first desync
+}
+
+// NewPlayer plays movie from its first frame, the CPU must be fresh from Header.NewCPU with the ROM loaded
+func NewPlayer(movie *Movie) *Player {
+	return &Player{movie: movie}
+}
+
+func (p *Player) BeginFrame(keys *[16]bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done() {
+		return
+	}
+	mask := p.movie.Frames[p.frame].Keys
+	for k := range keys {
+		keys[k] = mask&(1<<k) != 0
+	}
+}
+
+func (p *Player) EndFrame(frame *cpu.Frame) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done() {
+		return
+	}
+	want := p.movie.Frames[p.frame].Hash
+	if got := frame.Hash(); got != want && p.err == nil {
+		p.err = &Desync{Frame: p.frame, Want: want, Got: got}
+	}
+	p.frame++
+}
+
+// Done reports whether every frame of the movie has been played
+func (p *Player) Done() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.done()
+}
+
+func (p *Player) done() bool {
+	return p.frame >= len(p.movie.Frames)
+}
+
+// Err returns the first desync, or nil if playback has matched the recording so far
+func (p *Player) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
@@ -0,0 +1,109 @@
+package movie
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pthm/gate/cpu"
+	"github.com/pthm/gate/headless"
+)
+
+// rom draws the 0 character at a random position each frame, clearing the display first while key 5 is held
+var rom = []uint8{
+	0x62, 0x05, // LD V2, 5
+	0xC0, 0x3F, // RND V0, 0x3F
+	0xC1, 0x1F, // RND V1, 0x1F
+	0xE2, 0xA1, // SKNP V2
+	0x00, 0xE0, // CLS
+	0xA0, 0x00, // LD I, 0
+	0xD0, 0x15, // DRW V0, V1, 5
+	0x12, 0x02, // JP 0x202
+}
+
+// record runs rom for 60 frames holding key 5 from frame 20 to 30 and returns the movie
+func record(t *testing.T) *Movie {
+	chip8 := cpu.NewCPU(cpu.QuirksVIP, cpu.WithSeed(42))
+	if err := chip8.LoadROM(rom); err != nil {
+		t.Fatalf("could not load ROM: %v\n", err)
+	}
+	recorder := NewRecorder(HeaderOf(chip8, 42))
+	chip8.SetFrameHook(recorder)
+	headless.Run(chip8, 60, headless.Script{{Frame: 20, Key: 5, Down: true}, {Frame: 30, Key: 5}})
+	chip8.SetFrameHook(nil)
+	return recorder.Movie()
+}
+
+// play plays movie back on a CPU created from its header and returns the first desync
+func play(t *testing.T, movie *Movie) error {
+	chip8 := movie.NewCPU()
+	if err := chip8.LoadROM(rom); err != nil {
+		t.Fatalf("could not load ROM: %v\n", err)
+	}
+	player := NewPlayer(movie)
+	chip8.SetFrameHook(player)
+	headless.Run(chip8, len(movie.Frames), nil)
+	if !player.Done() {
+		t.Fatalf("player should have finished the movie\n")
+	}
+	return player.Err()
+}
+
+func Test_recordAndPlay(t *testing.T) {
+	movie := record(t)
+	if len(movie.Frames) != 60 {
+		t.Fatalf("should record 60 frames, recorded %d\n", len(movie.Frames))
+	}
+	if movie.Frames[19].Keys != 0 || movie.Frames[20].Keys != 1<<5 || movie.Frames[30].Keys != 0 {
+		t.Fatalf("key 5 should be recorded held for frames 20-29\n")
+	}
+
+	var buf bytes.Buffer
+	if err := movie.Write(&buf); err != nil {
+		t.Fatalf("could not write movie: %v\n", err)
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("could not read movie: %v\n", err)
+	}
+	if read.Header != movie.Header || len(read.Frames) != len(movie.Frames) {
+		t.Fatalf("movie should read back as written, header was %+v\n", read.Header)
+	}
+
+	if err := play(t, read); err != nil {
+		t.Fatalf("playback should stay in sync: %v\n", err)
+	}
+}
+
+func Test_playDesync(t *testing.T) {
+	movie := record(t)
+	movie.Frames[25].Keys = 0
+
+	var desync *Desync
+	if err := play(t, movie); !errors.As(err, &desync) {
+		t.Fatalf("changing the input should desync, got %v\n", err)
+	}
+	if desync.Frame != 25 {
+		t.Fatalf("should desync at frame 25, was %d\n", desync.Frame)
+	}
+
+	movie = record(t)
+	movie.Seed++
+	if err := play(t, movie); err == nil {
+		t.Fatalf("changing the seed should desync\n")
+	}
+}
+
+func Test_readInvalid(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"gate-movie 1\nrom 00\nquirks\nseed 1\nhz 700\n\n",
+		"gate-movie 1\nquirks\nseed 1\nhz 700\n\n",
+		"gate-movie 1\nrom 0000000000000000000000000000000000000000\nquirks wrap\nseed 1\nhz 700\n\n",
+		"gate-movie 1\nrom 0000000000000000000000000000000000000000\nquirks\nseed 1\nhz 700\n\n0020\n",
+	} {
+		if _, err := Read(bytes.NewBufferString(text)); err == nil {
+			t.Fatalf("reading %q should fail\n", text)
+		}
+	}
+}
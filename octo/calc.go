@@ -0,0 +1,136 @@
+package octo
+
+import (
+	"fmt"
+	"math"
+)
+
+// calcUnary are the prefix operators of :calc expressions
+var calcUnary = map[string]func(c *compiler, x float64) (float64, error){
+	"-":     func(_ *compiler, x float64) (float64, error) { return -x, nil },
+	"~":     func(_ *compiler, x float64) (float64, error) { return float64(^int(x)), nil },
+	"!":     func(_ *compiler, x float64) (float64, error) { return boolValue(x == 0), nil },
+	"sin":   func(_ *compiler, x float64) (float64, error) { return math.Sin(x), nil },
+	"cos":   func(_ *compiler, x float64) (float64, error) { return math.Cos(x), nil },
+	"tan":   func(_ *compiler, x float64) (float64, error) { return math.Tan(x), nil },
+	"exp":   func(_ *compiler, x float64) (float64, error) { return math.Exp(x), nil },
+	"log":   func(_ *compiler, x float64) (float64, error) { return math.Log(x), nil },
+	"abs":   func(_ *compiler, x float64) (float64, error) { return math.Abs(x), nil },
+	"sqrt":  func(_ *compiler, x float64) (float64, error) { return math.Sqrt(x), nil },
+	"ceil":  func(_ *compiler, x float64) (float64, error) { return math.Ceil(x), nil },
+	"floor": func(_ *compiler, x float64) (float64, error) { return math.Floor(x), nil },
+	"sign": func(_ *compiler, x float64) (float64, error) {
+		switch {
+		case x < 0:
+			return -1, nil
+		case x > 0:
+			return 1, nil
+		}
+		return 0, nil
+	},
+	// @ reads a byte that has already been compiled
+	"@": func(c *compiler, x float64) (float64, error) {
+		addr := int(x)
+		if addr < 0 || addr >= len(c.memory) {
+			return 0, fmt.Errorf("@ address %d is outside memory", addr)
+		}
+		return float64(c.memory[addr]), nil
+	},
+}
+
+// calcBinary are the infix operators of :calc expressions
+var calcBinary = map[string]func(x, y float64) float64{
+	"+":   func(x, y float64) float64 { return x + y },
+	"-":   func(x, y float64) float64 { return x - y },
+	"*":   func(x, y float64) float64 { return x * y },
+	"/":   func(x, y float64) float64 { return x / y },
+	"%":   func(x, y float64) float64 { return math.Mod(x, y) },
+	"&":   func(x, y float64) float64 { return float64(int(x) & int(y)) },
+	"|":   func(x, y float64) float64 { return float64(int(x) | int(y)) },
+	"^":   func(x, y float64) float64 { return float64(int(x) ^ int(y)) },
+	"<<":  func(x, y float64) float64 { return float64(int(x) << uint(y)) },
+	">>":  func(x, y float64) float64 { return float64(int(x) >> uint(y)) },
+	"pow": math.Pow,
+	"min": math.Min,
+	"max": math.Max,
+	"<":   func(x, y float64) float64 { return boolValue(x < y) },
+	"<=":  func(x, y float64) float64 { return boolValue(x <= y) },
+	"==":  func(x, y float64) float64 { return boolValue(x == y) },
+	"!=":  func(x, y float64) float64 { return boolValue(x != y) },
+	">=":  func(x, y float64) float64 { return boolValue(x >= y) },
+	">":   func(x, y float64) float64 { return boolValue(x > y) },
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// calc evaluates the tokens of a { } block. Like Octo, binary operators all have the same precedence and are
+// evaluated right to left, so 2 * 3 + 1 is 8, use parentheses to group
+func (c *compiler) calc(tokens []token) (float64, error) {
+	value, rest, err := c.calcExpr(tokens)
+	if err != nil {
+		return 0, err
+	}
+	if len(rest) > 0 {
+		return 0, fmt.Errorf("unexpected %s in expression", rest[0].text)
+	}
+	return value, nil
+}
+
+func (c *compiler) calcExpr(tokens []token) (float64, []token, error) {
+	left, rest, err := c.calcTerm(tokens)
+	if err != nil || len(rest) == 0 || rest[0].text == ")" {
+		return left, rest, err
+	}
+
+	op, ok := calcBinary[rest[0].text]
+	if !ok {
+		return 0, nil, fmt.Errorf("unknown operator %s", rest[0].text)
+	}
+	right, rest, err := c.calcExpr(rest[1:])
+	if err != nil {
+		return 0, nil, err
+	}
+	return op(left, right), rest, nil
+}
+
+func (c *compiler) calcTerm(tokens []token) (float64, []token, error) {
+	if len(tokens) == 0 {
+		return 0, nil, fmt.Errorf("expected a value")
+	}
+	tok, rest := tokens[0], tokens[1:]
+
+	if tok.text == "(" {
+		value, rest, err := c.calcExpr(rest)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(rest) == 0 || rest[0].text != ")" {
+			return 0, nil, fmt.Errorf("missing )")
+		}
+		return value, rest[1:], nil
+	}
+	if op, ok := calcUnary[tok.text]; ok {
+		value, rest, err := c.calcTerm(rest)
+		if err != nil {
+			return 0, nil, err
+		}
+		value, err = op(c, value)
+		return value, rest, err
+	}
+
+	switch tok.text {
+	case "HERE":
+		return float64(c.here), rest, nil
+	case "PI":
+		return math.Pi, rest, nil
+	case "E":
+		return math.E, rest, nil
+	}
+	value, err := c.constant(tok)
+	return value, rest, err
+}
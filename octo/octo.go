@@ -0,0 +1,408 @@
+// Package octo compiles programs written in the Octo assembly language (.8o) into CHIP-8 ROMs
+package octo
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pthm/gate/asm"
+)
+
+// Origin is where programs are compiled to, where CPU.LoadROM places the ROM
+const Origin = 0x200
+
+// maxMacroDepth limits nested macro expansion so a macro that invokes itself is reported instead of hanging
+const maxMacroDepth = 64
+
+// macro is a :macro definition, invoking it substitutes the arguments into the body
+type macro struct {
+	args []string
+	body []token
+}
+
+// fixupKind is the way a forward reference to a label is patched once the label is known
+type fixupKind int
+
+const (
+	fixAddress  fixupKind = iota // The low 12 bits of an instruction
+	fixLong                      // A 16-bit address
+	fixHigh                      // The high nibble of an address, ORed into a byte by :unpack
+	fixLongHigh                  // The high byte of an address
+	fixLow                       // The low byte of an address
+)
+
+type fixup struct {
+	kind fixupKind
+	addr int
+	name string
+	line int
+}
+
+// flow is an open loop or if ... begin block
+type flow struct {
+	keyword string
+	addr    int   // Start of a loop, or the jump to patch for a begin or else
+	breaks  []int // Jumps out of a loop from while
+	line    int
+}
+
+type compiler struct {
+	filename  string
+	tokens    []token
+	pos       int
+	memory    [0x10000]byte
+	here      int
+	end       int
+	labels    map[string]int
+	constants map[string]float64
+	aliases   map[string]int
+	macros    map[string]*macro
+	fixups    []fixup
+	flows     []flow
+	line      int // Line of the token being compiled, for errors
+	emitted   int // Bytes compiled so far, to tell which statements generate code
+	lines     []asm.Line
+}
+
+// CompileFile reads and compiles the Octo source file at path
+func CompileFile(path string) (*asm.Output, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(path, src)
+}
+
+// Compile compiles Octo source into a ROM. Execution starts at 0x200, so unless the program begins with : main a
+// jump to main is placed there. The output has the same shape as the assembler's so either can feed a debugger
+func Compile(filename string, src []byte) (*asm.Output, error) {
+	c := &compiler{
+		filename:  filename,
+		tokens:    tokenize(string(src)),
+		here:      Origin,
+		end:       Origin,
+		labels:    map[string]int{},
+		constants: map[string]float64{},
+		aliases:   map[string]int{},
+		macros:    map[string]*macro{},
+	}
+	if err := c.compile(); err != nil {
+		return nil, &asm.Error{File: filename, Line: c.line, Err: err}
+	}
+
+	out := &asm.Output{
+		Origin:    Origin,
+		Binary:    append([]byte(nil), c.memory[Origin:c.end]...),
+		Labels:    map[string]uint16{},
+		Constants: map[string]int{},
+		Lines:     c.lines,
+	}
+	for name, addr := range c.labels {
+		out.Labels[name] = uint16(addr)
+	}
+	for name, value := range c.constants {
+		out.Constants[name] = int(value)
+	}
+	return out, nil
+}
+
+func (c *compiler) compile() error {
+	if len(c.tokens) < 2 || c.tokens[0].text != ":" || c.tokens[1].text != "main" {
+		if err := c.jumpTo(0x1000, "main"); err != nil {
+			return err
+		}
+	}
+
+	for c.pos < len(c.tokens) {
+		start, emitted, line := c.here, c.emitted, c.tokens[c.pos].line
+		if err := c.statement(); err != nil {
+			return err
+		}
+		if size := c.emitted - emitted; size > 0 {
+			c.lines = append(c.lines, asm.Line{Addr: uint16(start), Size: size, File: c.filename, Line: line})
+		}
+	}
+
+	if len(c.flows) > 0 {
+		open := c.flows[len(c.flows)-1]
+		c.line = open.line
+		return fmt.Errorf("%s is never closed", open.keyword)
+	}
+
+	for _, f := range c.fixups {
+		c.line = f.line
+		addr, ok := c.labels[f.name]
+		if !ok {
+			return fmt.Errorf("undefined label %s", f.name)
+		}
+		if err := c.patch(f.kind, f.addr, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// next consumes a token
+func (c *compiler) next() (token, error) {
+	if c.pos >= len(c.tokens) {
+		return token{}, fmt.Errorf("unexpected end of file")
+	}
+	tok := c.tokens[c.pos]
+	c.pos++
+	c.line = tok.line
+	return tok, nil
+}
+
+// peek returns the next token's text without consuming it
+func (c *compiler) peek() string {
+	if c.pos >= len(c.tokens) {
+		return ""
+	}
+	return c.tokens[c.pos].text
+}
+
+// expect consumes a token which must be text
+func (c *compiler) expect(text string) error {
+	tok, err := c.next()
+	if err != nil {
+		return err
+	}
+	if tok.text != text {
+		return fmt.Errorf("expected %s, found %s", text, tok.text)
+	}
+	return nil
+}
+
+// block consumes a { } delimited list of tokens
+func (c *compiler) block() ([]token, error) {
+	if err := c.expect("{"); err != nil {
+		return nil, err
+	}
+	var body []token
+	for depth := 1; ; {
+		tok, err := c.next()
+		if err != nil {
+			return nil, err
+		}
+		switch tok.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth == 0 {
+			return body, nil
+		}
+		body = append(body, tok)
+	}
+}
+
+// name consumes a token to be defined as a label, constant, alias or macro
+func (c *compiler) name() (string, error) {
+	tok, err := c.next()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := register(tok.text); ok || isKeyword(tok.text) {
+		return "", fmt.Errorf("%s is a reserved name", tok.text)
+	}
+	if _, ok := parseNumber(tok.text); ok {
+		return "", fmt.Errorf("%s is a number, not a name", tok.text)
+	}
+	return tok.text, nil
+}
+
+// register consumes a register, either v0-vf or an :alias
+func (c *compiler) register() (int, error) {
+	tok, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	return c.registerValue(tok.text)
+}
+
+func (c *compiler) registerValue(text string) (int, error) {
+	if reg, ok := register(text); ok {
+		return reg, nil
+	}
+	if reg, ok := c.aliases[text]; ok {
+		return reg, nil
+	}
+	return 0, fmt.Errorf("expected a register, found %s", text)
+}
+
+func (c *compiler) isRegister(text string) bool {
+	_, err := c.registerValue(text)
+	return err == nil
+}
+
+// constant resolves a number, constant or label that has already been defined
+func (c *compiler) constant(tok token) (float64, error) {
+	if value, ok := parseNumber(tok.text); ok {
+		return float64(value), nil
+	}
+	if value, ok := c.constants[tok.text]; ok {
+		return value, nil
+	}
+	if addr, ok := c.labels[tok.text]; ok {
+		return float64(addr), nil
+	}
+	return 0, fmt.Errorf("undefined constant %s", tok.text)
+}
+
+// value consumes a number or constant and checks it fits in bits. Bytes may also be negative, as two's complement
+func (c *compiler) value(bits uint) (int, error) {
+	tok, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	v, err := c.constant(tok)
+	if err != nil {
+		return 0, err
+	}
+	return fits(int(v), bits)
+}
+
+func fits(v int, bits uint) (int, error) {
+	if bits == 8 && v >= -0x80 && v < 0 {
+		v &= 0xFF
+	}
+	if v < 0 || v >= 1<<bits {
+		return 0, fmt.Errorf("%d does not fit in %d bits", v, bits)
+	}
+	return v, nil
+}
+
+// address consumes an address, labels not defined yet are patched in once compilation finishes
+func (c *compiler) address(kind fixupKind, at int) (int, error) {
+	tok, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	addr, known, err := c.addressOf(tok)
+	if err != nil || known {
+		return addr, err
+	}
+	if c.isRegister(tok.text) || isKeyword(tok.text) {
+		return 0, fmt.Errorf("expected an address, found %s", tok.text)
+	}
+	c.fixups = append(c.fixups, fixup{kind: kind, addr: at, name: tok.text, line: tok.line})
+	return 0, nil
+}
+
+// addressOf resolves an address, known is false when it names a label that hasn't been defined yet
+func (c *compiler) addressOf(tok token) (addr int, known bool, err error) {
+	_, isNumber := parseNumber(tok.text)
+	_, isConstant := c.constants[tok.text]
+	_, isLabel := c.labels[tok.text]
+	if !isNumber && !isConstant && !isLabel {
+		return 0, false, nil
+	}
+
+	v, err := c.constant(tok)
+	if err != nil {
+		return 0, true, err
+	}
+	addr, err = fits(int(v), 16)
+	return addr, true, err
+}
+
+// patch writes an address into already compiled code
+func (c *compiler) patch(kind fixupKind, at, addr int) error {
+	switch kind {
+	case fixAddress:
+		if addr > 0xFFF {
+			return fmt.Errorf("0x%X is out of range of a 12-bit address, use i := long", addr)
+		}
+		c.memory[at] = c.memory[at]&0xF0 | byte(addr>>8)
+		c.memory[at+1] = byte(addr)
+	case fixLong:
+		c.memory[at] = byte(addr >> 8)
+		c.memory[at+1] = byte(addr)
+	case fixHigh:
+		c.memory[at] |= byte(addr>>8) & 0x0F
+	case fixLongHigh:
+		c.memory[at] = byte(addr >> 8)
+	case fixLow:
+		c.memory[at] = byte(addr)
+	}
+	return nil
+}
+
+// emit compiles opcodes at the current address
+func (c *compiler) emit(opcodes ...int) error {
+	for _, op := range opcodes {
+		if err := c.emitByte(op >> 8); err != nil {
+			return err
+		}
+		if err := c.emitByte(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) emitByte(b int) error {
+	if c.here >= len(c.memory) {
+		return fmt.Errorf("program does not fit in memory")
+	}
+	c.memory[c.here] = byte(b)
+	c.here++
+	c.emitted++
+	c.end = max(c.end, c.here)
+	return nil
+}
+
+// jumpTo compiles an instruction whose low 12 bits are the address of a label, e.g. 0x1000 jump or 0x2000 call
+func (c *compiler) jumpTo(opcode int, label string) error {
+	if addr, ok := c.labels[label]; ok {
+		if addr > 0xFFF {
+			return fmt.Errorf("%s at 0x%X is out of range of a 12-bit address", label, addr)
+		}
+		return c.emit(opcode | addr)
+	}
+	c.fixups = append(c.fixups, fixup{kind: fixAddress, addr: c.here, name: label, line: c.line})
+	return c.emit(opcode)
+}
+
+// jumpWith compiles an instruction followed by an address operand, e.g. jump 0x300 or jump0 table
+func (c *compiler) jumpWith(opcode int) error {
+	addr, err := c.address(fixAddress, c.here)
+	if err != nil {
+		return err
+	}
+	if addr > 0xFFF {
+		return fmt.Errorf("0x%X is out of range of a 12-bit address", addr)
+	}
+	return c.emit(opcode | addr)
+}
+
+// expand replaces a macro invocation with the macro body
+func (c *compiler) expand(tok token, m *macro) error {
+	if tok.depth >= maxMacroDepth {
+		return fmt.Errorf("macro %s expands too deeply, does it invoke itself?", tok.text)
+	}
+
+	args := map[string]string{}
+	for _, name := range m.args {
+		arg, err := c.next()
+		if err != nil {
+			return err
+		}
+		args[name] = arg.text
+	}
+
+	body := make([]token, len(m.body))
+	for n, b := range m.body {
+		if arg, ok := args[b.text]; ok {
+			b.text = arg
+		}
+		b.depth = tok.depth + 1
+		b.line = tok.line // Code from a macro belongs to the line that invoked it
+		body[n] = b
+	}
+
+	rest := append(body, c.tokens[c.pos:]...)
+	c.tokens = append(c.tokens[:c.pos:c.pos], rest...)
+	return nil
+}
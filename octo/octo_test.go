@@ -0,0 +1,130 @@
+package octo
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pthm/gate/asm"
+)
+
+func compile(t *testing.T, src string) *asm.Output {
+	t.Helper()
+	out, err := Compile("test.8o", []byte(src))
+	if err != nil {
+		t.Fatalf("compile failed: %v\n", err)
+	}
+	return out
+}
+
+func Test_compileMain(t *testing.T) {
+	out := compile(t, ": main clear")
+	if !bytes.Equal(out.Binary, []byte{0x00, 0xE0}) {
+		t.Fatalf("main first should not need a jump, got % X\n", out.Binary)
+	}
+
+	out = compile(t, ": sub return : main sub")
+	if !bytes.Equal(out.Binary, []byte{0x12, 0x04, 0x00, 0xEE, 0x22, 0x02}) {
+		t.Fatalf("0x200 should jump to main, got % X\n", out.Binary)
+	}
+}
+
+func Test_compileLoop(t *testing.T) {
+	out := compile(t, `
+: main
+	v0 := 5
+	v1 += -1
+	loop
+		v0 -= 1
+		while v0 != 0
+	again
+	sub # a forward call
+	i := long data
+: sub ;
+: data 0xAB
+`)
+	want := []byte{
+		0x60, 0x05,
+		0x71, 0xFF,
+		0x70, 0xFF, // loop
+		0x40, 0x00, // skip the break while v0 != 0
+		0x12, 0x0C, // break
+		0x12, 0x04, // again
+		0x22, 0x12,
+		0xF0, 0x00, 0x02, 0x14,
+		0x00, 0xEE,
+		0xAB,
+	}
+	if !bytes.Equal(out.Binary, want) {
+		t.Fatalf("binary should be % X, was % X\n", want, out.Binary)
+	}
+}
+
+func Test_compileBranches(t *testing.T) {
+	out := compile(t, `
+: main
+	if v1 > v2 begin v3 := 1 else v3 := 2 end
+	if v0 key then v4 := 1
+	:const N 3
+	:calc M { N * 2 + 1 }
+	:alias counter v5
+	counter := M
+	:macro twice op { op op }
+	twice clear
+	:next self v6 := 0
+	:unpack 0xA self
+`)
+	want := []byte{
+		0x8F, 0x20, 0x8F, 0x15, // vf := v2, vf -= v1
+		0x3F, 0x00, // skip the jump to else when v1 > v2
+		0x12, 0x0C,
+		0x63, 0x01,
+		0x12, 0x0E, // else jumps past end
+		0x63, 0x02,
+		0xE0, 0xA1, 0x64, 0x01,
+		0x65, 0x09, // :calc evaluates right to left, N * (2 + 1)
+		0x00, 0xE0, 0x00, 0xE0,
+		0x66, 0x00,
+		0x60, 0xA2, 0x61, 0x19,
+	}
+	if !bytes.Equal(out.Binary, want) {
+		t.Fatalf("binary should be % X, was % X\n", want, out.Binary)
+	}
+	if out.Labels["self"] != 0x219 || out.Constants["M"] != 9 {
+		t.Fatalf("symbols were not recorded: %v %v\n", out.Labels, out.Constants)
+	}
+
+	// Macro expansions belong to the line that invoked them
+	if line, ok := out.LineAt(0x216); !ok || line.Line != 10 {
+		t.Fatalf("0x216 should map to line 10, got %+v\n", line)
+	}
+}
+
+func Test_compileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+		msg  string
+	}{
+		{": main\nv0 := 256", 2, "does not fit"},
+		{": main\nloop\nclear", 2, "never closed"},
+		{": main\njump nowhere", 2, "undefined label"},
+		{": main\nend", 2, "end without"},
+		{": main\n: main", 2, "already defined"},
+		{": main\n:macro m { m }\nm", 3, "expands too deeply"},
+		{": main\ni := v0", 2, "expected an address"},
+		{": main\nsprite v0 5 1", 2, "expected a register"},
+	}
+
+	for _, test := range tests {
+		_, err := Compile("test.8o", []byte(test.src))
+		var asmErr *asm.Error
+		if !errors.As(err, &asmErr) {
+			t.Fatalf("%q should fail with a compile error, got %v\n", test.src, err)
+		}
+		if asmErr.Line != test.line || !strings.Contains(err.Error(), test.msg) {
+			t.Fatalf("%q should fail on line %d with %q, got %v\n", test.src, test.line, test.msg, err)
+		}
+	}
+}
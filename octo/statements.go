@@ -0,0 +1,628 @@
+package octo
+
+import (
+	"fmt"
+)
+
+// keywords can't be used as names
+var keywords = map[string]bool{
+	"clear": true, "return": true, ";": true, "scroll-down": true, "scroll-up": true, "scroll-right": true,
+	"scroll-left": true, "exit": true, "lores": true, "hires": true, "jump": true, "jump0": true, "sprite": true,
+	"bcd": true, "save": true, "load": true, "saveflags": true, "loadflags": true, "plane": true, "audio": true,
+	"delay": true, "buzzer": true, "pitch": true, "i": true, "if": true, "then": true, "begin": true, "else": true,
+	"end": true, "loop": true, "again": true, "while": true, "key": true, "-key": true, "random": true, "hex": true,
+	"bighex": true, "long": true, ":=": true, "+=": true, "-=": true, "=-": true, "|=": true, "&=": true, "^=": true,
+	">>=": true, "<<=": true, "==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true,
+}
+
+func isKeyword(text string) bool {
+	return keywords[text] || (len(text) > 0 && text[0] == ':')
+}
+
+// statement compiles the next statement
+func (c *compiler) statement() error {
+	tok, err := c.next()
+	if err != nil {
+		return err
+	}
+
+	switch tok.text {
+	case "clear":
+		return c.emit(0x00E0)
+	case "return", ";":
+		return c.emit(0x00EE)
+	case "scroll-down", "scroll-up":
+		n, err := c.value(4)
+		if err != nil {
+			return err
+		}
+		if tok.text == "scroll-down" {
+			return c.emit(0x00C0 | n)
+		}
+		return c.emit(0x00D0 | n)
+	case "scroll-right":
+		return c.emit(0x00FB)
+	case "scroll-left":
+		return c.emit(0x00FC)
+	case "exit":
+		return c.emit(0x00FD)
+	case "lores":
+		return c.emit(0x00FE)
+	case "hires":
+		return c.emit(0x00FF)
+	case "audio":
+		return c.emit(0xF002)
+	case "jump":
+		return c.jumpWith(0x1000)
+	case ":call":
+		return c.jumpWith(0x2000)
+	case "jump0":
+		return c.jumpWith(0xB000)
+	case "sprite":
+		x, err := c.register()
+		if err != nil {
+			return err
+		}
+		y, err := c.register()
+		if err != nil {
+			return err
+		}
+		n, err := c.value(4)
+		if err != nil {
+			return err
+		}
+		return c.emit(0xD000 | x<<8 | y<<4 | n)
+	case "bcd", "saveflags", "loadflags":
+		x, err := c.register()
+		if err != nil {
+			return err
+		}
+		return c.emit(map[string]int{"bcd": 0xF033, "saveflags": 0xF075, "loadflags": 0xF085}[tok.text] | x<<8)
+	case "save", "load":
+		return c.saveLoad(tok.text)
+	case "plane":
+		n, err := c.value(4)
+		if err != nil {
+			return err
+		}
+		return c.emit(0xF001 | n<<8)
+	case "delay", "buzzer", "pitch":
+		if err := c.expect(":="); err != nil {
+			return err
+		}
+		x, err := c.register()
+		if err != nil {
+			return err
+		}
+		return c.emit(map[string]int{"delay": 0xF015, "buzzer": 0xF018, "pitch": 0xF03A}[tok.text] | x<<8)
+	case "i":
+		return c.index()
+	case "if":
+		return c.ifStatement()
+	case "else":
+		return c.elseStatement()
+	case "end":
+		return c.endStatement()
+	case "loop":
+		c.flows = append(c.flows, flow{keyword: "loop", addr: c.here, line: tok.line})
+		return nil
+	case "while":
+		return c.whileStatement()
+	case "again":
+		return c.again()
+	case ":":
+		name, err := c.name()
+		if err != nil {
+			return err
+		}
+		return c.label(name, c.here)
+	}
+
+	if tok.text != "" && tok.text[0] == ':' {
+		return c.directive(tok)
+	}
+	if c.isRegister(tok.text) {
+		reg, _ := c.registerValue(tok.text)
+		return c.registerOp(reg)
+	}
+	if m, ok := c.macros[tok.text]; ok {
+		return c.expand(tok, m)
+	}
+	// Bare numbers and constants are data
+	if v, err := c.constant(tok); err == nil {
+		if _, isLabel := c.labels[tok.text]; !isLabel {
+			b, err := fits(int(v), 8)
+			if err != nil {
+				return err
+			}
+			return c.emitByte(b)
+		}
+	}
+	if isKeyword(tok.text) {
+		return fmt.Errorf("unexpected %s", tok.text)
+	}
+	// Naming a label calls it as a subroutine, it may be defined further down
+	return c.jumpTo(0x2000, tok.text)
+}
+
+// label defines a label
+func (c *compiler) label(name string, addr int) error {
+	if _, ok := c.labels[name]; ok {
+		return fmt.Errorf("label %s is already defined", name)
+	}
+	if _, ok := c.constants[name]; ok {
+		return fmt.Errorf("%s is already defined as a constant", name)
+	}
+	c.labels[name] = addr
+	return nil
+}
+
+// registerOp compiles vx := ..., vx += ... and the other register operators
+func (c *compiler) registerOp(x int) error {
+	op, err := c.next()
+	if err != nil {
+		return err
+	}
+
+	rhs := c.peek()
+	if y, err := c.registerValue(rhs); err == nil {
+		c.next()
+		codes := map[string]int{":=": 0x0, "|=": 0x1, "&=": 0x2, "^=": 0x3, "+=": 0x4, "-=": 0x5, ">>=": 0x6, "=-": 0x7, "<<=": 0xE}
+		code, ok := codes[op.text]
+		if !ok {
+			return fmt.Errorf("%s can't be used with two registers", op.text)
+		}
+		return c.emit(0x8000 | x<<8 | y<<4 | code)
+	}
+
+	switch op.text {
+	case ":=":
+		switch rhs {
+		case "random":
+			c.next()
+			n, err := c.value(8)
+			if err != nil {
+				return err
+			}
+			return c.emit(0xC000 | x<<8 | n)
+		case "delay":
+			c.next()
+			return c.emit(0xF007 | x<<8)
+		case "key":
+			c.next()
+			return c.emit(0xF00A | x<<8)
+		}
+		n, err := c.value(8)
+		if err != nil {
+			return err
+		}
+		return c.emit(0x6000 | x<<8 | n)
+	case "+=", "-=":
+		tok, err := c.next()
+		if err != nil {
+			return err
+		}
+		v, err := c.constant(tok)
+		if err != nil {
+			return err
+		}
+		if op.text == "-=" {
+			// There is no subtract immediate instruction, add the two's complement instead
+			v = -v
+		}
+		n, err := fits(int(v)&0xFF, 8)
+		if err != nil {
+			return err
+		}
+		return c.emit(0x7000 | x<<8 | n)
+	}
+	return fmt.Errorf("%s needs a register on its right", op.text)
+}
+
+// index compiles i := ... and i += vx
+func (c *compiler) index() error {
+	op, err := c.next()
+	if err != nil {
+		return err
+	}
+	if op.text == "+=" {
+		x, err := c.register()
+		if err != nil {
+			return err
+		}
+		return c.emit(0xF01E | x<<8)
+	}
+	if op.text != ":=" {
+		return fmt.Errorf("expected := or += after i, found %s", op.text)
+	}
+
+	switch c.peek() {
+	case "hex", "bighex":
+		kind, _ := c.next()
+		x, err := c.register()
+		if err != nil {
+			return err
+		}
+		if kind.text == "hex" {
+			return c.emit(0xF029 | x<<8)
+		}
+		return c.emit(0xF030 | x<<8)
+	case "long":
+		c.next()
+		if err := c.emit(0xF000); err != nil {
+			return err
+		}
+		addr, err := c.address(fixLong, c.here)
+		if err != nil {
+			return err
+		}
+		return c.emit(addr)
+	}
+	return c.jumpWith(0xA000)
+}
+
+// saveLoad compiles save vx, load vx and the XO-CHIP ranges save vx - vy and load vx - vy
+func (c *compiler) saveLoad(op string) error {
+	x, err := c.register()
+	if err != nil {
+		return err
+	}
+	if c.peek() == "-" {
+		c.next()
+		y, err := c.register()
+		if err != nil {
+			return err
+		}
+		if op == "save" {
+			return c.emit(0x5002 | x<<8 | y<<4)
+		}
+		return c.emit(0x5003 | x<<8 | y<<4)
+	}
+	if op == "save" {
+		return c.emit(0xF055 | x<<8)
+	}
+	return c.emit(0xF065 | x<<8)
+}
+
+// condition compiles the comparison after if or while. It returns the opcode that skips the next instruction when the
+// condition is false, any instructions needed to set up the comparison are compiled first
+func (c *compiler) condition() (int, error) {
+	x, err := c.register()
+	if err != nil {
+		return 0, err
+	}
+	op, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+
+	switch op.text {
+	case "key":
+		return 0xE0A1 | x<<8, nil
+	case "-key":
+		return 0xE09E | x<<8, nil
+	}
+
+	// The right hand side is a register or an immediate
+	y, isRegister := -1, false
+	n := 0
+	if reg, err := c.registerValue(c.peek()); err == nil {
+		c.next()
+		y, isRegister = reg, true
+	} else if n, err = c.value(8); err != nil {
+		return 0, err
+	}
+
+	switch op.text {
+	case "==":
+		if isRegister {
+			return 0x9000 | x<<8 | y<<4, nil
+		}
+		return 0x4000 | x<<8 | n, nil
+	case "!=":
+		if isRegister {
+			return 0x5000 | x<<8 | y<<4, nil
+		}
+		return 0x3000 | x<<8 | n, nil
+	}
+
+	// Ordered comparisons subtract into vf, whose no-borrow flag decides the skip. Operands are swapped so the
+	// subtraction always answers left >= right
+	var setup []int
+	switch op.text {
+	case "<", ">=":
+		if isRegister {
+			setup = []int{0x8F00 | x<<4, 0x8F05 | y<<4} // vf := vx, vf -= vy
+		} else {
+			setup = []int{0x6F00 | n, 0x8F07 | x<<4} // vf := n, vf =- vx
+		}
+	case ">", "<=":
+		if isRegister {
+			setup = []int{0x8F00 | y<<4, 0x8F05 | x<<4} // vf := vy, vf -= vx
+		} else {
+			setup = []int{0x6F00 | n, 0x8F05 | x<<4} // vf := n, vf -= vx
+		}
+	default:
+		return 0, fmt.Errorf("unknown comparison %s", op.text)
+	}
+	if err := c.emit(setup...); err != nil {
+		return 0, err
+	}
+
+	// vf is 1 when the subtraction didn't borrow, which means the condition holds for >= and <= and fails for < and >
+	if op.text == ">=" || op.text == "<=" {
+		return 0x3F00, nil // Skip when vf == 0
+	}
+	return 0x4F00, nil // Skip when vf != 0
+}
+
+// negate turns an opcode that skips when a condition is false into one that skips when it is true
+func negate(skip int) int {
+	switch skip & 0xF00F {
+	case 0x5000:
+		return 0x9000 | skip&0x0FFF
+	case 0x9000:
+		return 0x5000 | skip&0x0FFF
+	}
+	switch skip & 0xF000 {
+	case 0x3000:
+		return 0x4000 | skip&0x0FFF
+	case 0x4000:
+		return 0x3000 | skip&0x0FFF
+	}
+	// SKP and SKNP
+	return skip ^ (0x009E ^ 0x00A1)
+}
+
+// ifStatement compiles if ... then, which guards the following statement, and if ... begin, which opens a block
+func (c *compiler) ifStatement() error {
+	line := c.line
+	skip, err := c.condition()
+	if err != nil {
+		return err
+	}
+
+	tok, err := c.next()
+	if err != nil {
+		return err
+	}
+	switch tok.text {
+	case "then":
+		return c.emit(skip)
+	case "begin":
+		// Skip over a jump past the block when the condition holds
+		if err := c.emit(negate(skip)); err != nil {
+			return err
+		}
+		c.flows = append(c.flows, flow{keyword: "begin", addr: c.here, line: line})
+		return c.emit(0x1000)
+	}
+	return fmt.Errorf("expected then or begin, found %s", tok.text)
+}
+
+func (c *compiler) elseStatement() error {
+	if len(c.flows) == 0 || c.flows[len(c.flows)-1].keyword != "begin" {
+		return fmt.Errorf("else without if ... begin")
+	}
+	open := &c.flows[len(c.flows)-1]
+
+	jump := c.here
+	if err := c.emit(0x1000); err != nil {
+		return err
+	}
+	if err := c.patch(fixAddress, open.addr, c.here); err != nil {
+		return err
+	}
+	open.keyword, open.addr = "else", jump
+	return nil
+}
+
+func (c *compiler) endStatement() error {
+	if len(c.flows) == 0 || c.flows[len(c.flows)-1].keyword == "loop" {
+		return fmt.Errorf("end without if ... begin")
+	}
+	open := c.flows[len(c.flows)-1]
+	c.flows = c.flows[:len(c.flows)-1]
+	return c.patch(fixAddress, open.addr, c.here)
+}
+
+// whileStatement leaves the innermost loop when its condition is false
+func (c *compiler) whileStatement() error {
+	loop := -1
+	for n := len(c.flows) - 1; n >= 0; n-- {
+		if c.flows[n].keyword == "loop" {
+			loop = n
+			break
+		}
+	}
+	if loop < 0 {
+		return fmt.Errorf("while outside of a loop")
+	}
+
+	skip, err := c.condition()
+	if err != nil {
+		return err
+	}
+	if err := c.emit(negate(skip)); err != nil {
+		return err
+	}
+	c.flows[loop].breaks = append(c.flows[loop].breaks, c.here)
+	return c.emit(0x1000)
+}
+
+func (c *compiler) again() error {
+	if len(c.flows) == 0 || c.flows[len(c.flows)-1].keyword != "loop" {
+		return fmt.Errorf("again without loop")
+	}
+	open := c.flows[len(c.flows)-1]
+	c.flows = c.flows[:len(c.flows)-1]
+
+	if err := c.emit(0x1000 | open.addr); err != nil {
+		return err
+	}
+	for _, jump := range open.breaks {
+		if err := c.patch(fixAddress, jump, c.here); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// directive compiles the : prefixed directives
+func (c *compiler) directive(tok token) error {
+	switch tok.text {
+	case ":const":
+		name, err := c.name()
+		if err != nil {
+			return err
+		}
+		valueTok, err := c.next()
+		if err != nil {
+			return err
+		}
+		value, err := c.constant(valueTok)
+		if err != nil {
+			return err
+		}
+		return c.defineConstant(name, value)
+	case ":calc":
+		name, err := c.name()
+		if err != nil {
+			return err
+		}
+		body, err := c.block()
+		if err != nil {
+			return err
+		}
+		value, err := c.calc(body)
+		if err != nil {
+			return err
+		}
+		// :calc may redefine its own constants, so values can be accumulated
+		delete(c.constants, name)
+		return c.defineConstant(name, value)
+	case ":alias":
+		name, err := c.name()
+		if err != nil {
+			return err
+		}
+		reg, err := c.register()
+		if err != nil {
+			return err
+		}
+		c.aliases[name] = reg
+		return nil
+	case ":macro":
+		name, err := c.name()
+		if err != nil {
+			return err
+		}
+		m := &macro{}
+		for c.peek() != "{" {
+			arg, err := c.next()
+			if err != nil {
+				return err
+			}
+			m.args = append(m.args, arg.text)
+		}
+		if m.body, err = c.block(); err != nil {
+			return err
+		}
+		c.macros[name] = m
+		return nil
+	case ":org":
+		addr, err := c.value(16)
+		if err != nil {
+			return err
+		}
+		if addr < Origin {
+			return fmt.Errorf(":org 0x%X is below 0x%X", addr, Origin)
+		}
+		c.here = addr
+		return nil
+	case ":next":
+		name, err := c.name()
+		if err != nil {
+			return err
+		}
+		// Labels the second byte of the next instruction, which holds its operand, for self modifying code
+		return c.label(name, c.here+1)
+	case ":byte":
+		var value int
+		var err error
+		if c.peek() == "{" {
+			body, err := c.block()
+			if err != nil {
+				return err
+			}
+			v, err := c.calc(body)
+			if err != nil {
+				return err
+			}
+			if value, err = fits(int(v), 8); err != nil {
+				return err
+			}
+		} else if value, err = c.value(8); err != nil {
+			return err
+		}
+		return c.emitByte(value)
+	case ":unpack":
+		return c.unpack()
+	}
+	return fmt.Errorf("unknown directive %s", tok.text)
+}
+
+func (c *compiler) defineConstant(name string, value float64) error {
+	if _, ok := c.labels[name]; ok {
+		return fmt.Errorf("%s is already defined as a label", name)
+	}
+	if _, ok := c.constants[name]; ok {
+		return fmt.Errorf("constant %s is already defined", name)
+	}
+	c.constants[name] = value
+	return nil
+}
+
+// unpack loads an address into v0 and v1. :unpack long label loads all 16 bits, :unpack n label puts the nibble n
+// above the high 4 bits of a 12-bit address, which builds the opcode of an i := or jump to modify code with
+func (c *compiler) unpack() error {
+	long := c.peek() == "long"
+	high := 0
+	if long {
+		c.next()
+	} else {
+		n, err := c.value(4)
+		if err != nil {
+			return err
+		}
+		high = n << 4
+	}
+
+	tok, err := c.next()
+	if err != nil {
+		return err
+	}
+	addr, known, err := c.addressOf(tok)
+	if err != nil {
+		return err
+	}
+	if !known {
+		// v0 := high, v1 := low, with each byte patched in once the label is defined
+		highKind := fixHigh
+		if long {
+			highKind = fixLongHigh
+		}
+		c.fixups = append(c.fixups,
+			fixup{kind: highKind, addr: c.here + 1, name: tok.text, line: tok.line},
+			fixup{kind: fixLow, addr: c.here + 3, name: tok.text, line: tok.line})
+	}
+	if !long && addr > 0xFFF {
+		return fmt.Errorf("0x%X is out of range of a 12-bit address, use :unpack long", addr)
+	}
+
+	hi := high | (addr>>8)&0x0F
+	if long {
+		hi = addr >> 8
+	}
+	return c.emit(0x6000|hi, 0x6100|addr&0xFF)
+}
@@ -0,0 +1,68 @@
+package octo
+
+import (
+	"strings"
+)
+
+// token is a whitespace separated word of source, Octo has no other punctuation
+type token struct {
+	text  string
+	line  int
+	depth int // Macro expansion depth, to catch macros that expand themselves forever
+}
+
+// tokenize splits source into tokens, # starts a comment that runs to the end of the line
+func tokenize(src string) []token {
+	var tokens []token
+	for n, line := range strings.Split(src, "\n") {
+		if comment := strings.IndexByte(line, '#'); comment >= 0 {
+			line = line[:comment]
+		}
+		for _, field := range strings.Fields(line) {
+			tokens = append(tokens, token{text: field, line: n + 1})
+		}
+	}
+	return tokens
+}
+
+// parseNumber parses decimal, 0x hex and 0b binary numbers, with an optional leading minus
+func parseNumber(text string) (int, bool) {
+	negative := strings.HasPrefix(text, "-")
+	digits := strings.TrimPrefix(text, "-")
+
+	base := 10
+	switch {
+	case strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X"):
+		base, digits = 16, digits[2:]
+	case strings.HasPrefix(digits, "0b") || strings.HasPrefix(digits, "0B"):
+		base, digits = 2, digits[2:]
+	}
+	if digits == "" {
+		return 0, false
+	}
+
+	value := 0
+	for _, c := range strings.ToLower(digits) {
+		d := strings.IndexRune("0123456789abcdef", c)
+		if d < 0 || d >= base {
+			return 0, false
+		}
+		value = value*base + d
+		if value > 0xFFFFFF {
+			return 0, false
+		}
+	}
+	if negative {
+		value = -value
+	}
+	return value, true
+}
+
+// register parses v0-vf
+func register(text string) (int, bool) {
+	if len(text) != 2 || (text[0] != 'v' && text[0] != 'V') {
+		return 0, false
+	}
+	reg := strings.IndexByte("0123456789abcdef", strings.ToLower(text)[1])
+	return reg, reg >= 0
+}
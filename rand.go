@@ -1,16 +0,0 @@
-package main
-
-type rand struct {
-	x, y, z, w uint32
-}
-
-func (r *rand) next() uint32 {
-	// math/rand is too slow to keep 60 FPS on web browsers.
-	// Use Xorshift instead: http://en.wikipedia.org/wiki/Xorshift
-	t := r.x ^ (r.x << 11)
-	r.x, r.y, r.z = r.y, r.z, r.w
-	r.w = (r.w ^ (r.w >> 19)) ^ (t ^ (t >> 8))
-	return r.w
-}
-
-var theRand = &rand{12345678, 4185243, 776511, 45411}
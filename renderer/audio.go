@@ -0,0 +1,44 @@
+package renderer
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/pthm/gate/audio"
+)
+
+const (
+	audioStreamFrames = 512 // Samples raylib asks for at a time, small enough to keep the latency down
+	audioLatency      = 10  // Most the sound can lag behind the picture, in 60Hz frames
+)
+
+// RaylibAudio plays the machine's sound through a raylib audio stream, it is a cpu.AudioSink. Raylib pulls samples
+// from its own thread, so they are queued in a buffer in between
+type RaylibAudio struct {
+	*audio.Buffer
+	stream     rl.AudioStream
+	sampleRate int
+}
+
+// OpenAudio opens the audio device and starts a stream at sampleRate for the machine's sound, it must be called
+// before the renderer is set as the CPU's host and is closed along with the window
+func (r *RaylibRenderer) OpenAudio(sampleRate int) *RaylibAudio {
+	rl.InitAudioDevice()
+	rl.SetAudioStreamBufferSizeDefault(audioStreamFrames)
+
+	a := &RaylibAudio{
+		Buffer:     audio.NewBuffer(sampleRate * audioLatency / 60),
+		stream:     rl.LoadAudioStream(uint32(sampleRate), 32, 1),
+		sampleRate: sampleRate,
+	}
+	rl.SetAudioStreamCallback(a.stream, func(data []float32, frames int) {
+		a.Read(data[:frames])
+	})
+	rl.PlayAudioStream(a.stream)
+	r.audio = a
+	return a
+}
+
+func (a *RaylibAudio) close() {
+	rl.StopAudioStream(a.stream)
+	rl.UnloadAudioStream(a.stream)
+	rl.CloseAudioDevice()
+}
@@ -1,66 +1,273 @@
 package renderer
 
 import (
+	"context"
 	"fmt"
 	rl "github.com/gen2brain/raylib-go/raylib"
+	"github.com/pthm/gate/cpu"
+	"image/color"
 	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// DefaultKeyMap maps the CHIP-8 hex keypad onto the left hand side of a QWERTY keyboard
+//
+//	1 2 3 C        1 2 3 4
+//	4 5 6 D   ->   Q W E R
+//	7 8 9 E        A S D F
+//	A 0 B F        Z X C V
+var DefaultKeyMap = [16]int32{
+	rl.KeyX,     // 0
+	rl.KeyOne,   // 1
+	rl.KeyTwo,   // 2
+	rl.KeyThree, // 3
+	rl.KeyQ,     // 4
+	rl.KeyW,     // 5
+	rl.KeyE,     // 6
+	rl.KeyA,     // 7
+	rl.KeyS,     // 8
+	rl.KeyD,     // 9
+	rl.KeyZ,     // A
+	rl.KeyC,     // B
+	rl.KeyFour,  // C
+	rl.KeyR,     // D
+	rl.KeyF,     // E
+	rl.KeyV,     // F
+}
+
+// DefaultPalette colours the pixels by plane: off, plane 1, plane 2, and both planes
+var DefaultPalette = [4]color.RGBA{
+	rl.Black,
+	rl.White,
+	rl.NewColor(0xAA, 0xAA, 0xAA, 0xFF),
+	rl.NewColor(0x55, 0x55, 0x55, 0xFF),
+}
+
+// ParsePalette parses four comma separated hex colours (e.g. "000000,ffffff,aaaaaa,555555") into a palette
+func ParsePalette(s string) ([4]color.RGBA, error) {
+	var palette [4]color.RGBA
+
+	parts := strings.Split(s, ",")
+	if len(parts) != len(palette) {
+		return palette, fmt.Errorf("palette must have %d colours, got %d", len(palette), len(parts))
+	}
+	for i, part := range parts {
+		part = strings.TrimPrefix(strings.TrimSpace(part), "#")
+		rgb, err := strconv.ParseUint(part, 16, 32)
+		if err != nil || len(part) != 6 {
+			return palette, fmt.Errorf("invalid colour %q, must be 6 hex digits", part)
+		}
+		palette[i] = rl.NewColor(uint8(rgb>>16), uint8(rgb>>8), uint8(rgb), 0xFF)
+	}
+	return palette, nil
+}
+
+// Hotkeys are frontend actions bound to keys outside the keypad, nil actions are ignored
+type Hotkeys struct {
+	SaveState func(slot int)  // Shift+F1 to Shift+F9
+	LoadState func(slot int)  // F1 to F9
+	Rewind    func(held bool) // Backspace, called when it is pressed and again when it is released
+	Reset     func()          // F10
+	Reload    func()          // F11, reloads the ROM from disk
+}
+
+// messageDuration is how long messages from ShowMessage stay on screen
+const messageDuration = 2 * time.Second
+
+// RaylibRenderer is a cpu.Host that runs the machine in a raylib window. Raylib has to be driven from the main
+// goroutine, so Run draws the window there while the machine runs on a goroutine of its own
 type RaylibRenderer struct {
-	gfx          [64][32]uint8
-	scaleFactorX int32
-	scaleFactorY int32
+	frames  *cpu.TripleBuffer // Present publishes frames from the machine's goroutine, Run draws the latest
+	stats   cpu.FrameStats    // Only used by Run
+	width   int32
+	height  int32
+	palette [4]color.RGBA
+
+	keyMap  [16]int32
+	keyLock sync.Mutex // The keys are polled by Run and read by the machine's goroutine
+	keys    [16]bool
+	hotkeys Hotkeys
+
+	clock  cpu.RealTime
+	closed atomic.Bool // Set once the window has been closed
+	quit   atomic.Bool // Set by Quit to close the window from another goroutine
+
+	messageLock  sync.Mutex // ShowMessage can be called from other goroutines, e.g. the ROM watcher
+	message      string
+	messageUntil time.Time
+	rewinding    bool
+
+	audio *RaylibAudio // Set by OpenAudio
 }
 
 func NewRaylibRenderer(width, height int32) *RaylibRenderer {
 	rl.InitWindow(width, height, "gate - chip8 emulator")
 	rl.SetTargetFPS(60)
 
-	scaleFactorX := math.Floor(float64(width) / 64.0)
-	scaleFactorY := math.Floor(float64(height) / 32.0)
-
 	return &RaylibRenderer{
-		gfx:          [64][32]uint8{},
-		scaleFactorX: int32(scaleFactorX),
-		scaleFactorY: int32(scaleFactorY),
+		frames:  cpu.NewTripleBuffer(),
+		width:   width,
+		height:  height,
+		palette: DefaultPalette,
+		keyMap:  DefaultKeyMap,
+	}
+}
+
+// SetPalette sets the colours used for each combination of planes
+func (r *RaylibRenderer) SetPalette(palette [4]color.RGBA) {
+	r.palette = palette
+}
+
+// SetKeyMap overrides the default keyboard layout, index is the CHIP-8 key
+func (r *RaylibRenderer) SetKeyMap(keyMap [16]int32) {
+	r.keyMap = keyMap
+}
+
+// SetHotkeys sets the actions bound to the frontend hotkeys
+func (r *RaylibRenderer) SetHotkeys(hotkeys Hotkeys) {
+	r.hotkeys = hotkeys
+}
+
+// ShowMessage displays msg over the game for a couple of seconds
+func (r *RaylibRenderer) ShowMessage(msg string) {
+	r.messageLock.Lock()
+	defer r.messageLock.Unlock()
+	r.message = msg
+	r.messageUntil = time.Now().Add(messageDuration)
+}
+
+func (r *RaylibRenderer) pollHotkeys() {
+	shift := rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift)
+	for slot := 1; slot <= 9; slot++ {
+		if !rl.IsKeyPressed(rl.KeyF1 + int32(slot-1)) {
+			continue
+		}
+		if shift && r.hotkeys.SaveState != nil {
+			r.hotkeys.SaveState(slot)
+		} else if !shift && r.hotkeys.LoadState != nil {
+			r.hotkeys.LoadState(slot)
+		}
+	}
+
+	if r.hotkeys.Reset != nil && rl.IsKeyPressed(rl.KeyF10) {
+		r.hotkeys.Reset()
+	}
+	if r.hotkeys.Reload != nil && rl.IsKeyPressed(rl.KeyF11) {
+		r.hotkeys.Reload()
+	}
+
+	if r.hotkeys.Rewind != nil {
+		if rl.IsKeyPressed(rl.KeyBackspace) {
+			r.rewinding = true
+			r.hotkeys.Rewind(true)
+		} else if rl.IsKeyReleased(rl.KeyBackspace) {
+			r.rewinding = false
+			r.hotkeys.Rewind(false)
+		}
 	}
 }
 
+// pollKeys reads the keyboard for PollInput, raylib can only be asked from the main goroutine
+func (r *RaylibRenderer) pollKeys() {
+	r.keyLock.Lock()
+	defer r.keyLock.Unlock()
+	for k, key := range r.keyMap {
+		r.keys[k] = rl.IsKeyDown(key)
+	}
+}
+
+// PollInput copies the keypad as it was when the window last drew
+func (r *RaylibRenderer) PollInput(keys *[16]bool) {
+	r.keyLock.Lock()
+	defer r.keyLock.Unlock()
+	*keys = r.keys
+}
+
+// WaitFrame paces the machine at 60Hz until the window is closed
+func (r *RaylibRenderer) WaitFrame(ctx context.Context) bool {
+	if r.closed.Load() {
+		return false
+	}
+	return r.clock.WaitFrame(ctx)
+}
+
+// Audio returns the stream opened by OpenAudio, if any
+func (r *RaylibRenderer) Audio() (cpu.AudioSink, int) {
+	if r.audio == nil {
+		return nil, 0
+	}
+	return r.audio, r.audio.sampleRate
+}
+
+// Run draws the window until it is closed, it must be called from the main goroutine
 func (r *RaylibRenderer) Run() {
-	for !rl.WindowShouldClose() {
+	defer r.closed.Store(true)
+	for !rl.WindowShouldClose() && !r.quit.Load() {
 		fps := rl.GetFPS()
 
+		r.pollKeys()
+		r.pollHotkeys()
+
+		frame, seq, fresh := r.frames.Latest()
+		r.stats.See(seq, fresh)
+
 		rl.BeginDrawing()
 
-		for y := 0; y < 32; y++ {
-			for x := 0; x < 64; x++ {
-				pixel := r.gfx[x][y]
+		// The resolution can change from frame to frame, so work out the scale each time
+		scaleFactorX := int32(math.Floor(float64(r.width) / float64(frame.Width)))
+		scaleFactorY := int32(math.Floor(float64(r.height) / float64(frame.Height)))
+
+		for y := 0; y < frame.Height; y++ {
+			for x := 0; x < frame.Width; x++ {
+				pixel := frame.Pixels[x][y]
 
-				posX := int32(x) * r.scaleFactorX
-				posY := int32(y) * r.scaleFactorY
+				posX := int32(x) * scaleFactorX
+				posY := int32(y) * scaleFactorY
 
-				width := r.scaleFactorX
-				height := r.scaleFactorY
+				width := scaleFactorX
+				height := scaleFactorY
 
-				if pixel == 0 {
-					rl.DrawRectangle(posX, posY, width, height, rl.Black)
-				} else {
-					rl.DrawRectangle(posX, posY, width, height, rl.White)
-				}
+				rl.DrawRectangle(posX, posY, width, height, r.palette[pixel&0x3])
 			}
 		}
 
-		rl.DrawText(fmt.Sprintf("FPS: %d", fps), 10, 10, 10, rl.LightGray)
+		rl.DrawText(fmt.Sprintf("FPS: %d  Dropped: %d", fps, r.stats.Dropped), 10, 10, 10, rl.LightGray)
+		if r.rewinding {
+			rl.DrawText("<< Rewind", r.width-110, 10, 20, rl.Yellow)
+		}
+		r.messageLock.Lock()
+		if time.Now().Before(r.messageUntil) {
+			rl.DrawText(r.message, 10, r.height-30, 20, rl.Yellow)
+		}
+		r.messageLock.Unlock()
 
 		rl.EndDrawing()
 	}
 }
 
-func (r *RaylibRenderer) Render(gfx [64][32]uint8) error {
-	r.gfx = gfx
+// Quit makes Run return once it has drawn the current frame, it is safe to call from any goroutine
+func (r *RaylibRenderer) Quit() {
+	r.quit.Store(true)
+}
+
+// Present shows frame from the next time the window draws, it is safe to call while Run is drawing
+func (r *RaylibRenderer) Present(frame cpu.Frame) error {
+	r.frames.Publish(&frame)
 	return nil
 }
 
+// Stats counts the frames the window has drawn, it must be called from the goroutine that called Run
+func (r *RaylibRenderer) Stats() cpu.FrameStats {
+	return r.stats
+}
+
 func (r *RaylibRenderer) Close() {
+	if r.audio != nil {
+		r.audio.close()
+	}
 	rl.CloseWindow()
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pthm/gate/asm"
+	"github.com/pthm/gate/octo"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadProgram reads the ROM at path along with any symbols. Octo (.8o) and assembly (.asm) sources are compiled, so
+// they can be run directly, and a ROM's symbols are read from the .sym file gate asm writes beside it
+func loadProgram(path string) (*asm.Output, error) {
+	var out *asm.Output
+	var err error
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".8o":
+		out, err = octo.CompileFile(path)
+	case ".asm":
+		out, err = asm.AssembleFile(path)
+	default:
+		return loadROM(path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not compile (%s): %w", path, err)
+	}
+	return out, nil
+}
+
+func loadROM(path string) (*asm.Output, error) {
+	romBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read ROM file at (%s): %w", path, err)
+	}
+	out := &asm.Output{Origin: asm.DefaultOrigin, Binary: romBytes, Labels: map[string]uint16{}}
+
+	// The symbol file is EQU definitions, so the assembler reads it
+	symPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".sym"
+	if _, err := os.Stat(symPath); err != nil {
+		return out, nil
+	}
+	symbols, err := asm.AssembleFile(symPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read symbols (%s): %w", symPath, err)
+	}
+	for name, value := range symbols.Constants {
+		out.Labels[name] = uint16(value)
+	}
+	return out, nil
+}
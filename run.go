@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/pthm/gate/cpu"
+	"github.com/pthm/gate/renderer"
+	"strings"
+)
+
+// machineFlags are the flags shared by every command that runs a ROM
+type machineFlags struct {
+	quirks   *string
+	hz       *int
+	ipf      *int
+	rewindMB *int
+	watch    *bool
+	palette  *string
+	seed     *uint64
+	waveform *string
+	pitch    *float64
+	volume   *float64
+}
+
+// sampleRate is the rate sound is generated at, for the window and WAV files alike
+const sampleRate = 44100
+
+func addMachineFlags(flags *flag.FlagSet) *machineFlags {
+	return &machineFlags{
+		quirks:   flags.String("quirks", "vip", "quirks profile, one of: "+strings.Join(cpu.QuirkPresetNames(), ", ")),
+		hz:       flags.Int("hz", cpu.DefaultClockSpeed, "instructions executed per second"),
+		ipf:      flags.Int("ipf", 0, "instructions executed per frame, overrides -hz when set"),
+		rewindMB: flags.Int("rewind-mb", cpu.DefaultRewindBudget>>20, "memory budget for rewinding in megabytes, 0 disables rewinding"),
+		watch:    flags.Bool("watch", false, "reload the ROM whenever the file changes"),
+		palette:  flags.String("palette", "000000,ffffff,aaaaaa,555555", "colours for blank, plane 1, plane 2 and both planes"),
+		seed:     flags.Uint64("seed", 0, "seed for the random number generator so runs are repeatable, 0 picks one at random"),
+		waveform: flags.String("tone", cpu.DefaultTone.Waveform.String(), "buzzer waveform, square, sine, triangle or sawtooth"),
+		pitch:    flags.Float64("tone-hz", cpu.DefaultTone.Frequency, "buzzer frequency in Hz"),
+		volume:   flags.Float64("volume", cpu.DefaultTone.Volume, "buzzer volume from 0 to 1, 0 turns the sound off"),
+	}
+}
+
+// emptyCPU creates a CPU configured by the flags, without a ROM
+func (m *machineFlags) emptyCPU() (*cpu.CPU, error) {
+	quirks, err := cpu.ParseQuirks(*m.quirks)
+	if err != nil {
+		return nil, err
+	}
+	clock := cpu.WithClockSpeed(*m.hz)
+	if *m.ipf > 0 {
+		clock = cpu.WithInstructionsPerFrame(*m.ipf)
+	}
+	tone, err := m.tone()
+	if err != nil {
+		return nil, err
+	}
+	opts := []cpu.Option{clock, cpu.WithRewind(*m.rewindMB << 20), cpu.WithTone(tone)}
+	if *m.seed != 0 {
+		opts = append(opts, cpu.WithSeed(*m.seed))
+	}
+	return cpu.NewCPU(quirks, opts...), nil
+}
+
+// tone returns the buzzer's tone
+func (m *machineFlags) tone() (cpu.Tone, error) {
+	waveform, err := cpu.ParseWaveform(*m.waveform)
+	if err != nil {
+		return cpu.Tone{}, err
+	}
+	// Written so NaN fails the checks too
+	if !(*m.volume >= 0 && *m.volume <= 1) {
+		return cpu.Tone{}, fmt.Errorf("volume must be from 0 to 1, was %g", *m.volume)
+	}
+	// At or above half the sample rate the tone aliases
+	if !(*m.pitch > 0 && *m.pitch < sampleRate/2) {
+		return cpu.Tone{}, fmt.Errorf("tone frequency must be above 0 and below %d Hz, was %g", sampleRate/2, *m.pitch)
+	}
+	return cpu.Tone{Waveform: waveform, Frequency: *m.pitch, Volume: *m.volume}, nil
+}
+
+// newCPU creates a CPU configured by the flags and loads the ROM at romPath into it
+func (m *machineFlags) newCPU(romPath string) (*cpu.CPU, error) {
+	chip8, err := m.emptyCPU()
+	if err != nil {
+		return nil, err
+	}
+	if err := loadProgramInto(chip8, romPath); err != nil {
+		return nil, err
+	}
+	return chip8, nil
+}
+
+// loadProgramInto loads the ROM or source at romPath into chip8
+func loadProgramInto(chip8 *cpu.CPU, romPath string) error {
+	if romPath == "" {
+		return errors.New("must supply a path to a ROM")
+	}
+
+	program, err := loadProgram(romPath)
+	if err != nil {
+		return err
+	}
+	return chip8.LoadROM(program.Binary)
+}
+
+// runCommand runs a ROM in a raylib window
+func runCommand(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gate run [flags] rom.ch8|game.8o|source.asm")
+		flags.PrintDefaults()
+	}
+	machine := addMachineFlags(flags)
+	tracing := addTraceFlags(flags)
+	noWindow := addHeadlessFlags(flags)
+	movies := addMovieFlags(flags)
+
+	flags.Parse(args)
+	romPath := flags.Arg(0)
+
+	chip8, err := movies.newCPU(machine, romPath)
+	if err != nil {
+		return err
+	}
+	stopTrace, err := tracing.start(chip8)
+	if err != nil {
+		return err
+	}
+	stopMovie := movies.start(chip8, machine, noWindow)
+
+	run := func() error { return runWindow(context.Background(), chip8, romPath, machine) }
+	if *noWindow.enabled {
+		run = func() error { return noWindow.run(chip8, machine) }
+	}
+	err = run()
+	if movieErr := stopMovie(); err == nil {
+		err = movieErr
+	}
+	if traceErr := stopTrace(); err == nil {
+		err = traceErr
+	}
+	return err
+}
+
+// openWindow creates a raylib window and makes it chip8's host, showing its display, playing its sound and feeding it
+// the keypad
+func openWindow(chip8 *cpu.CPU, machine *machineFlags) (*renderer.RaylibRenderer, error) {
+	palette, err := renderer.ParsePalette(*machine.palette)
+	if err != nil {
+		return nil, err
+	}
+
+	rlRenderer := renderer.NewRaylibRenderer(64*16, 32*16)
+	rlRenderer.SetPalette(palette)
+	if *machine.volume > 0 {
+		rlRenderer.OpenAudio(sampleRate)
+	}
+	chip8.SetHost(rlRenderer)
+	return rlRenderer, nil
+}
+
+// runWindow runs chip8 in a raylib window until the window is closed or ctx is cancelled. The window has to be driven
+// from the main goroutine, so the CPU runs on its own goroutine
+func runWindow(ctx context.Context, chip8 *cpu.CPU, romPath string, machine *machineFlags) error {
+	rlRenderer, err := openWindow(chip8, machine)
+	if err != nil {
+		return err
+	}
+	rlRenderer.SetHotkeys(renderer.Hotkeys{
+		SaveState: func(slot int) {
+			if err := saveStateSlot(chip8, romPath, slot); err != nil {
+				fmt.Println(err)
+				rlRenderer.ShowMessage(fmt.Sprintf("Could not save slot %d", slot))
+				return
+			}
+			rlRenderer.ShowMessage(fmt.Sprintf("Saved slot %d", slot))
+		},
+		LoadState: func(slot int) {
+			if err := loadStateSlot(chip8, romPath, slot); err != nil {
+				fmt.Println(err)
+				rlRenderer.ShowMessage(fmt.Sprintf("Could not load slot %d", slot))
+				return
+			}
+			rlRenderer.ShowMessage(fmt.Sprintf("Loaded slot %d", slot))
+		},
+		Rewind: chip8.SetRewinding,
+		Reset: func() {
+			chip8.Reset()
+			rlRenderer.ShowMessage("Reset")
+		},
+		Reload: func() {
+			if err := reloadROM(chip8, romPath); err != nil {
+				fmt.Println(err)
+				rlRenderer.ShowMessage("Could not reload ROM")
+				return
+			}
+			rlRenderer.ShowMessage("Reloaded ROM")
+		},
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		rlRenderer.Quit()
+	}()
+
+	if *machine.watch {
+		go watchFile(ctx, romPath, func() {
+			if err := reloadROM(chip8, romPath); err != nil {
+				fmt.Println(err)
+				rlRenderer.ShowMessage("Could not reload ROM")
+				return
+			}
+			rlRenderer.ShowMessage("ROM changed, reloaded")
+		})
+	}
+
+	go chip8.Run(ctx)
+	rlRenderer.Run()
+
+	defer rlRenderer.Close()
+	return nil
+}
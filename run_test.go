@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func Test_machineFlagsTone(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{nil, true},
+		{[]string{"-tone", "sine", "-tone-hz", "880", "-volume", "1"}, true},
+		{[]string{"-tone", "noise"}, false},
+		{[]string{"-volume", "1.5"}, false},
+		{[]string{"-volume", "NaN"}, false},
+		{[]string{"-tone-hz", "0"}, false},
+		{[]string{"-tone-hz", "-440"}, false},
+		{[]string{"-tone-hz", "NaN"}, false},
+		{[]string{"-tone-hz", "+Inf"}, false},
+		{[]string{"-tone-hz", "22050"}, false},
+	}
+	for _, test := range tests {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		machine := addMachineFlags(flags)
+		if err := flags.Parse(test.args); err != nil {
+			t.Fatalf("could not parse %v: %v\n", test.args, err)
+		}
+		if _, err := machine.tone(); (err == nil) != test.ok {
+			t.Fatalf("tone with %v should succeed: %v, got error %v\n", test.args, test.ok, err)
+		}
+	}
+}
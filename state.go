@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pthm/gate/cpu"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// statePath returns where save state slot is stored, next to the ROM (e.g. roms/ibm.ch8 slot 1 is roms/ibm.1.state)
+func statePath(romPath string, slot int) string {
+	base := strings.TrimSuffix(romPath, filepath.Ext(romPath))
+	return fmt.Sprintf("%s.%d.state", base, slot)
+}
+
+func saveStateSlot(chip8 *cpu.CPU, romPath string, slot int) error {
+	var buf bytes.Buffer
+	if err := chip8.SaveState(&buf); err != nil {
+		return fmt.Errorf("could not save state: %w", err)
+	}
+
+	path := statePath(romPath, slot)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("could not write save state (%s): %w", path, err)
+	}
+	return nil
+}
+
+func loadStateSlot(chip8 *cpu.CPU, romPath string, slot int) error {
+	path := statePath(romPath, slot)
+	state, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read save state (%s): %w", path, err)
+	}
+
+	if err := chip8.LoadState(bytes.NewReader(state)); err != nil {
+		return fmt.Errorf("could not load save state (%s): %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pthm/gate/cpu"
+	"github.com/pthm/gate/disasm"
+	"github.com/pthm/gate/trace"
+	"io"
+	"os"
+)
+
+// traceFlags configure tracing executed instructions to a file
+type traceFlags struct {
+	path   *string
+	format *string
+	pcs    *string
+	ops    *string
+}
+
+func addTraceFlags(flags *flag.FlagSet) *traceFlags {
+	return &traceFlags{
+		path:   flags.String("trace", "", "trace every executed instruction to a file, - for stdout"),
+		format: flags.String("trace-format", "text", "trace format, text, jsonl or binary"),
+		pcs:    flags.String("trace-range", "", "only trace instructions at addresses in a range, e.g. 0x200-0x2FF"),
+		ops:    flags.String("trace-ops", "", "only trace opcode classes, by first hex digit, e.g. 8,D"),
+	}
+}
+
+// start traces chip8 as the flags say, returning a function that stops tracing and flushes the trace. It does
+// nothing when -trace isn't set
+func (t *traceFlags) start(chip8 *cpu.CPU) (stop func() error, err error) {
+	if *t.path == "" {
+		return func() error { return nil }, nil
+	}
+
+	format, err := trace.ParseFormat(*t.format)
+	if err != nil {
+		return nil, err
+	}
+	var filter trace.Filter
+	if *t.pcs != "" {
+		if filter.From, filter.To, err = trace.ParseRange(*t.pcs); err != nil {
+			return nil, err
+		}
+	}
+	if *t.ops != "" {
+		if filter.Classes, err = trace.ParseClasses(*t.ops); err != nil {
+			return nil, err
+		}
+	}
+
+	var out io.WriteCloser = os.Stdout
+	if *t.path != "-" {
+		out, err = os.Create(*t.path)
+		if err != nil {
+			return nil, fmt.Errorf("could not create trace (%s): %w", *t.path, err)
+		}
+	}
+
+	w := trace.NewWriter(out, format, disasm.Octo)
+	chip8.SetTracer(trace.Filtered(w, filter))
+	return func() error {
+		chip8.SetTracer(nil)
+		err := w.Flush()
+		if out != os.Stdout {
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,227 @@
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pthm/gate/cpu"
+	"github.com/pthm/gate/disasm"
+)
+
+// historyLength is how many instructions before a divergence are kept for context
+const historyLength = 8
+
+// State is the machine state replayed from a trace, as much of it as the trace reveals
+type State struct {
+	Registers [cpu.NumRegisters]uint16
+	Memory    map[uint16]uint8 // Every byte written so far
+}
+
+func newState() State {
+	s := State{Memory: map[uint16]uint8{}}
+	s.Registers[cpu.RegPC] = 0x200
+	return s
+}
+
+func (s *State) apply(entry *cpu.TraceEntry) {
+	s.Registers[cpu.RegPC] = entry.PC
+	for _, r := range entry.Registers {
+		s.Registers[r.Register] = r.New
+	}
+	for _, m := range entry.Memory {
+		s.Memory[m.Addr] = m.New
+	}
+}
+
+// Divergence is the first instruction two traces disagree on
+type Divergence struct {
+	Cycle   uint64
+	A, B    *cpu.TraceEntry // The diverging entries, nil for a trace that ended or skipped the cycle
+	Reason  string
+	Before  [2]State         // State of each machine before the diverging instruction
+	History []cpu.TraceEntry // The instructions leading up to it, which both traces agree on, oldest first
+}
+
+// Diff aligns two traces by cycle and finds the first instruction where they differ, returning nil if they agree.
+// Entries agree when they execute the same instruction at the same PC and make the same changes
+func Diff(a, b *Reader) (*Divergence, error) {
+	states := [2]State{newState(), newState()}
+	var history []cpu.TraceEntry
+
+	ea, err := next(a)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := next(b)
+	if err != nil {
+		return nil, err
+	}
+
+	for ea != nil || eb != nil {
+		d := &Divergence{A: ea, B: eb}
+		switch {
+		case eb == nil:
+			d.Cycle, d.Reason = ea.Cycle, "the second trace ends"
+		case ea == nil:
+			d.Cycle, d.Reason = eb.Cycle, "the first trace ends"
+		case ea.Cycle < eb.Cycle:
+			d.Cycle, d.B, d.Reason = ea.Cycle, nil, "the second trace skips the cycle"
+		case eb.Cycle < ea.Cycle:
+			d.Cycle, d.A, d.Reason = eb.Cycle, nil, "the first trace skips the cycle"
+		default:
+			d.Cycle, d.Reason = ea.Cycle, compare(ea, eb)
+		}
+		if d.Reason != "" {
+			d.Before = states
+			d.History = history
+			if d.A != nil {
+				d.Before[0].Registers[cpu.RegPC] = d.A.PC
+			}
+			if d.B != nil {
+				d.Before[1].Registers[cpu.RegPC] = d.B.PC
+			}
+			return d, nil
+		}
+
+		states[0].apply(ea)
+		states[1].apply(eb)
+		history = append(history, copyEntry(ea))
+		if len(history) > historyLength {
+			history = history[1:]
+		}
+
+		if ea, err = next(a); err != nil {
+			return nil, err
+		}
+		if eb, err = next(b); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// next reads the next entry, which is nil at the end of the trace
+func next(r *Reader) (*cpu.TraceEntry, error) {
+	entry, err := r.Next()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	return entry, err
+}
+
+func copyEntry(entry *cpu.TraceEntry) cpu.TraceEntry {
+	e := *entry
+	e.Registers = append([]cpu.RegisterChange(nil), entry.Registers...)
+	e.Memory = append([]cpu.MemoryChange(nil), entry.Memory...)
+	return e
+}
+
+// compare describes how two entries for the same cycle differ, or returns "" if they agree
+func compare(a, b *cpu.TraceEntry) string {
+	if a.PC != b.PC {
+		return fmt.Sprintf("PC is 0x%04X in the first trace and 0x%04X in the second", a.PC, b.PC)
+	}
+	if a.Opcode != b.Opcode || a.Long != b.Long {
+		return fmt.Sprintf("the opcode is %04X in the first trace and %04X in the second", a.Opcode, b.Opcode)
+	}
+
+	var changedA, changedB [cpu.NumRegisters]*cpu.RegisterChange
+	for n := range a.Registers {
+		changedA[a.Registers[n].Register] = &a.Registers[n]
+	}
+	for n := range b.Registers {
+		changedB[b.Registers[n].Register] = &b.Registers[n]
+	}
+	for r := cpu.RegV0; r < cpu.NumRegisters; r++ {
+		ra, rb := changedA[r], changedB[r]
+		switch {
+		case ra == nil && rb == nil:
+		case ra == nil:
+			return fmt.Sprintf("%s is left alone in the first trace and set to 0x%X in the second", r, rb.New)
+		case rb == nil:
+			return fmt.Sprintf("%s is set to 0x%X in the first trace and left alone in the second", r, ra.New)
+		case ra.New != rb.New:
+			return fmt.Sprintf("%s is set to 0x%X in the first trace and 0x%X in the second", r, ra.New, rb.New)
+		}
+	}
+
+	for n := 0; n < max(len(a.Memory), len(b.Memory)); n++ {
+		switch {
+		case n >= len(a.Memory):
+			return fmt.Sprintf("only the second trace writes 0x%04X", b.Memory[n].Addr)
+		case n >= len(b.Memory):
+			return fmt.Sprintf("only the first trace writes 0x%04X", a.Memory[n].Addr)
+		case a.Memory[n].Addr != b.Memory[n].Addr:
+			return fmt.Sprintf("the first trace writes 0x%04X where the second writes 0x%04X", a.Memory[n].Addr, b.Memory[n].Addr)
+		case a.Memory[n].New != b.Memory[n].New:
+			return fmt.Sprintf("0x%04X is set to 0x%02X in the first trace and 0x%02X in the second", a.Memory[n].Addr, a.Memory[n].New, b.Memory[n].New)
+		}
+	}
+	return ""
+}
+
+// Write reports the divergence with the instructions leading up to it and the state of both machines before it.
+// names are the names of the two traces
+func (d *Divergence) Write(w io.Writer, names [2]string, syntax disasm.Syntax) {
+	width := max(len(names[0]), len(names[1]), 4)
+
+	fmt.Fprintf(w, "Traces diverge at cycle %d: %s\n", d.Cycle, d.Reason)
+	if len(d.History) > 0 {
+		fmt.Fprintf(w, "\nLeading up to it:\n")
+		for n := range d.History {
+			fmt.Fprintf(w, "  %*s  %s\n", width, "", FormatText(&d.History[n], syntax))
+		}
+	}
+
+	fmt.Fprintf(w, "\nDiverging instruction:\n")
+	for n, entry := range [2]*cpu.TraceEntry{d.A, d.B} {
+		if entry == nil {
+			fmt.Fprintf(w, "  %*s  (none)\n", width, names[n])
+			continue
+		}
+		fmt.Fprintf(w, "  %*s  %s\n", width, names[n], FormatText(entry, syntax))
+	}
+
+	fmt.Fprintf(w, "\nRegisters before it:\n")
+	fmt.Fprintf(w, "      %*s  %*s\n", width, names[0], width, names[1])
+	for r := cpu.RegV0; r < cpu.NumRegisters; r++ {
+		a, b := d.Before[0].Registers[r], d.Before[1].Registers[r]
+		mark := ""
+		if a != b {
+			mark = "  *"
+		}
+		fmt.Fprintf(w, "  %-2s  %*s  %*s%s\n", r, width, formatRegister(r, a), width, formatRegister(r, b), mark)
+	}
+
+	// Memory neither trace wrote is whatever the ROM put there, which the traces don't record
+	var addrs []uint16
+	for addr, a := range d.Before[0].Memory {
+		if b, ok := d.Before[1].Memory[addr]; !ok || a != b {
+			addrs = append(addrs, addr)
+		}
+	}
+	for addr := range d.Before[1].Memory {
+		if _, ok := d.Before[0].Memory[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+	fmt.Fprintf(w, "\nMemory written differently before it:\n")
+	if len(addrs) == 0 {
+		fmt.Fprintf(w, "  (none)\n")
+	}
+	for _, addr := range addrs {
+		fmt.Fprintf(w, "  %04X  %*s  %*s\n", addr, width, memoryByte(d.Before[0], addr), width, memoryByte(d.Before[1], addr))
+	}
+}
+
+// memoryByte formats a byte of replayed memory, or -- if the trace never wrote it
+func memoryByte(s State, addr uint16) string {
+	if value, ok := s.Memory[addr]; ok {
+		return fmt.Sprintf("%02X", value)
+	}
+	return "--"
+}
@@ -0,0 +1,99 @@
+package trace
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pthm/gate/cpu"
+	"github.com/pthm/gate/disasm"
+)
+
+// shiftROM shifts VY into VX on the VIP but shifts VX in place on the SCHIP
+var shiftROM = []uint8{
+	0x60, 0x04, // V0 := 4
+	0x61, 0x03, // V1 := 3
+	0xA3, 0x00, // I := 0x300
+	0x80, 0x16, // V0 >>= V1
+	0xF0, 0x55, // save V0
+	0x12, 0x0A, // jump 0x20A
+}
+
+// record runs a frame of shiftROM and returns its trace
+func record(t *testing.T, quirks cpu.Quirks, format Format) *Reader {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, format, disasm.Octo)
+
+	chip8 := cpu.NewCPU(quirks, cpu.WithInstructionsPerFrame(8))
+	chip8.LoadROM(shiftROM)
+	chip8.SetTracer(w)
+	chip8.RunFrame()
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	return r
+}
+
+func Test_readBack(t *testing.T) {
+	for _, format := range []Format{JSON, Binary} {
+		r := record(t, cpu.QuirksVIP, format)
+		var got []cpu.TraceEntry
+		for {
+			entry, err := next(r)
+			if err != nil {
+				t.Fatalf("unexpected error: %v\n", err)
+			}
+			if entry == nil {
+				break
+			}
+			got = append(got, copyEntry(entry))
+		}
+
+		if len(got) != 8 {
+			t.Fatalf("should read back every entry, read %d\n", len(got))
+		}
+		e := got[4]
+		if e.PC != 0x208 || e.Opcode != 0xF055 || len(e.Memory) != 1 || e.Memory[0] != (cpu.MemoryChange{Addr: 0x300, Old: 0, New: 1}) {
+			t.Fatalf("entry should read back as written, was %+v\n", e)
+		}
+	}
+
+	if _, err := NewReader(strings.NewReader("         0  0200  6004  v0 := 0x04")); err == nil {
+		t.Fatalf("text traces should not be readable\n")
+	}
+}
+
+func Test_diff(t *testing.T) {
+	d, err := Diff(record(t, cpu.QuirksVIP, JSON), record(t, cpu.QuirksVIP, Binary))
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if d != nil {
+		t.Fatalf("identical runs should not diverge, got %s\n", d.Reason)
+	}
+
+	d, err = Diff(record(t, cpu.QuirksVIP, JSON), record(t, cpu.QuirksSCHIP, Binary))
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	if d == nil || d.Cycle != 3 || d.A.PC != 0x206 {
+		t.Fatalf("should diverge at the shift, got %+v\n", d)
+	}
+	if d.Reason != "V0 is set to 0x1 in the first trace and 0x2 in the second" {
+		t.Fatalf("unexpected reason %q\n", d.Reason)
+	}
+	if len(d.History) != 3 || d.Before[0].Registers[cpu.RegI] != 0x300 || d.Before[1].Registers[cpu.RegV1] != 3 || d.Before[1].Registers[cpu.RegPC] != 0x206 {
+		t.Fatalf("should replay the state before the divergence\n")
+	}
+
+	var report bytes.Buffer
+	d.Write(&report, [2]string{"vip", "schip"}, disasm.Octo)
+	if !strings.Contains(report.String(), "v0 >>= v1") {
+		t.Fatalf("report should show the diverging instruction, got\n%s", report.String())
+	}
+}
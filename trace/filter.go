@@ -0,0 +1,77 @@
+package trace
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pthm/gate/cpu"
+)
+
+// Filter selects the entries to trace. The zero Filter selects everything
+type Filter struct {
+	From, To uint16 // Range of PCs to trace, inclusive. Ignored when both are zero
+	Classes  uint16 // Bitmask of opcode classes to trace, by the first hex digit of the opcode. Zero traces all
+}
+
+// Match reports whether the filter selects an entry
+func (f Filter) Match(entry *cpu.TraceEntry) bool {
+	if (f.From != 0 || f.To != 0) && (entry.PC < f.From || entry.PC > f.To) {
+		return false
+	}
+	return f.Classes == 0 || f.Classes&(1<<(entry.Opcode>>12)) != 0
+}
+
+// ParseRange parses a range of addresses written as from-to, e.g. 0x200-0x2FF
+func ParseRange(s string) (from, to uint16, err error) {
+	first, last, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("range %q should be written as from-to, e.g. 0x200-0x2FF", s)
+	}
+	f, err := strconv.ParseUint(strings.TrimSpace(first), 0, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid address %q", first)
+	}
+	t, err := strconv.ParseUint(strings.TrimSpace(last), 0, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid address %q", last)
+	}
+	if t < f {
+		return 0, 0, fmt.Errorf("range %q ends before it starts", s)
+	}
+	return uint16(f), uint16(t), nil
+}
+
+// ParseClasses parses a comma separated list of opcode classes, each the first hex digit of its opcodes, e.g. 8,D
+// selects the arithmetic and drawing instructions
+func ParseClasses(s string) (uint16, error) {
+	classes := uint16(0)
+	for _, class := range strings.Split(s, ",") {
+		n, err := strconv.ParseUint(strings.TrimSpace(class), 16, 4)
+		if err != nil {
+			return 0, fmt.Errorf("invalid opcode class %q, must be a hex digit", class)
+		}
+		classes |= 1 << n
+	}
+	return classes, nil
+}
+
+// filtered passes the entries a filter selects on to a tracer
+type filtered struct {
+	tracer cpu.Tracer
+	filter Filter
+}
+
+// Filtered returns a tracer that passes the entries filter selects on to tracer
+func Filtered(tracer cpu.Tracer, filter Filter) cpu.Tracer {
+	if filter == (Filter{}) {
+		return tracer
+	}
+	return &filtered{tracer: tracer, filter: filter}
+}
+
+func (f *filtered) Trace(entry *cpu.TraceEntry) {
+	if f.filter.Match(entry) {
+		f.tracer.Trace(entry)
+	}
+}
@@ -0,0 +1,139 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pthm/gate/cpu"
+)
+
+// Reader reads the entries of a JSON Lines or binary trace, text traces are for people and can't be read back
+type Reader struct {
+	r      *bufio.Reader
+	format Format
+	line   int
+	entry  cpu.TraceEntry
+}
+
+// NewReader creates a reader for r, telling the format from the start of the trace
+func NewReader(r io.Reader) (*Reader, error) {
+	tr := &Reader{r: bufio.NewReader(r)}
+
+	start, err := tr.r.Peek(len(binaryMagic))
+	if bytes.Equal(start, binaryMagic) {
+		tr.format = Binary
+		tr.r.Discard(len(binaryMagic))
+		return tr, nil
+	}
+	if len(start) > 0 && start[0] == '{' {
+		tr.format = JSON
+		return tr, nil
+	}
+	if len(start) == 0 && errors.Is(err, io.EOF) {
+		tr.format = JSON // An empty trace has no entries in any format
+		return tr, nil
+	}
+	return nil, errors.New("trace should be JSON Lines or binary, record it with -trace-format jsonl or binary")
+}
+
+// Next reads the next entry, returning io.EOF at the end of the trace. The entry is reused by the next call
+func (tr *Reader) Next() (*cpu.TraceEntry, error) {
+	if tr.format == Binary {
+		return tr.nextBinary()
+	}
+	return tr.nextJSON()
+}
+
+func (tr *Reader) nextJSON() (*cpu.TraceEntry, error) {
+	for {
+		line, err := tr.r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			tr.line++
+			continue // Blank lines between entries are harmless
+		}
+		tr.line++
+
+		var e jsonEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", tr.line, err)
+		}
+		entry := &tr.entry
+		*entry = cpu.TraceEntry{Cycle: e.Cycle, PC: e.PC, Opcode: e.Opcode, Long: e.Long}
+		for _, r := range e.Registers {
+			reg, err := cpu.ParseRegister(r.Register)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", tr.line, err)
+			}
+			entry.Registers = append(entry.Registers, cpu.RegisterChange{Register: reg, Old: r.Old, New: r.New})
+		}
+		for _, m := range e.Memory {
+			entry.Memory = append(entry.Memory, cpu.MemoryChange{Addr: m.Addr, Old: m.Old, New: m.New})
+		}
+		return entry, nil
+	}
+}
+
+func (tr *Reader) nextBinary() (*cpu.TraceEntry, error) {
+	cycle, err := binary.ReadUvarint(tr.r)
+	if err != nil {
+		return nil, err // io.EOF when the trace ends between entries
+	}
+
+	entry := &tr.entry
+	*entry = cpu.TraceEntry{Cycle: cycle, Registers: entry.Registers[:0], Memory: entry.Memory[:0]}
+	var word [2]byte
+	readWord := func() uint16 {
+		if err == nil {
+			_, err = io.ReadFull(tr.r, word[:])
+		}
+		return binary.BigEndian.Uint16(word[:])
+	}
+	readByte := func() byte {
+		if err != nil {
+			return 0
+		}
+		var b byte
+		b, err = tr.r.ReadByte()
+		return b
+	}
+
+	entry.PC = readWord()
+	entry.Opcode = readWord()
+	if entry.Opcode == 0xF000 {
+		entry.Long = readWord()
+	}
+	for n := int(readByte()); n > 0 && err == nil; n-- {
+		r := cpu.Register(readByte())
+		if r >= cpu.NumRegisters {
+			return nil, fmt.Errorf("cycle %d: unknown register %d", cycle, r)
+		}
+		entry.Registers = append(entry.Registers, cpu.RegisterChange{Register: r, Old: readWord(), New: readWord()})
+	}
+	if err != nil {
+		return nil, truncated(cycle, err)
+	}
+	n, err := binary.ReadUvarint(tr.r)
+	for ; n > 0 && err == nil; n-- {
+		entry.Memory = append(entry.Memory, cpu.MemoryChange{Addr: readWord(), Old: readByte(), New: readByte()})
+	}
+	if err != nil {
+		return nil, truncated(cycle, err)
+	}
+	return entry, nil
+}
+
+// truncated describes an error reading part way through an entry
+func truncated(cycle uint64, err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("cycle %d: %w", cycle, err)
+}
@@ -0,0 +1,191 @@
+// Package trace writes execution traces recorded by a cpu.Tracer, as text for reading, JSON Lines for other
+// tools or a compact binary form for long runs
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pthm/gate/cpu"
+	"github.com/pthm/gate/disasm"
+)
+
+// Format selects how entries are written
+type Format int
+
+const (
+	Text   Format = iota // One line per instruction with its disassembly and changes, e.g. V0 00->05
+	JSON                 // One JSON object per instruction, see jsonEntry
+	Binary               // Fixed width fields after a header, see writeBinary
+)
+
+// ParseFormat looks up a format by name
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "text":
+		return Text, nil
+	case "jsonl", "json":
+		return JSON, nil
+	case "binary":
+		return Binary, nil
+	}
+	return Text, fmt.Errorf("unknown trace format %q, must be text, jsonl or binary", name)
+}
+
+// binaryMagic starts binary traces, the last byte is the version of the format
+var binaryMagic = []byte("GTRC\x01")
+
+// jsonEntry is a trace entry as written to JSON Lines. Addresses, opcodes and values are numbers so traces are easy
+// to produce from other emulators, which only need cycle, pc and opcode plus the changes each instruction made, e.g.
+//
+//	{"cycle":1,"pc":514,"opcode":61525,"registers":[{"register":"I","old":768,"new":769}],"memory":[{"addr":768,"old":0,"new":5}]}
+type jsonEntry struct {
+	Cycle     uint64           `json:"cycle"`
+	PC        uint16           `json:"pc"`
+	Opcode    uint16           `json:"opcode"`
+	Long      uint16           `json:"long,omitempty"`
+	Disasm    string           `json:"disasm,omitempty"`
+	Registers []jsonRegister   `json:"registers,omitempty"`
+	Memory    []jsonMemoryByte `json:"memory,omitempty"`
+}
+
+type jsonRegister struct {
+	Register string `json:"register"` // Named as cpu.Register writes it, e.g. V0, I or PC
+	Old      uint16 `json:"old"`
+	New      uint16 `json:"new"`
+}
+
+type jsonMemoryByte struct {
+	Addr uint16 `json:"addr"`
+	Old  uint8  `json:"old"`
+	New  uint8  `json:"new"`
+}
+
+// Writer writes every entry it is given, it is a cpu.Tracer. Write errors are kept and returned by Flush
+type Writer struct {
+	w      *bufio.Writer
+	format Format
+	syntax disasm.Syntax
+	err    error
+}
+
+// NewWriter creates a writer for w, instructions are disassembled in syntax for the text and JSON formats
+func NewWriter(w io.Writer, format Format, syntax disasm.Syntax) *Writer {
+	tw := &Writer{w: bufio.NewWriter(w), format: format, syntax: syntax}
+	if format == Binary {
+		_, tw.err = tw.w.Write(binaryMagic)
+	}
+	return tw
+}
+
+// Trace writes an entry
+func (tw *Writer) Trace(entry *cpu.TraceEntry) {
+	if tw.err != nil {
+		return
+	}
+	switch tw.format {
+	case Text:
+		tw.err = tw.writeText(entry)
+	case JSON:
+		tw.err = tw.writeJSON(entry)
+	case Binary:
+		tw.err = tw.writeBinary(entry)
+	}
+}
+
+// Flush writes any buffered entries, returning the first error writing any entry
+func (tw *Writer) Flush() error {
+	if tw.err != nil {
+		return tw.err
+	}
+	return tw.w.Flush()
+}
+
+// Disassemble disassembles the instruction of an entry
+func Disassemble(entry *cpu.TraceEntry, syntax disasm.Syntax) string {
+	code := []byte{byte(entry.Opcode >> 8), byte(entry.Opcode), byte(entry.Long >> 8), byte(entry.Long)}
+	return disasm.Format(disasm.DecodeAt(code, 0), syntax, nil)
+}
+
+func (tw *Writer) writeText(entry *cpu.TraceEntry) error {
+	tw.w.WriteString(FormatText(entry, tw.syntax))
+	_, err := tw.w.WriteString("\n")
+	return err
+}
+
+// FormatText formats an entry as a line of a text trace, without the newline
+func FormatText(entry *cpu.TraceEntry, syntax disasm.Syntax) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%10d  %04X  %04X  %-24s", entry.Cycle, entry.PC, entry.Opcode, Disassemble(entry, syntax))
+	for _, r := range entry.Registers {
+		fmt.Fprintf(&b, " %s %s->%s", r.Register, formatRegister(r.Register, r.Old), formatRegister(r.Register, r.New))
+	}
+	for _, m := range entry.Memory {
+		fmt.Fprintf(&b, " [%04X] %02X->%02X", m.Addr, m.Old, m.New)
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// formatRegister writes a value as wide as the register
+func formatRegister(r cpu.Register, value uint16) string {
+	if r <= cpu.RegVF || r == cpu.RegDT || r == cpu.RegST {
+		return fmt.Sprintf("%02X", value)
+	}
+	return fmt.Sprintf("%04X", value)
+}
+
+func (tw *Writer) writeJSON(entry *cpu.TraceEntry) error {
+	e := jsonEntry{
+		Cycle:  entry.Cycle,
+		PC:     entry.PC,
+		Opcode: entry.Opcode,
+		Long:   entry.Long,
+		Disasm: Disassemble(entry, tw.syntax),
+	}
+	for _, r := range entry.Registers {
+		e.Registers = append(e.Registers, jsonRegister{Register: r.Register.String(), Old: r.Old, New: r.New})
+	}
+	for _, m := range entry.Memory {
+		e.Memory = append(e.Memory, jsonMemoryByte{Addr: m.Addr, Old: m.Old, New: m.New})
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tw.w.Write(line)
+	_, err = tw.w.WriteString("\n")
+	return err
+}
+
+// writeBinary writes an entry as big endian fields: the cycle as a uvarint, PC, the opcode, the long address for
+// F000 only, a count byte then register, old and new for each register, a uvarint count then address, old and new
+// for each byte of memory
+func (tw *Writer) writeBinary(entry *cpu.TraceEntry) error {
+	buf := make([]byte, 0, 32)
+	buf = binary.AppendUvarint(buf, entry.Cycle)
+	buf = binary.BigEndian.AppendUint16(buf, entry.PC)
+	buf = binary.BigEndian.AppendUint16(buf, entry.Opcode)
+	if entry.Opcode == 0xF000 {
+		buf = binary.BigEndian.AppendUint16(buf, entry.Long)
+	}
+
+	buf = append(buf, byte(len(entry.Registers)))
+	for _, r := range entry.Registers {
+		buf = append(buf, byte(r.Register))
+		buf = binary.BigEndian.AppendUint16(buf, r.Old)
+		buf = binary.BigEndian.AppendUint16(buf, r.New)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(entry.Memory)))
+	for _, m := range entry.Memory {
+		buf = binary.BigEndian.AppendUint16(buf, m.Addr)
+		buf = append(buf, m.Old, m.New)
+	}
+
+	_, err := tw.w.Write(buf)
+	return err
+}
@@ -0,0 +1,88 @@
+package trace
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pthm/gate/cpu"
+	"github.com/pthm/gate/disasm"
+)
+
+var entries = []cpu.TraceEntry{
+	{
+		Cycle:     0,
+		PC:        0x200,
+		Opcode:    0x6005,
+		Registers: []cpu.RegisterChange{{Register: cpu.RegV0, Old: 0, New: 5}},
+	},
+	{
+		Cycle:     1,
+		PC:        0x202,
+		Opcode:    0xF055,
+		Registers: []cpu.RegisterChange{{Register: cpu.RegI, Old: 0x300, New: 0x301}},
+		Memory:    []cpu.MemoryChange{{Addr: 0x300, Old: 0, New: 5}},
+	},
+	{
+		Cycle:  2,
+		PC:     0x204,
+		Opcode: 0xF000,
+		Long:   0x1234,
+	},
+}
+
+func Test_writeText(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Text, disasm.Cowgod)
+	for n := range entries {
+		w.Trace(&entries[n])
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if lines[0] != "         0  0200  6005  LD V0, 0x05              V0 00->05" {
+		t.Fatalf("unexpected line %q\n", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "LD [I], V0               I 0300->0301 [0300] 00->05") {
+		t.Fatalf("unexpected line %q\n", lines[1])
+	}
+	if !strings.Contains(lines[2], "LD I, LONG 0x1234") {
+		t.Fatalf("long instructions should be disassembled with their address, got %q\n", lines[2])
+	}
+}
+
+func Test_writeJSON(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, JSON, disasm.Octo)
+	w.Trace(&entries[1])
+	w.Flush()
+
+	want := `{"cycle":1,"pc":514,"opcode":61525,"disasm":"save v0","registers":[{"register":"I","old":768,"new":769}],"memory":[{"addr":768,"old":0,"new":5}]}` + "\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected JSON %s\n", buf.String())
+	}
+}
+
+func Test_filter(t *testing.T) {
+	classes, err := ParseClasses("6,f")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+	from, to, err := ParseRange("0x202-0x2FF")
+	if err != nil {
+		t.Fatalf("unexpected error: %v\n", err)
+	}
+
+	filter := Filter{From: from, To: to, Classes: classes}
+	if filter.Match(&entries[0]) || !filter.Match(&entries[1]) {
+		t.Fatalf("should only match entries in range\n")
+	}
+	if (Filter{Classes: classes}).Match(&cpu.TraceEntry{Opcode: 0x8014}) {
+		t.Fatalf("should only match the classes given\n")
+	}
+	if _, _, err := ParseRange("0x300-0x200"); err == nil {
+		t.Fatalf("backwards range should return an error\n")
+	}
+}
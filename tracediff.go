@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/pthm/gate/disasm"
+	"github.com/pthm/gate/trace"
+	"os"
+)
+
+// errTracesDiffer is returned by tracediffCommand after printing where the traces disagree, so gate exits non-zero
+var errTracesDiffer = errors.New("traces differ")
+
+// tracediffCommand finds the first instruction where two traces disagree, such as runs with different quirks or a
+// trace exported from another emulator
+func tracediffCommand(args []string) error {
+	flags := flag.NewFlagSet("tracediff", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gate tracediff [flags] a.trace b.trace")
+		flags.PrintDefaults()
+	}
+	syntaxName := flags.String("syntax", "octo", "assembly syntax, octo or cowgod")
+
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return errors.New("must supply the paths of two traces")
+	}
+	syntax, err := disasm.ParseSyntax(*syntaxName)
+	if err != nil {
+		return err
+	}
+
+	var readers [2]*trace.Reader
+	var names [2]string
+	for n := range readers {
+		names[n] = flags.Arg(n)
+		f, err := os.Open(names[n])
+		if err != nil {
+			return fmt.Errorf("could not open trace (%s): %w", names[n], err)
+		}
+		defer f.Close()
+		if readers[n], err = trace.NewReader(f); err != nil {
+			return fmt.Errorf("%s: %w", names[n], err)
+		}
+	}
+
+	d, err := trace.Diff(readers[0], readers[1])
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		fmt.Println("Traces are identical")
+		return nil
+	}
+	d.Write(os.Stdout, names, syntax)
+	return errTracesDiffer
+}
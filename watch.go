@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"github.com/pthm/gate/cpu"
+	"os"
+	"time"
+)
+
+// watchInterval is how often watchFile checks for changes
+const watchInterval = 500 * time.Millisecond
+
+// watchFile calls onChange whenever the file at path is modified, until ctx is cancelled. Editors often write a file
+// in several steps, so a change is only reported once the file has stopped changing for a whole interval
+func watchFile(ctx context.Context, path string, onChange func()) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	last, _ := os.Stat(path)
+	pending := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue // The file may be mid-replace, try again next tick
+		}
+
+		if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+			last = info
+			pending = true
+			continue
+		}
+		if pending {
+			pending = false
+			onChange()
+		}
+	}
+}
+
+// reloadROM reads the ROM from disk, recompiling it if it is source, and restarts it
+func reloadROM(chip8 *cpu.CPU, romPath string) error {
+	program, err := loadProgram(romPath)
+	if err != nil {
+		return err
+	}
+	return chip8.ReloadROM(program.Binary)
+}